@@ -0,0 +1,80 @@
+package async
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Checkpoints persists the pipeline stages a job has completed, with the
+// artifacts each stage produced, so a retried job resumes where it stopped.
+type Checkpoints struct {
+	db *sql.DB
+}
+
+func NewCheckpoints(db *sql.DB) *Checkpoints {
+	return &Checkpoints{db: db}
+}
+
+// Load returns the completed stages of jobID and their artifacts
+func (c *Checkpoints) Load(ctx context.Context, jobID string) (map[string]map[string]string, error) {
+	const query = `
+		SELECT stage, artifacts
+		FROM job_checkpoints
+		WHERE job_id = $1
+	`
+	rows, err := c.db.QueryContext(ctx, query, jobID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load checkpoints: %w", err)
+	}
+	defer rows.Close()
+
+	done := make(map[string]map[string]string)
+	for rows.Next() {
+		var stage string
+		var raw []byte
+		if err := rows.Scan(&stage, &raw); err != nil {
+			return nil, fmt.Errorf("failed to scan checkpoint: %w", err)
+		}
+		artifacts := map[string]string{}
+		if len(raw) > 0 {
+			if err := json.Unmarshal(raw, &artifacts); err != nil {
+				return nil, fmt.Errorf("failed to decode checkpoint %s: %w", stage, err)
+			}
+		}
+		done[stage] = artifacts
+	}
+	return done, rows.Err()
+}
+
+// Save marks stage as completed for jobID. Saving a stage again replaces its artifacts.
+func (c *Checkpoints) Save(ctx context.Context, jobID, stage string, artifacts map[string]string) error {
+	if artifacts == nil {
+		artifacts = map[string]string{}
+	}
+	body, err := json.Marshal(artifacts)
+	if err != nil {
+		return fmt.Errorf("failed to marshal checkpoint: %w", err)
+	}
+	const query = `
+		INSERT INTO job_checkpoints (job_id, stage, artifacts, completed_at)
+		VALUES ($1, $2, $3, NOW())
+		ON CONFLICT (job_id, stage) DO UPDATE
+		SET artifacts = EXCLUDED.artifacts, completed_at = EXCLUDED.completed_at
+	`
+	if _, err := c.db.ExecContext(ctx, query, jobID, stage, string(body)); err != nil {
+		return fmt.Errorf("failed to save checkpoint: %w", err)
+	}
+	return nil
+}
+
+// Cleanup removes checkpoints completed before the given age
+func (c *Checkpoints) Cleanup(ctx context.Context, olderThan time.Duration) error {
+	const query = `DELETE FROM job_checkpoints WHERE completed_at < NOW() - make_interval(secs => $1)`
+	if _, err := c.db.ExecContext(ctx, query, olderThan.Seconds()); err != nil {
+		return fmt.Errorf("failed to cleanup checkpoints: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package async
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestCheckpoints_Load(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer db.Close()
+
+	rows := sqlmock.NewRows([]string{"stage", "artifacts"}).
+		AddRow("download", []byte(`{"original.mp4":"videos/1/a.mp4"}`)).
+		AddRow("trim", []byte(`{}`))
+	mock.ExpectQuery(`SELECT stage, artifacts\s+FROM job_checkpoints`).
+		WithArgs("j1").
+		WillReturnRows(rows)
+
+	done, err := NewCheckpoints(db).Load(context.Background(), "j1")
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if len(done) != 2 {
+		t.Fatalf("len(done) = %d; want 2", len(done))
+	}
+	if got := done["download"]["original.mp4"]; got != "videos/1/a.mp4" {
+		t.Errorf("artifact = %q", got)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet db expectations: %v", err)
+	}
+}
+
+func TestCheckpoints_Save_Upserts(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer db.Close()
+
+	mock.ExpectExec(`INSERT INTO job_checkpoints .* ON CONFLICT \(job_id, stage\) DO UPDATE`).
+		WithArgs("j1", "trim", `{"trim.mp4":"work/j1/trim.mp4"}`).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	err = NewCheckpoints(db).Save(context.Background(), "j1", "trim", map[string]string{"trim.mp4": "work/j1/trim.mp4"})
+	if err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet db expectations: %v", err)
+	}
+}
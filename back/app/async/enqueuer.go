@@ -0,0 +1,128 @@
+package async
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"ISIS4426-Entrega1/app/models"
+)
+
+// The job message lives in models so the persistence layer can write it to
+// the outbox without importing this package.
+const TypeProcessVideo = models.TypeProcessVideo
+
+type VideoProcessingPayload = models.VideoProcessingPayload
+
+// Enqueuer publishes video jobs to a Queue and tracks their status in PostgreSQL
+type Enqueuer struct {
+	queue Queue
+	db    *sql.DB
+}
+
+// NewEnqueuer creates a job enqueuer over any Queue backend
+func NewEnqueuer(q Queue, db *sql.DB) *Enqueuer {
+	return &Enqueuer{queue: q, db: db}
+}
+
+// Queue returns the underlying job queue
+func (e *Enqueuer) Queue() Queue { return e.queue }
+
+// Publish sends a video processing job to the queue. Callers record the job
+// status themselves (see repos.WriteOutbox); the relay is the only producer.
+func (e *Enqueuer) Publish(ctx context.Context, p VideoProcessingPayload) error {
+	body, err := json.Marshal(p)
+	if err != nil {
+		return fmt.Errorf("failed to marshal job body: %w", err)
+	}
+	return e.queue.Enqueue(ctx, body, map[string]string{
+		"JobType": TypeProcessVideo,
+		"VideoID": fmt.Sprintf("%d", p.VideoID),
+	})
+}
+
+// SetStatus updates the job status in PostgreSQL
+func (e *Enqueuer) SetStatus(ctx context.Context, jobID string, status string, ttl time.Duration) error {
+	expiresAt := time.Now().Add(ttl)
+
+	const query = `
+		UPDATE job_status
+		SET status = $1, updated_at = NOW(), expires_at = $2
+		WHERE job_id = $3
+	`
+
+	_, err := e.db.ExecContext(ctx, query, status, expiresAt, jobID)
+	if err != nil {
+		return fmt.Errorf("failed to update job status: %w", err)
+	}
+
+	return nil
+}
+
+// RecordFailure counts a failed processing attempt of jobID and returns how
+// many it has had. Deliveries that end without a failure, such as a worker
+// shutting down, are not counted.
+func (e *Enqueuer) RecordFailure(ctx context.Context, jobID string) (int, error) {
+	const query = `
+		UPDATE job_status
+		SET failures = failures + 1, updated_at = NOW()
+		WHERE job_id = $1
+		RETURNING failures
+	`
+	var failures int
+	err := e.db.QueryRowContext(ctx, query, jobID).Scan(&failures)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, errors.New("job not found or expired")
+		}
+		return 0, fmt.Errorf("failed to record job failure: %w", err)
+	}
+	return failures, nil
+}
+
+// GetStatus retrieces the job status from postgresql
+func (e *Enqueuer) GetStatus(ctx context.Context, jobID string) (string, error) {
+	const query = `
+		SELECT status
+		FROM job_status
+		WHERE job_id = $1 AND expires_at > NOW()
+	`
+	var status string
+	err := e.db.QueryRowContext(ctx, query, jobID).Scan(&status)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", errors.New("job not found or expired")
+		}
+		return "", fmt.Errorf("failed to get job status: %w", err)
+	}
+
+	return status, nil
+}
+
+// Ping check if the queue is accessible (for health checks)
+func (e *Enqueuer) Ping(ctx context.Context) error {
+	return e.queue.Ping(ctx)
+}
+
+// Close is a no-op (queue connections are not owned by the enqueuer)
+func (e *Enqueuer) Close() error {
+	return nil
+}
+
+// Helper: Cleanup expired job statuses (runs periodically)
+func (e *Enqueuer) cleanupExpiredJobStatuses(ctx context.Context) error {
+	const query = `DELETE FROM job_status WHERE expires_at < NOW()`
+	_, err := e.db.ExecContext(ctx, query)
+	if err != nil {
+		return fmt.Errorf("error while cleaning up expired job statuses: %w", err)
+	}
+
+	return nil
+}
+
+func (e *Enqueuer) CleanupExpiredStatuses(ctx context.Context) error {
+	return e.cleanupExpiredJobStatuses(ctx)
+}
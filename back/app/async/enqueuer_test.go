@@ -0,0 +1,34 @@
+package async
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestEnqueuer_RecordFailure(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer db.Close()
+
+	mock.ExpectQuery(`UPDATE job_status\s+SET failures = failures \+ 1`).
+		WithArgs("j1").
+		WillReturnRows(sqlmock.NewRows([]string{"failures"}).AddRow(2))
+	mock.ExpectQuery(`UPDATE job_status\s+SET failures = failures \+ 1`).
+		WithArgs("gone").
+		WillReturnRows(sqlmock.NewRows([]string{"failures"}))
+
+	e := NewEnqueuer(nil, db)
+	if n, err := e.RecordFailure(context.Background(), "j1"); err != nil || n != 2 {
+		t.Errorf("RecordFailure = %d, %v; want 2", n, err)
+	}
+	if _, err := e.RecordFailure(context.Background(), "gone"); err == nil {
+		t.Error("un trabajo vencido debería devolver error")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("expectativas sqlmock: %v", err)
+	}
+}
@@ -0,0 +1,204 @@
+package async
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"ISIS4426-Entrega1/app/repos"
+
+	"github.com/google/uuid"
+)
+
+// Relay publishes pending outbox records to the queue and marks them sent.
+// Several API instances can run it: rows are claimed with SKIP LOCKED.
+type Relay struct {
+	db       *sql.DB
+	enq      *Enqueuer
+	interval time.Duration
+	batch    int
+	// publishTimeout bounds each publish: the batch keeps its rows locked
+	// and its transaction open meanwhile
+	publishTimeout time.Duration
+}
+
+func NewRelay(db *sql.DB, enq *Enqueuer) *Relay {
+	return &Relay{db: db, enq: enq, interval: 2 * time.Second, batch: 50, publishTimeout: 10 * time.Second}
+}
+
+// Run flushes the outbox periodically until ctx is cancelled
+func (r *Relay) Run(ctx context.Context) {
+	t := time.NewTicker(r.interval)
+	defer t.Stop()
+	for {
+		if n, err := r.Flush(ctx); err != nil {
+			log.Printf("[outbox] relay error: %v", err)
+		} else if n > 0 {
+			log.Printf("[outbox] relay published %d job(s)", n)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// Flush publishes one batch of pending records and returns how many were sent.
+// Delivery is at-least-once: a crash between publish and commit re-sends.
+func (r *Relay) Flush(ctx context.Context) (int, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	const pendingQ = `
+		SELECT id, payload
+		FROM outbox
+		WHERE sent_at IS NULL
+		ORDER BY id
+		LIMIT $1
+		FOR UPDATE SKIP LOCKED
+	`
+	rows, err := tx.QueryContext(ctx, pendingQ, r.batch)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read outbox: %w", err)
+	}
+	type record struct {
+		id      int64
+		payload VideoProcessingPayload
+	}
+	var pending []record
+	for rows.Next() {
+		var rec record
+		var body []byte
+		if err := rows.Scan(&rec.id, &body); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		if err := json.Unmarshal(body, &rec.payload); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("invalid outbox payload %d: %w", rec.id, err)
+		}
+		pending = append(pending, rec)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	sent := 0
+	for _, rec := range pending {
+		pctx, cancel := context.WithTimeout(ctx, r.publishTimeout)
+		err := r.enq.Publish(pctx, rec.payload)
+		cancel()
+		if err != nil {
+			// Keep the record pending; the queue is most likely down, so
+			// stop here and retry the rest of the batch on the next tick.
+			const failQ = `UPDATE outbox SET attempts = attempts + 1, last_error = $2 WHERE id = $1`
+			if _, uerr := tx.ExecContext(ctx, failQ, rec.id, err.Error()); uerr != nil {
+				return sent, uerr
+			}
+			log.Printf("[outbox] publish failed job_id=%s video_id=%d err=%v", rec.payload.JobID, rec.payload.VideoID, err)
+			break
+		}
+		const sentQ = `UPDATE outbox SET sent_at = NOW(), attempts = attempts + 1 WHERE id = $1`
+		if _, err := tx.ExecContext(ctx, sentQ, rec.id); err != nil {
+			return sent, err
+		}
+		sent++
+	}
+	return sent, tx.Commit()
+}
+
+// Sweeper re-enqueues videos stuck in 'uploaded' whose last job was never
+// written or was published more than stuckAfter ago. Videos with a job still
+// pending are left alone: their message may just be waiting in a long queue,
+// and a second job would race the first one in finalize. A lost message is
+// picked up once its job status expires.
+type Sweeper struct {
+	db         *sql.DB
+	interval   time.Duration
+	stuckAfter time.Duration
+	batch      int
+}
+
+func NewSweeper(db *sql.DB, stuckAfter time.Duration) *Sweeper {
+	return &Sweeper{db: db, interval: 5 * time.Minute, stuckAfter: stuckAfter, batch: 50}
+}
+
+// Run sweeps periodically until ctx is cancelled
+func (s *Sweeper) Run(ctx context.Context) {
+	t := time.NewTicker(s.interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+		if n, err := s.Sweep(ctx); err != nil {
+			log.Printf("[outbox] sweeper error: %v", err)
+		} else if n > 0 {
+			log.Printf("[outbox] sweeper re-enqueued %d stuck video(s)", n)
+		}
+	}
+}
+
+// Sweep writes a new outbox record for each stuck video
+func (s *Sweeper) Sweep(ctx context.Context) (int, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	const stuckQ = `
+		SELECT v.id, v.user_id, v.title, v.origin_url, v.profile
+		FROM videos v
+		WHERE v.status = 'uploaded'
+		  AND v.uploaded_at < NOW() - make_interval(secs => $1)
+		  AND NOT EXISTS (
+			SELECT 1 FROM outbox o
+			WHERE o.video_id = v.id
+			  AND (o.sent_at IS NULL OR o.sent_at > NOW() - make_interval(secs => $1))
+		  )
+		  AND NOT EXISTS (
+			SELECT 1 FROM outbox o JOIN job_status s ON s.job_id = o.job_id
+			WHERE o.video_id = v.id AND s.status NOT IN ('done', 'cancelled') AND s.status NOT LIKE 'failed%'
+		  )
+		ORDER BY v.id
+		LIMIT $2
+		FOR UPDATE OF v SKIP LOCKED
+	`
+	rows, err := tx.QueryContext(ctx, stuckQ, s.stuckAfter.Seconds(), s.batch)
+	if err != nil {
+		return 0, fmt.Errorf("failed to find stuck videos: %w", err)
+	}
+	var stuck []VideoProcessingPayload
+	for rows.Next() {
+		var p VideoProcessingPayload
+		if err := rows.Scan(&p.VideoID, &p.UserID, &p.Title, &p.InputPath, &p.Profile); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		p.JobID = uuid.New().String()
+		stuck = append(stuck, p)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for _, p := range stuck {
+		if err := repos.WriteOutbox(ctx, tx, p); err != nil {
+			return 0, err
+		}
+		log.Printf("[outbox] sweeper re-enqueue video_id=%d job_id=%s", p.VideoID, p.JobID)
+	}
+	return len(stuck), tx.Commit()
+}
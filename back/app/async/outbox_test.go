@@ -0,0 +1,115 @@
+package async
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+// recordingQueue counts published messages and those sent without a
+// deadline; it fails from the failFrom-th enqueue on, when set
+type recordingQueue struct {
+	Queue
+	published   int
+	failFrom    int
+	noDeadlines int
+}
+
+func (q *recordingQueue) Enqueue(ctx context.Context, body []byte, attrs map[string]string) error {
+	if _, ok := ctx.Deadline(); !ok {
+		q.noDeadlines++
+	}
+	if q.failFrom > 0 && q.published+1 >= q.failFrom {
+		return errors.New("queue down")
+	}
+	q.published++
+	return nil
+}
+
+func outboxRows() *sqlmock.Rows {
+	return sqlmock.NewRows([]string{"id", "payload"}).
+		AddRow(int64(1), []byte(`{"job_id":"j1","video_id":10}`)).
+		AddRow(int64(2), []byte(`{"job_id":"j2","video_id":11}`))
+}
+
+func TestRelay_Flush_MarksRecordsSent(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`FROM outbox\s+WHERE sent_at IS NULL`).WithArgs(50).WillReturnRows(outboxRows())
+	mock.ExpectExec(`UPDATE outbox SET sent_at = NOW\(\)`).WithArgs(int64(1)).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE outbox SET sent_at = NOW\(\)`).WithArgs(int64(2)).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	q := &recordingQueue{}
+	n, err := NewRelay(db, NewEnqueuer(q, db)).Flush(context.Background())
+	if err != nil || n != 2 {
+		t.Fatalf("Flush = %d, %v; want 2", n, err)
+	}
+	if q.published != 2 || q.noDeadlines != 0 {
+		t.Errorf("publicados = %d, sin plazo = %d; want 2 con plazo", q.published, q.noDeadlines)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("expectativas sqlmock: %v", err)
+	}
+}
+
+func TestRelay_Flush_StopsAtPublishFailure(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`FROM outbox\s+WHERE sent_at IS NULL`).WithArgs(50).WillReturnRows(outboxRows())
+	mock.ExpectExec(`UPDATE outbox SET attempts = attempts \+ 1, last_error = \$2`).
+		WithArgs(int64(1), "queue down").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	q := &recordingQueue{failFrom: 1}
+	n, err := NewRelay(db, NewEnqueuer(q, db)).Flush(context.Background())
+	if err != nil || n != 0 {
+		t.Fatalf("Flush = %d, %v; want 0", n, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("expectativas sqlmock: %v", err)
+	}
+}
+
+func TestSweeper_Sweep_SkipsVideosWithPendingJob(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	// only videos without a job still queued, running or retrying are selected
+	mock.ExpectQuery(`WHERE v.status = 'uploaded'(?s:.*)JOIN job_status s ON s.job_id = o.job_id\s+`+
+		`WHERE o.video_id = v.id AND s.status NOT IN \('done', 'cancelled'\) AND s.status NOT LIKE 'failed%'`).
+		WithArgs(float64(600), 50).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "title", "origin_url", "profile"}).
+			AddRow(5, 7, "Clavada", "videos/7/a.mp4", "default"))
+	mock.ExpectExec(`INSERT INTO outbox`).
+		WithArgs(sqlmock.AnyArg(), TypeProcessVideo, 5, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(`INSERT INTO job_status`).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	n, err := NewSweeper(db, 10*time.Minute).Sweep(context.Background())
+	if err != nil || n != 1 {
+		t.Fatalf("Sweep = %d, %v; want 1", n, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("expectativas sqlmock: %v", err)
+	}
+}
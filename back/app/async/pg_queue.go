@@ -0,0 +1,156 @@
+package async
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// PGQueue is a Queue stored in the PostgreSQL jobs table. Receivers claim
+// rows with FOR UPDATE SKIP LOCKED, so several workers can poll concurrently.
+type PGQueue struct {
+	db           *sql.DB
+	name         string
+	visibility   time.Duration
+	waitTime     time.Duration
+	pollInterval time.Duration
+}
+
+var _ Queue = (*PGQueue)(nil)
+
+// NewPGQueue creates a Queue over the rows of the jobs table with queue = name
+func NewPGQueue(db *sql.DB, name string) *PGQueue {
+	return &PGQueue{
+		db:           db,
+		name:         name,
+		visibility:   30 * time.Minute,
+		waitTime:     20 * time.Second,
+		pollInterval: time.Second,
+	}
+}
+
+func (q *PGQueue) Enqueue(ctx context.Context, body []byte, attrs map[string]string) error {
+	a, err := json.Marshal(attrs)
+	if err != nil {
+		return fmt.Errorf("failed to marshal job attributes: %w", err)
+	}
+	const query = `INSERT INTO jobs (queue, body, attributes) VALUES ($1, $2, $3)`
+	if _, err := q.db.ExecContext(ctx, query, q.name, string(body), string(a)); err != nil {
+		return fmt.Errorf("failed to insert job: %w", err)
+	}
+	return nil
+}
+
+// Receive long-polls the table like SQS does: it returns as soon as there are
+// visible jobs, or empty after waitTime.
+func (q *PGQueue) Receive(ctx context.Context, max int, visibility time.Duration) ([]Message, error) {
+	if max <= 0 {
+		max = 1
+	}
+	if visibility <= 0 {
+		visibility = q.visibility
+	}
+	deadline := time.Now().Add(q.waitTime)
+	for {
+		msgs, err := q.claim(ctx, max, visibility)
+		if err != nil || len(msgs) > 0 || time.Now().After(deadline) {
+			return msgs, err
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(q.pollInterval):
+		}
+	}
+}
+
+func (q *PGQueue) claim(ctx context.Context, max int, visibility time.Duration) ([]Message, error) {
+	const query = `
+		UPDATE jobs
+		SET receive_count = receive_count + 1,
+		    receipt = gen_random_uuid(),
+		    visible_at = NOW() + make_interval(secs => $3)
+		WHERE id IN (
+			SELECT id FROM jobs
+			WHERE queue = $1 AND visible_at <= NOW()
+			ORDER BY id
+			LIMIT $2
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, body, attributes, receive_count, receipt::text
+	`
+	rows, err := q.db.QueryContext(ctx, query, q.name, max, visibility.Seconds())
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim jobs: %w", err)
+	}
+	defer rows.Close()
+
+	var out []Message
+	for rows.Next() {
+		var (
+			id    int64
+			body  string
+			attrs []byte
+			m     Message
+		)
+		if err := rows.Scan(&id, &body, &attrs, &m.ReceiveCount, &m.Receipt); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(attrs, &m.Attributes); err != nil {
+			return nil, fmt.Errorf("invalid attributes for job %d: %w", id, err)
+		}
+		m.ID = strconv.FormatInt(id, 10)
+		m.Body = []byte(body)
+		out = append(out, m)
+	}
+	return out, rows.Err()
+}
+
+func (q *PGQueue) Ack(ctx context.Context, m Message) error {
+	const query = `DELETE FROM jobs WHERE id = $1 AND receipt::text = $2`
+	return q.execOwned(ctx, query, m, nil)
+}
+
+func (q *PGQueue) Nack(ctx context.Context, m Message, delay time.Duration) error {
+	const query = `
+		UPDATE jobs SET receipt = NULL, visible_at = NOW() + make_interval(secs => $3)
+		WHERE id = $1 AND receipt::text = $2
+	`
+	return q.execOwned(ctx, query, m, delay.Seconds())
+}
+
+func (q *PGQueue) Extend(ctx context.Context, m Message, visibility time.Duration) error {
+	const query = `
+		UPDATE jobs SET visible_at = NOW() + make_interval(secs => $3)
+		WHERE id = $1 AND receipt::text = $2
+	`
+	return q.execOwned(ctx, query, m, visibility.Seconds())
+}
+
+// execOwned runs a statement guarded by the message receipt; no affected row
+// means another receiver has claimed the job since.
+func (q *PGQueue) execOwned(ctx context.Context, query string, m Message, secs any) error {
+	id, err := strconv.ParseInt(m.ID, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid job id %q: %w", m.ID, err)
+	}
+	args := []any{id, m.Receipt}
+	if secs != nil {
+		args = append(args, secs)
+	}
+	res, err := q.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrStaleReceipt
+	}
+	return nil
+}
+
+func (q *PGQueue) Ping(ctx context.Context) error {
+	return q.db.PingContext(ctx)
+}
@@ -0,0 +1,61 @@
+package async
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestPGQueue_Receive_ClaimsVisibleJobs(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer db.Close()
+
+	rows := sqlmock.NewRows([]string{"id", "body", "attributes", "receive_count", "receipt"}).
+		AddRow(int64(7), `{"job_id":"j1"}`, []byte(`{"JobType":"video:process"}`), 2, "r-1")
+	mock.ExpectQuery(`UPDATE jobs\s+SET receive_count = receive_count \+ 1`).
+		WithArgs("video", 5, float64(60)).
+		WillReturnRows(rows)
+
+	q := NewPGQueue(db, "video")
+	msgs, err := q.Receive(context.Background(), 5, time.Minute)
+	if err != nil {
+		t.Fatalf("Receive: %v", err)
+	}
+	if len(msgs) != 1 {
+		t.Fatalf("len(msgs) = %d; want 1", len(msgs))
+	}
+	m := msgs[0]
+	if m.ID != "7" || m.Receipt != "r-1" || m.ReceiveCount != 2 {
+		t.Errorf("message = %+v", m)
+	}
+	if m.Attributes["JobType"] != TypeProcessVideo {
+		t.Errorf("JobType = %q; want %q", m.Attributes["JobType"], TypeProcessVideo)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet db expectations: %v", err)
+	}
+}
+
+func TestPGQueue_Ack_StaleReceipt(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer db.Close()
+
+	mock.ExpectExec(`DELETE FROM jobs WHERE id = \$1 AND receipt::text = \$2`).
+		WithArgs(int64(7), "old").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	q := NewPGQueue(db, "video")
+	err = q.Ack(context.Background(), Message{ID: "7", Receipt: "old"})
+	if !errors.Is(err, ErrStaleReceipt) {
+		t.Fatalf("Ack err = %v; want ErrStaleReceipt", err)
+	}
+}
@@ -0,0 +1,87 @@
+package async
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// ErrStaleReceipt is returned when a message is acked, nacked or extended by
+// a receiver that no longer owns it (its visibility timeout already expired).
+var ErrStaleReceipt = errors.New("message receipt is no longer valid")
+
+// Message is a job delivered by a Queue. Receipt identifies this delivery and
+// must be passed back to Ack, Nack and Extend.
+type Message struct {
+	ID           string
+	Body         []byte
+	Attributes   map[string]string
+	ReceiveCount int
+	Receipt      string
+}
+
+// Queue is the job queue shared by the API (producer) and the worker (consumer).
+//
+// Received messages stay invisible to other receivers for the visibility
+// timeout; they must be acked once processed, or they are delivered again.
+type Queue interface {
+	Enqueue(ctx context.Context, body []byte, attrs map[string]string) error
+	// Receive waits briefly for up to max messages. A visibility <= 0 uses
+	// the queue default.
+	Receive(ctx context.Context, max int, visibility time.Duration) ([]Message, error)
+	Ack(ctx context.Context, m Message) error
+	// Nack releases the message so it is delivered again after delay
+	Nack(ctx context.Context, m Message, delay time.Duration) error
+	// Extend pushes the visibility timeout of an in-flight message
+	Extend(ctx context.Context, m Message, visibility time.Duration) error
+	Ping(ctx context.Context) error
+}
+
+func getenv(k, d string) string {
+	if v := os.Getenv(k); v != "" {
+		return v
+	}
+	return d
+}
+
+// NewQueueFromEnv selects the queue backend from QUEUE_BACKEND.
+//
+// sqs (default): requires SQS_QUEUE_URL.
+// postgres: uses the jobs table in db, partitioned by QUEUE_NAME (default "video").
+func NewQueueFromEnv(ctx context.Context, db *sql.DB) (Queue, error) {
+	switch backend := getenv("QUEUE_BACKEND", "sqs"); backend {
+	case "sqs":
+		queueURL := getenv("SQS_QUEUE_URL", "")
+		if queueURL == "" {
+			return nil, errors.New("SQS_QUEUE_URL is required")
+		}
+		return NewSQSQueue(ctx, queueURL)
+	case "postgres":
+		return NewPGQueue(db, getenv("QUEUE_NAME", "video")), nil
+	default:
+		return nil, fmt.Errorf("unknown QUEUE_BACKEND %q", backend)
+	}
+}
+
+// NewDeadLetterQueueFromEnv returns the queue that receives jobs the worker
+// gave up on, or nil when none is configured.
+//
+// sqs: SQS_DLQ_URL (optional).
+// postgres: the "<QUEUE_NAME>-dlq" queue in the jobs table.
+func NewDeadLetterQueueFromEnv(ctx context.Context, db *sql.DB) (Queue, error) {
+	switch backend := getenv("QUEUE_BACKEND", "sqs"); backend {
+	case "sqs":
+		dlqURL := getenv("SQS_DLQ_URL", "")
+		if dlqURL == "" {
+			return nil, nil
+		}
+		return NewSQSQueue(ctx, dlqURL)
+	case "postgres":
+		return NewPGQueue(db, getenv("QUEUE_NAME", "video")+"-dlq"), nil
+	default:
+		return nil, fmt.Errorf("unknown QUEUE_BACKEND %q", backend)
+	}
+}
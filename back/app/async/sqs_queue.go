@@ -0,0 +1,149 @@
+package async
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/aws/smithy-go"
+)
+
+// SQSQueue is a Queue backed by an Amazon SQS standard queue
+type SQSQueue struct {
+	sqsClient *sqs.Client
+	queueURL  string
+}
+
+var _ Queue = (*SQSQueue)(nil)
+
+// NewSQSQueue creates a Queue for the given SQS queue URL
+func NewSQSQueue(ctx context.Context, queueURL string) (*SQSQueue, error) {
+	cfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load AWS SDK config: %w", err)
+	}
+	return &SQSQueue{sqsClient: sqs.NewFromConfig(cfg), queueURL: queueURL}, nil
+}
+
+// URL returns the SQS queue URL
+func (q *SQSQueue) URL() string { return q.queueURL }
+
+func (q *SQSQueue) Enqueue(ctx context.Context, body []byte, attrs map[string]string) error {
+	msgAttrs := make(map[string]types.MessageAttributeValue, len(attrs))
+	for k, v := range attrs {
+		msgAttrs[k] = types.MessageAttributeValue{
+			DataType:    aws.String("String"),
+			StringValue: aws.String(v),
+		}
+	}
+	_, err := q.sqsClient.SendMessage(ctx, &sqs.SendMessageInput{
+		QueueUrl:          aws.String(q.queueURL),
+		MessageBody:       aws.String(string(body)),
+		MessageAttributes: msgAttrs,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to send SQS message: %w", err)
+	}
+	return nil
+}
+
+func (q *SQSQueue) Receive(ctx context.Context, max int, visibility time.Duration) ([]Message, error) {
+	if max <= 0 || max > 10 {
+		max = 10
+	}
+	in := &sqs.ReceiveMessageInput{
+		QueueUrl:              aws.String(q.queueURL),
+		MaxNumberOfMessages:   int32(max),
+		WaitTimeSeconds:       20,
+		MessageAttributeNames: []string{"All"},
+		MessageSystemAttributeNames: []types.MessageSystemAttributeName{
+			types.MessageSystemAttributeNameApproximateReceiveCount,
+		},
+	}
+	if visibility > 0 {
+		in.VisibilityTimeout = int32(visibility / time.Second)
+	}
+	resp, err := q.sqsClient.ReceiveMessage(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]Message, 0, len(resp.Messages))
+	for _, m := range resp.Messages {
+		attrs := make(map[string]string, len(m.MessageAttributes))
+		for k, v := range m.MessageAttributes {
+			if v.StringValue != nil {
+				attrs[k] = *v.StringValue
+			}
+		}
+		count, _ := strconv.Atoi(m.Attributes[string(types.MessageSystemAttributeNameApproximateReceiveCount)])
+		out = append(out, Message{
+			ID:           aws.ToString(m.MessageId),
+			Body:         []byte(aws.ToString(m.Body)),
+			Attributes:   attrs,
+			ReceiveCount: count,
+			Receipt:      aws.ToString(m.ReceiptHandle),
+		})
+	}
+	return out, nil
+}
+
+func (q *SQSQueue) Ack(ctx context.Context, m Message) error {
+	_, err := q.sqsClient.DeleteMessage(ctx, &sqs.DeleteMessageInput{
+		QueueUrl:      aws.String(q.queueURL),
+		ReceiptHandle: aws.String(m.Receipt),
+	})
+	return staleReceipt(err)
+}
+
+func (q *SQSQueue) Nack(ctx context.Context, m Message, delay time.Duration) error {
+	return q.changeVisibility(ctx, m, delay)
+}
+
+func (q *SQSQueue) Extend(ctx context.Context, m Message, visibility time.Duration) error {
+	return q.changeVisibility(ctx, m, visibility)
+}
+
+func (q *SQSQueue) changeVisibility(ctx context.Context, m Message, d time.Duration) error {
+	_, err := q.sqsClient.ChangeMessageVisibility(ctx, &sqs.ChangeMessageVisibilityInput{
+		QueueUrl:          aws.String(q.queueURL),
+		ReceiptHandle:     aws.String(m.Receipt),
+		VisibilityTimeout: int32(d / time.Second),
+	})
+	return staleReceipt(err)
+}
+
+// Ping check if SQS is accessible (for health checks)
+func (q *SQSQueue) Ping(ctx context.Context) error {
+	_, err := q.sqsClient.GetQueueAttributes(ctx, &sqs.GetQueueAttributesInput{
+		QueueUrl: aws.String(q.queueURL),
+		AttributeNames: []types.QueueAttributeName{
+			types.QueueAttributeNameApproximateNumberOfMessages,
+		},
+	})
+	return err
+}
+
+// staleReceipt maps SQS "not in flight" errors to ErrStaleReceipt, including
+// the InvalidParameterValue SQS answers once a receipt handle has expired
+func staleReceipt(err error) error {
+	if err == nil {
+		return nil
+	}
+	var notInflight *types.MessageNotInflight
+	var invalid *types.ReceiptHandleIsInvalid
+	var apiErr smithy.APIError
+	expired := errors.As(err, &apiErr) && apiErr.ErrorCode() == "InvalidParameterValue" &&
+		strings.Contains(strings.ToLower(apiErr.ErrorMessage()), "receipt handle has expired")
+	if errors.As(err, &notInflight) || errors.As(err, &invalid) || expired {
+		return fmt.Errorf("%w: %v", ErrStaleReceipt, err)
+	}
+	return err
+}
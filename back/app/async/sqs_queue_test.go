@@ -0,0 +1,35 @@
+package async
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/aws/smithy-go"
+)
+
+func TestStaleReceipt(t *testing.T) {
+	cases := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"not in flight", &types.MessageNotInflight{}, true},
+		{"receipt inválido", &types.ReceiptHandleIsInvalid{}, true},
+		{"receipt vencido", &smithy.GenericAPIError{
+			Code:    "InvalidParameterValue",
+			Message: "Value abc for parameter ReceiptHandle is invalid. Reason: The receipt handle has expired.",
+		}, true},
+		{"otro parámetro inválido", &smithy.GenericAPIError{Code: "InvalidParameterValue", Message: "VisibilityTimeout too large"}, false},
+		{"throttling", fmt.Errorf("change visibility: %w", &types.RequestThrottled{}), false},
+	}
+	for _, c := range cases {
+		if got := errors.Is(staleReceipt(c.err), ErrStaleReceipt); got != c.want {
+			t.Errorf("%s: stale = %t; want %t", c.name, got, c.want)
+		}
+	}
+	if staleReceipt(nil) != nil {
+		t.Error("staleReceipt(nil) debe ser nil")
+	}
+}
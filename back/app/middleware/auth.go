@@ -13,6 +13,7 @@ import (
 type ctxKey string
 
 const userIDKey ctxKey = "user_id"
+const roleKey ctxKey = "role"
 const InvalidToken = "invalid token"
 
 func UserIDFromContext(ctx context.Context) (int, bool) {
@@ -21,6 +22,15 @@ func UserIDFromContext(ctx context.Context) (int, bool) {
 	return id, ok
 }
 
+// RoleFromContext returns the role claimed by the token; tokens issued
+// before roles existed count as a regular user.
+func RoleFromContext(ctx context.Context) string {
+	if role, ok := ctx.Value(roleKey).(string); ok && role != "" {
+		return role
+	}
+	return "user"
+}
+
 func AuthRequired(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		auth := r.Header.Get("Authorization")
@@ -59,6 +69,8 @@ func AuthRequired(next http.Handler) http.Handler {
 			return
 		}
 		uid := int(uidFloat)
-		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), userIDKey, uid)))
+		role, _ := claims["role"].(string)
+		ctx := context.WithValue(r.Context(), userIDKey, uid)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(ctx, roleKey, role)))
 	})
 }
@@ -0,0 +1,16 @@
+package models
+
+const TypeProcessVideo = "video:process"
+
+// VideoProcessingPayload represents the message structure for the job queue
+type VideoProcessingPayload struct {
+	JobID     string `json:"job_id"`
+	VideoID   int    `json:"video_id"`
+	InputPath string `json:"input_path"` // S3 key
+	Title     string `json:"title"`
+	UserID    int    `json:"user_id"`
+	Profile   string `json:"profile,omitempty"` // processing profile; empty selects the default
+	// Reprocess marks a new run over a video already published: its outputs
+	// stay online until this job finalizes, and a failure leaves them as they were
+	Reprocess bool `json:"reprocess,omitempty"`
+}
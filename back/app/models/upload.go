@@ -0,0 +1,34 @@
+package models
+
+import "time"
+
+// ResumableUpload is a tus upload. The first Offset-TailSize bytes are
+// stored as multipart upload parts; the last TailSize bytes wait in a tail
+// object until there are enough of them for another part.
+type ResumableUpload struct {
+	ID          string
+	UserID      int
+	VideoID     int // draft video, completed when the last byte arrives
+	S3Key       string
+	MultipartID string
+	Length      int64
+	Offset      int64
+	TailSize    int64
+	Parts       []UploadPart
+	HashState   []byte // SHA-256 state over the bytes stored in parts
+	JobID       string
+	CreatedAt   time.Time
+	ExpiresAt   time.Time
+	CompletedAt time.Time // zero until the object is assembled and the job created
+}
+
+// UploadPart is a stored part of a multipart upload
+type UploadPart struct {
+	Number int32  `json:"number"`
+	ETag   string `json:"etag"`
+}
+
+// Completed reports whether the upload was handed to processing
+func (u ResumableUpload) Completed() bool {
+	return !u.CompletedAt.IsZero()
+}
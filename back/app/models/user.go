@@ -11,5 +11,12 @@ type User struct {
 	Country      string    `json:"country"`
 	AvatarURL    string    `json:"avatar_url,omitempty"`
 	PasswordHash string    `json:"-"`
+	Role         string    `json:"role"`
 	CreatedAt    time.Time `json:"created_at"`
 }
+
+// User roles. Admins may read, change and delete any video.
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
@@ -5,23 +5,107 @@ import "time"
 type VideoStatus string
 
 const (
+	StatusDraft      VideoStatus = "draft" // created, file not uploaded yet (presigned upload)
 	StatusUploaded   VideoStatus = "uploaded"
 	StatusProcessing VideoStatus = "processing"
 	StatusProcessed  VideoStatus = "processed"
 	StatusFailed     VideoStatus = "failed"
 )
 
+// Visibility tells who may see a video besides its owner: everyone in the
+// public gallery (public), whoever has its share link (unlisted) or nobody
+// (private)
+type Visibility string
+
+const (
+	VisibilityPublic   Visibility = "public"
+	VisibilityUnlisted Visibility = "unlisted"
+	VisibilityPrivate  Visibility = "private"
+)
+
+// Valid reports whether v is one of the known visibility levels
+func (v Visibility) Valid() bool {
+	switch v {
+	case VisibilityPublic, VisibilityUnlisted, VisibilityPrivate:
+		return true
+	}
+	return false
+}
+
 type Video struct {
-	VideoID      int         `json:"video_id"`
-	Title        string      `json:"title,omitempty"`
-	Status       VideoStatus `json:"status,omitempty"`
-	UploadedAt   time.Time   `json:"uploaded_at,omitempty"`
-	ProcessedAt  time.Time   `json:"processed_at,omitempty"`
-	OriginURL    string      `json:"origin_url,omitempty"`
-	ProcessedURL string      `json:"processed_url,omitempty"`
-	ThumbURL     string      `json:"thumb_url,omitempty"`
-	Votes        int         `json:"votes"`
-	UserID       int         `json:"user_id,omitempty"`
+	VideoID       int         `json:"video_id"`
+	Title         string      `json:"title,omitempty"`
+	Description   string      `json:"description,omitempty"`
+	Tags          []string    `json:"tags,omitempty"`
+	Visibility    Visibility  `json:"visibility,omitempty"`
+	ShareToken    string      `json:"share_token,omitempty"` // link of an unlisted video
+	PublishAt     *time.Time  `json:"publish_at,omitempty"`  // public only from then on
+	Status        VideoStatus `json:"status,omitempty"`
+	UploadedAt    time.Time   `json:"uploaded_at,omitempty"`
+	ProcessedAt   time.Time   `json:"processed_at,omitempty"`
+	OriginURL     string      `json:"origin_url,omitempty"`
+	ProcessedURL  string      `json:"processed_url,omitempty"`
+	ThumbURL      string      `json:"thumb_url,omitempty"`
+	Thumbnails    Thumbnails  `json:"thumbnails,omitempty"`
+	SpriteURL     string      `json:"sprite_url,omitempty"`
+	SpriteVTTURL  string      `json:"sprite_vtt_url,omitempty"`
+	PreviewURL    string      `json:"preview_url,omitempty"`
+	PreviewGIFURL string      `json:"preview_gif_url,omitempty"`
+	HLSURL        string      `json:"hls_url,omitempty"`
+	Votes         int         `json:"votes"`
+	UserID        int         `json:"user_id,omitempty"`
+	FailureReason string      `json:"failure_reason,omitempty"`
+	Profile       string      `json:"profile,omitempty"`
+	AudioPolicy   string      `json:"audio_policy,omitempty"`
+	ContentSHA256 string      `json:"content_sha256,omitempty"` // hash of the original file
+	DeletedAt     *time.Time  `json:"deleted_at,omitempty"`     // in the trash since
+	MediaInfo
+}
+
+// MediaInfo is the probe metadata of the uploaded file
+type MediaInfo struct {
+	DurationSec float64 `json:"duration_sec,omitempty"`
+	Width       int     `json:"width,omitempty"`
+	Height      int     `json:"height,omitempty"`
+	FPS         float64 `json:"fps,omitempty"`
+	VideoCodec  string  `json:"video_codec,omitempty"`
+	AudioCodec  string  `json:"audio_codec,omitempty"`
+}
+
+// ProcessedOutputs are the public URLs published when processing finishes,
+// along with the audio policy applied to them
+type ProcessedOutputs struct {
+	ProcessedURL  string
+	ThumbURL      string
+	Thumbnails    Thumbnails
+	SpriteURL     string // seek-preview sprite sheet
+	SpriteVTTURL  string // WebVTT track mapping playback time to sprite tiles
+	PreviewURL    string // short muted gallery clip
+	PreviewGIFURL string // empty unless GIF previews are enabled
+	HLSURL        string // empty when HLS packaging is disabled
+	AudioPolicy   string
+}
+
+// Thumbnails maps a thumbnail size (small, medium, large) to its URL
+type Thumbnails map[string]string
+
+// VideoPatch is the body of a metadata update; nil fields are left as they are
+type VideoPatch struct {
+	Title       *string     `json:"title"`
+	Description *string     `json:"description"`
+	Tags        *[]string   `json:"tags"`
+	Visibility  *Visibility `json:"visibility"`
+	PublishAt   *string     `json:"publish_at"` // RFC 3339; empty publishes right away
+}
+
+// ReprocessFilter selects the videos of a bulk reprocessing; zero fields
+// match everything
+type ReprocessFilter struct {
+	Status  VideoStatus `json:"status"`  // processed or failed
+	From    time.Time   `json:"from"`    // uploaded at or after
+	To      time.Time   `json:"to"`      // uploaded before
+	Profile string      `json:"profile"` // processing profile
+	Limit   int         `json:"limit"`
 }
 
 type CreateVideoRequest struct {
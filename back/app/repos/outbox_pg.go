@@ -0,0 +1,87 @@
+package repos
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"ISIS4426-Entrega1/app/models"
+)
+
+// WriteOutbox records a video processing job inside tx, together with its
+// initial job status. The job is published later by the outbox relay, so it exists
+// if and only if the surrounding transaction commits.
+func WriteOutbox(ctx context.Context, tx *sql.Tx, p models.VideoProcessingPayload) error {
+	body, err := json.Marshal(p)
+	if err != nil {
+		return fmt.Errorf("failed to marshal outbox payload: %w", err)
+	}
+
+	const outboxQ = `
+		INSERT INTO outbox (job_id, job_type, video_id, payload)
+		VALUES ($1, $2, $3, $4)
+	`
+	if _, err := tx.ExecContext(ctx, outboxQ, p.JobID, models.TypeProcessVideo, p.VideoID, string(body)); err != nil {
+		return fmt.Errorf("failed to insert outbox record: %w", err)
+	}
+
+	const statusQ = `
+		INSERT INTO job_status (job_id, status, created_at, updated_at, expires_at)
+		VALUES ($1, 'queued', NOW(), NOW(), NOW() + INTERVAL '24 hours')
+	`
+	if _, err := tx.ExecContext(ctx, statusQ, p.JobID); err != nil {
+		return fmt.Errorf("failed to insert job status: %w", err)
+	}
+	return nil
+}
+
+// CancelJobs marks inside tx every job of videoID as cancelled, unless it
+// already finished, and returns all their IDs. Workers skip cancelled jobs;
+// the outbox records themselves go away with the video.
+func CancelJobs(ctx context.Context, tx *sql.Tx, videoID int) ([]string, error) {
+	rows, err := tx.QueryContext(ctx, `SELECT job_id FROM outbox WHERE video_id = $1`, videoID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list video jobs: %w", err)
+	}
+	var jobIDs []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		jobIDs = append(jobIDs, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	const statusQ = `
+		UPDATE job_status SET status = 'cancelled', updated_at = NOW()
+		WHERE job_id = $1 AND status <> 'done'
+	`
+	for _, id := range jobIDs {
+		if _, err := tx.ExecContext(ctx, statusQ, id); err != nil {
+			return nil, fmt.Errorf("failed to cancel job %s: %w", id, err)
+		}
+	}
+	return jobIDs, nil
+}
+
+// HasPendingJob reports inside tx whether videoID has a job that did not
+// finish yet: queued, running or waiting for a retry.
+func HasPendingJob(ctx context.Context, tx *sql.Tx, videoID int) (bool, error) {
+	const q = `
+		SELECT EXISTS (
+			SELECT 1 FROM outbox o JOIN job_status s ON s.job_id = o.job_id
+			WHERE o.video_id = $1 AND s.status NOT IN ('done', 'cancelled') AND s.status NOT LIKE 'failed%'
+		)
+	`
+	var pending bool
+	if err := tx.QueryRowContext(ctx, q, videoID).Scan(&pending); err != nil {
+		return false, fmt.Errorf("failed to check pending jobs: %w", err)
+	}
+	return pending, nil
+}
@@ -0,0 +1,118 @@
+package repos
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"ISIS4426-Entrega1/app/models"
+)
+
+type UploadRepoPG struct{ DB *sql.DB }
+
+func NewUploadRepoPG(db *sql.DB) *UploadRepoPG { return &UploadRepoPG{DB: db} }
+
+// ErrOffsetConflict means another request moved the upload offset first
+var ErrOffsetConflict = errors.New("upload offset changed")
+
+const uploadColumns = `id, user_id, COALESCE(video_id,0), s3_key, multipart_id, length, upload_offset, tail_size,
+	parts::text, hash_state, COALESCE(job_id,''), created_at, expires_at, completed_at`
+
+func scanUpload(row rowScanner) (models.ResumableUpload, error) {
+	var u models.ResumableUpload
+	var parts string
+	var completed sql.NullTime
+	err := row.Scan(&u.ID, &u.UserID, &u.VideoID, &u.S3Key, &u.MultipartID, &u.Length, &u.Offset, &u.TailSize,
+		&parts, &u.HashState, &u.JobID, &u.CreatedAt, &u.ExpiresAt, &completed)
+	if err != nil {
+		return u, err
+	}
+	u.CompletedAt = completed.Time
+	return u, json.Unmarshal([]byte(parts), &u.Parts)
+}
+
+func (r *UploadRepoPG) Create(ctx context.Context, u models.ResumableUpload) error {
+	const q = `
+	INSERT INTO resumable_uploads (id, user_id, video_id, s3_key, multipart_id, length, created_at, expires_at)
+	VALUES ($1,$2,$3,$4,$5,$6,$7,$8)`
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	_, err := r.DB.ExecContext(ctx, q, u.ID, u.UserID, u.VideoID, u.S3Key, u.MultipartID, u.Length, u.CreatedAt, u.ExpiresAt)
+	return err
+}
+
+// Get returns the upload id of userID
+func (r *UploadRepoPG) Get(ctx context.Context, id string, userID int) (*models.ResumableUpload, error) {
+	q := `SELECT ` + uploadColumns + ` FROM resumable_uploads WHERE id=$1 AND user_id=$2`
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	u, err := scanUpload(r.DB.QueryRowContext(ctx, q, id, userID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+// Advance stores the new offset, tail, parts and hash state of u, provided the offset is
+// still from; ErrOffsetConflict otherwise.
+func (r *UploadRepoPG) Advance(ctx context.Context, u models.ResumableUpload, from int64) error {
+	parts, err := json.Marshal(u.Parts)
+	if err != nil {
+		return err
+	}
+	const q = `
+	UPDATE resumable_uploads SET upload_offset=$1, tail_size=$2, parts=$3::jsonb, hash_state=$4
+	WHERE id=$5 AND upload_offset=$6 AND completed_at IS NULL`
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	res, err := r.DB.ExecContext(ctx, q, u.Offset, u.TailSize, string(parts), u.HashState, u.ID, from)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrOffsetConflict
+	}
+	return nil
+}
+
+// Finish marks the upload as handed to processing with jobID
+func (r *UploadRepoPG) Finish(ctx context.Context, id, jobID string, now time.Time) error {
+	const q = `UPDATE resumable_uploads SET job_id=NULLIF($1,''), completed_at=$2 WHERE id=$3`
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	_, err := r.DB.ExecContext(ctx, q, jobID, now, id)
+	return err
+}
+
+// Expired lists up to limit uploads whose deadline passed, completed or not
+func (r *UploadRepoPG) Expired(ctx context.Context, now time.Time, limit int) ([]models.ResumableUpload, error) {
+	q := `SELECT ` + uploadColumns + ` FROM resumable_uploads WHERE expires_at <= $1 ORDER BY expires_at LIMIT $2`
+	rows, err := r.DB.QueryContext(ctx, q, now, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []models.ResumableUpload
+	for rows.Next() {
+		u, err := scanUpload(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, u)
+	}
+	return out, rows.Err()
+}
+
+func (r *UploadRepoPG) Delete(ctx context.Context, id string) error {
+	const q = `DELETE FROM resumable_uploads WHERE id=$1`
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	_, err := r.DB.ExecContext(ctx, q, id)
+	return err
+}
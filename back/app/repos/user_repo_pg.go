@@ -20,21 +20,21 @@ func (r *UserRepoPG) Create(ctx context.Context, u models.User) (models.User, er
 	const q = `
 	INSERT INTO users (first_name, last_name, city, country, avatar_url, email, password_hash, created_at)
 	VALUES ($1,$2,$3,$4,$5,$6,$7,$8)
-	RETURNING id, created_at`
+	RETURNING id, created_at, role`
 	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
 	err := r.DB.QueryRowContext(ctx, q,
 		u.FirstName, u.LastName, u.City, u.Country, u.AvatarURL, u.Email, u.PasswordHash, time.Now(),
-	).Scan(&u.ID, &u.CreatedAt)
+	).Scan(&u.ID, &u.CreatedAt, &u.Role)
 	return u, err
 }
 
 func (r *UserRepoPG) GetByEmail(ctx context.Context, email string) (*models.User, error) {
-	const q = `SELECT id, first_name, last_name, city, country, COALESCE(avatar_url,''), email, password_hash, created_at FROM users WHERE email=$1`
+	const q = `SELECT id, first_name, last_name, city, country, COALESCE(avatar_url,''), email, password_hash, created_at, role FROM users WHERE email=$1`
 	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
 	var u models.User
-	err := r.DB.QueryRowContext(ctx, q, email).Scan(&u.ID, &u.FirstName, &u.LastName, &u.City, &u.Country, &u.AvatarURL, &u.Email, &u.PasswordHash, &u.CreatedAt)
+	err := r.DB.QueryRowContext(ctx, q, email).Scan(&u.ID, &u.FirstName, &u.LastName, &u.City, &u.Country, &u.AvatarURL, &u.Email, &u.PasswordHash, &u.CreatedAt, &u.Role)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, ErrUserNotFound
@@ -45,11 +45,11 @@ func (r *UserRepoPG) GetByEmail(ctx context.Context, email string) (*models.User
 }
 
 func (r *UserRepoPG) GetByID(ctx context.Context, id int) (*models.User, error) {
-	const q = `SELECT id, first_name, last_name, city, country, COALESCE(avatar_url,''), email, password_hash, created_at FROM users WHERE id=$1`
+	const q = `SELECT id, first_name, last_name, city, country, COALESCE(avatar_url,''), email, password_hash, created_at, role FROM users WHERE id=$1`
 	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
 	var u models.User
-	err := r.DB.QueryRowContext(ctx, q, id).Scan(&u.ID, &u.FirstName, &u.LastName, &u.City, &u.Country, &u.AvatarURL, &u.Email, &u.PasswordHash, &u.CreatedAt)
+	err := r.DB.QueryRowContext(ctx, q, id).Scan(&u.ID, &u.FirstName, &u.LastName, &u.City, &u.Country, &u.AvatarURL, &u.Email, &u.PasswordHash, &u.CreatedAt, &u.Role)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) { return nil, ErrUserNotFound }
 		return nil, err
@@ -3,36 +3,268 @@ package repos
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"time"
 
 	"ISIS4426-Entrega1/app/models"
+
+	"github.com/jackc/pgx/v5/pgconn"
 )
 
 type VideoRepoPG struct{ DB *sql.DB }
 
 func NewVideoRepoPG(db *sql.DB) *VideoRepoPG { return &VideoRepoPG{DB: db} }
 
-var ErrNotFound = errors.New("video not found")
+var (
+	ErrNotFound     = errors.New("video not found")
+	ErrNotDraft     = errors.New("video upload already completed")
+	ErrDraftExpired = errors.New("video upload draft expired")
+	ErrDuplicate    = errors.New("video content already uploaded by the user")
+	ErrInContest    = errors.New("video entered in an active contest")
+	ErrProcessing   = errors.New("video processing not finished")
+)
+
+// isDuplicateContent reports whether err is a violation of the unique
+// (user_id, content_sha256) index of the videos not in the trash
+func isDuplicateContent(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505" && pgErr.ConstraintName == "idx_videos_user_content_live"
+}
+
+// videoColumns is the column list read by scanVideo
+const videoColumns = `id, title, status, uploaded_at, processed_at, origin_url, processed_url, thumb_url, votes, user_id,
+	COALESCE(failure_reason,''), COALESCE(duration_sec,0), COALESCE(width,0), COALESCE(height,0), COALESCE(fps,0),
+	COALESCE(video_codec,''), COALESCE(audio_codec,''), COALESCE(hls_url,''), profile, COALESCE(audio_policy,''),
+	COALESCE(thumbnails::text,''), COALESCE(sprite_url,''), COALESCE(sprite_vtt_url,''),
+	COALESCE(preview_url,''), COALESCE(preview_gif_url,''), COALESCE(content_sha256,''), deleted_at,
+	COALESCE(description,''), tags::text, visibility, COALESCE(share_token,''), publish_at`
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// scanVideo reads videoColumns, followed by the extra columns of the query
+func scanVideo(row rowScanner, extra ...any) (models.Video, error) {
+	var v models.Video
+	var thumbs, tags string
+	var deleted, publish sql.NullTime
+	dest := []any{&v.VideoID, &v.Title, &v.Status, &v.UploadedAt, &v.ProcessedAt,
+		&v.OriginURL, &v.ProcessedURL, &v.ThumbURL, &v.Votes, &v.UserID,
+		&v.FailureReason, &v.DurationSec, &v.Width, &v.Height, &v.FPS,
+		&v.VideoCodec, &v.AudioCodec, &v.HLSURL, &v.Profile, &v.AudioPolicy,
+		&thumbs, &v.SpriteURL, &v.SpriteVTTURL, &v.PreviewURL, &v.PreviewGIFURL, &v.ContentSHA256, &deleted,
+		&v.Description, &tags, &v.Visibility, &v.ShareToken, &publish}
+	err := row.Scan(append(dest, extra...)...)
+	if deleted.Valid {
+		v.DeletedAt = &deleted.Time
+	}
+	if publish.Valid {
+		v.PublishAt = &publish.Time
+	}
+	if err == nil && thumbs != "" {
+		err = json.Unmarshal([]byte(thumbs), &v.Thumbnails)
+	}
+	if err == nil && tags != "" {
+		err = json.Unmarshal([]byte(tags), &v.Tags)
+	}
+	return v, err
+}
 
 func (r *VideoRepoPG) Create(v models.Video) (models.Video, error) {
 	const q = `
-	INSERT INTO videos (title, status, uploaded_at, processed_at, origin_url, processed_url, thumb_url, votes, user_id)
-	VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9)
+	INSERT INTO videos (title, status, uploaded_at, processed_at, origin_url, processed_url, thumb_url, votes, user_id,
+	    visibility, share_token, publish_at)
+	VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,NULLIF($11,''),$12)
 	RETURNING id, uploaded_at, processed_at`
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
 	err := r.DB.QueryRowContext(ctx, q,
 		v.Title, v.Status, v.UploadedAt, v.ProcessedAt, v.OriginURL, v.ProcessedURL, v.ThumbURL, v.Votes, v.UserID,
+		v.Visibility, v.ShareToken, v.PublishAt,
 	).Scan(&v.VideoID, &v.UploadedAt, &v.ProcessedAt)
 	return v, err
 }
 
+// CreateWithJob inserts the video and its processing job (outbox record and
+// job status) in a single transaction. ErrDuplicate when the user already has
+// a video with the same content.
+func (r *VideoRepoPG) CreateWithJob(ctx context.Context, v models.Video, jobID string) (models.Video, error) {
+	const q = `
+	INSERT INTO videos (title, status, uploaded_at, processed_at, origin_url, processed_url, thumb_url, votes, user_id, profile, content_sha256,
+	    visibility, share_token, publish_at)
+	VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,NULLIF($11,''),$12,NULLIF($13,''),$14)
+	RETURNING id, uploaded_at, processed_at`
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return v, err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx, q,
+		v.Title, v.Status, v.UploadedAt, v.ProcessedAt, v.OriginURL, v.ProcessedURL, v.ThumbURL, v.Votes, v.UserID, v.Profile,
+		v.ContentSHA256, v.Visibility, v.ShareToken, v.PublishAt,
+	).Scan(&v.VideoID, &v.UploadedAt, &v.ProcessedAt)
+	if isDuplicateContent(err) {
+		return v, ErrDuplicate
+	}
+	if err != nil {
+		return v, err
+	}
+
+	err = WriteOutbox(ctx, tx, models.VideoProcessingPayload{
+		JobID:     jobID,
+		VideoID:   v.VideoID,
+		InputPath: v.OriginURL,
+		Title:     v.Title,
+		UserID:    v.UserID,
+		Profile:   v.Profile,
+	})
+	if err != nil {
+		return v, err
+	}
+	return v, tx.Commit()
+}
+
+// CreateDraft inserts a video whose file is still being uploaded by the
+// client. Drafts are hidden from listings and expire at expiresAt.
+func (r *VideoRepoPG) CreateDraft(ctx context.Context, v models.Video, expiresAt time.Time) (models.Video, error) {
+	const q = `
+	INSERT INTO videos (title, status, uploaded_at, processed_at, origin_url, processed_url, thumb_url, votes, user_id, profile, upload_expires_at,
+	    visibility, share_token, publish_at)
+	VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,NULLIF($13,''),$14)
+	RETURNING id, uploaded_at`
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	err := r.DB.QueryRowContext(ctx, q,
+		v.Title, models.StatusDraft, v.UploadedAt, v.ProcessedAt, v.OriginURL, v.ProcessedURL, v.ThumbURL, v.Votes, v.UserID,
+		v.Profile, expiresAt, v.Visibility, v.ShareToken, v.PublishAt,
+	).Scan(&v.VideoID, &v.UploadedAt)
+	v.Status = models.StatusDraft
+	return v, err
+}
+
+// draftQuery reads a draft of a user; the lock makes completing it atomic
+const draftQuery = `
+	SELECT ` + videoColumns + `, upload_expires_at
+	FROM videos WHERE id = $1 AND user_id = $2`
+
+func scanDraft(row rowScanner, now time.Time) (*models.Video, error) {
+	var expires sql.NullTime
+	v, err := scanVideo(row, &expires)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return nil, ErrNotFound
+	case err != nil:
+		return nil, err
+	case v.Status != models.StatusDraft:
+		return nil, ErrNotDraft
+	case expires.Valid && !now.Before(expires.Time):
+		return nil, ErrDraftExpired
+	}
+	return &v, nil
+}
+
+// GetDraft returns the pending draft id of userID: ErrNotFound when it does
+// not exist or belongs to someone else, ErrNotDraft once completed and
+// ErrDraftExpired after its deadline.
+func (r *VideoRepoPG) GetDraft(ctx context.Context, id, userID int, now time.Time) (*models.Video, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	return scanDraft(r.DB.QueryRowContext(ctx, draftQuery, id, userID), now)
+}
+
+// CompleteDraft moves a pending draft to uploaded and writes its processing
+// job to the outbox in a single transaction, with the same checks as GetDraft.
+// contentSHA256 may be empty when the API never saw the file.
+func (r *VideoRepoPG) CompleteDraft(ctx context.Context, id, userID int, jobID, contentSHA256 string, now time.Time) (models.Video, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return models.Video{}, err
+	}
+	defer tx.Rollback()
+
+	v, err := scanDraft(tx.QueryRowContext(ctx, draftQuery+` FOR UPDATE`, id, userID), now)
+	if err != nil {
+		return models.Video{}, err
+	}
+	const q = `UPDATE videos SET status=$1, uploaded_at=$2, upload_expires_at=NULL, content_sha256=NULLIF($3,'') WHERE id=$4`
+	_, err = tx.ExecContext(ctx, q, models.StatusUploaded, now, contentSHA256, id)
+	if isDuplicateContent(err) {
+		return models.Video{}, ErrDuplicate
+	}
+	if err != nil {
+		return models.Video{}, err
+	}
+	v.Status, v.UploadedAt, v.ContentSHA256 = models.StatusUploaded, now, contentSHA256
+
+	err = WriteOutbox(ctx, tx, models.VideoProcessingPayload{
+		JobID:     jobID,
+		VideoID:   v.VideoID,
+		InputPath: v.OriginURL,
+		Title:     v.Title,
+		UserID:    v.UserID,
+		Profile:   v.Profile,
+	})
+	if err != nil {
+		return models.Video{}, err
+	}
+	return *v, tx.Commit()
+}
+
+// ExpiredDrafts lists up to limit drafts whose upload deadline passed
+func (r *VideoRepoPG) ExpiredDrafts(ctx context.Context, now time.Time, limit int) ([]models.Video, error) {
+	const q = `
+	SELECT ` + videoColumns + `
+	FROM videos
+	WHERE status = $1 AND upload_expires_at <= $2
+	ORDER BY id
+	LIMIT $3`
+	rows, err := r.DB.QueryContext(ctx, q, models.StatusDraft, now, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []models.Video
+	for rows.Next() {
+		v, err := scanVideo(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, v)
+	}
+	return out, rows.Err()
+}
+
+// DeleteExpiredDraft removes a draft, only if it is still an expired draft
+func (r *VideoRepoPG) DeleteExpiredDraft(ctx context.Context, id int, now time.Time) error {
+	const q = `DELETE FROM videos WHERE id=$1 AND status=$2 AND upload_expires_at <= $3`
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	res, err := r.DB.ExecContext(ctx, q, id, models.StatusDraft, now)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
 func (r *VideoRepoPG) List(ctx context.Context, limit, offset int) ([]models.Video, error) {
 	const q = `
-	SELECT id, title, status, uploaded_at, processed_at, origin_url, processed_url, thumb_url, votes, user_id
+	SELECT ` + videoColumns + `
 	FROM videos
+	WHERE status <> 'draft' AND deleted_at IS NULL
 	ORDER BY id DESC
 	LIMIT $1 OFFSET $2`
 	rows, err := r.DB.QueryContext(ctx, q, limit, offset)
@@ -43,9 +275,8 @@ func (r *VideoRepoPG) List(ctx context.Context, limit, offset int) ([]models.Vid
 
 	var out []models.Video
 	for rows.Next() {
-		var v models.Video
-		if err := rows.Scan(&v.VideoID, &v.Title, &v.Status, &v.UploadedAt, &v.ProcessedAt,
-			&v.OriginURL, &v.ProcessedURL, &v.ThumbURL, &v.Votes, &v.UserID); err != nil {
+		v, err := scanVideo(rows)
+		if err != nil {
 			return nil, err
 		}
 		out = append(out, v)
@@ -55,9 +286,9 @@ func (r *VideoRepoPG) List(ctx context.Context, limit, offset int) ([]models.Vid
 
 func (r *VideoRepoPG) ListByUser(ctx context.Context, userID, limit, offset int) ([]models.Video, error) {
 	const q = `
-	SELECT id, title, status, uploaded_at, processed_at, origin_url, processed_url, thumb_url, votes, user_id
+	SELECT ` + videoColumns + `
 	FROM videos
-	WHERE user_id = $1
+	WHERE user_id = $1 AND status <> 'draft' AND deleted_at IS NULL
 	ORDER BY id DESC
 	LIMIT $2 OFFSET $3`
 	rows, err := r.DB.QueryContext(ctx, q, userID, limit, offset)
@@ -68,9 +299,8 @@ func (r *VideoRepoPG) ListByUser(ctx context.Context, userID, limit, offset int)
 
 	var out []models.Video
 	for rows.Next() {
-		var v models.Video
-		if err := rows.Scan(&v.VideoID, &v.Title, &v.Status, &v.UploadedAt, &v.ProcessedAt,
-			&v.OriginURL, &v.ProcessedURL, &v.ThumbURL, &v.Votes, &v.UserID); err != nil {
+		v, err := scanVideo(rows)
+		if err != nil {
 			return nil, err
 		}
 		out = append(out, v)
@@ -80,19 +310,53 @@ func (r *VideoRepoPG) ListByUser(ctx context.Context, userID, limit, offset int)
 
 func (r *VideoRepoPG) GetByID(ctx context.Context, id int) (*models.Video, error) {
 	const q = `
-	SELECT id, title, status, uploaded_at, processed_at, origin_url, processed_url, thumb_url, votes, user_id
+	SELECT ` + videoColumns + `
 	FROM videos WHERE id = $1`
-	var v models.Video
-	err := r.DB.QueryRowContext(ctx, q, id).Scan(
-		&v.VideoID, &v.Title, &v.Status, &v.UploadedAt, &v.ProcessedAt,
-		&v.OriginURL, &v.ProcessedURL, &v.ThumbURL, &v.Votes, &v.UserID,
-	)
+	v, err := scanVideo(r.DB.QueryRowContext(ctx, q, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
 	if err != nil {
 		return nil, err
 	}
 	return &v, nil
 }
 
+// FindByContent returns the video of userID with the given content hash,
+// other than exceptID, not failed and not in the trash; ErrNotFound when
+// there is none.
+func (r *VideoRepoPG) FindByContent(ctx context.Context, userID int, contentSHA256 string, exceptID int) (*models.Video, error) {
+	const q = `
+	SELECT ` + videoColumns + `
+	FROM videos
+	WHERE user_id=$1 AND content_sha256=$2 AND id<>$3 AND status<>$4 AND deleted_at IS NULL
+	LIMIT 1`
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	v, err := scanVideo(r.DB.QueryRowContext(ctx, q, userID, contentSHA256, exceptID, models.StatusFailed))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+// SetContentSHA256 records the content hash of a video that has none yet
+// (direct uploads are hashed by the worker); ErrDuplicate when the user
+// already has a video with that content.
+func (r *VideoRepoPG) SetContentSHA256(ctx context.Context, id int, contentSHA256 string) error {
+	const q = `UPDATE videos SET content_sha256=$1 WHERE id=$2 AND content_sha256 IS NULL`
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	_, err := r.DB.ExecContext(ctx, q, contentSHA256, id)
+	if isDuplicateContent(err) {
+		return ErrDuplicate
+	}
+	return err
+}
+
 func (r *VideoRepoPG) Delete(ctx context.Context, id int) error {
 	const q = `DELETE FROM videos WHERE id=$1`
 	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
@@ -107,8 +371,145 @@ func (r *VideoRepoPG) Delete(ctx context.Context, id int) error {
 	return nil
 }
 
+// checkNotInContest returns ErrInContest when video id is entered in a
+// contest running at now
+func checkNotInContest(ctx context.Context, tx *sql.Tx, id int, now time.Time) error {
+	const q = `
+	SELECT EXISTS (
+		SELECT 1 FROM contest_entries e JOIN contests c ON c.id = e.contest_id
+		WHERE e.video_id = $1 AND c.starts_at <= $2 AND c.ends_at > $2
+	)`
+	var locked bool
+	if err := tx.QueryRowContext(ctx, q, id, now).Scan(&locked); err != nil {
+		return err
+	}
+	if locked {
+		return ErrInContest
+	}
+	return nil
+}
+
+// SoftDelete moves the video to the trash at now: it disappears from
+// listings, keeping its votes and files until it is restored or purged.
+// ErrInContest like DeleteWithJobs.
+func (r *VideoRepoPG) SoftDelete(ctx context.Context, id int, now time.Time) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := checkNotInContest(ctx, tx, id, now); err != nil {
+		return err
+	}
+	res, err := tx.ExecContext(ctx, `UPDATE videos SET deleted_at=$1 WHERE id=$2 AND deleted_at IS NULL`, now, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return tx.Commit()
+}
+
+// Restore takes the video out of the trash; ErrDuplicate when the user
+// uploaded the same content again meanwhile.
+func (r *VideoRepoPG) Restore(ctx context.Context, id int) error {
+	const q = `UPDATE videos SET deleted_at=NULL WHERE id=$1 AND deleted_at IS NOT NULL`
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	res, err := r.DB.ExecContext(ctx, q, id)
+	if isDuplicateContent(err) {
+		return ErrDuplicate
+	}
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// ListTrash lists the videos of userID in the trash, latest deleted first
+func (r *VideoRepoPG) ListTrash(ctx context.Context, userID, limit, offset int) ([]models.Video, error) {
+	const q = `
+	SELECT ` + videoColumns + `
+	FROM videos
+	WHERE user_id = $1 AND deleted_at IS NOT NULL
+	ORDER BY deleted_at DESC, id DESC
+	LIMIT $2 OFFSET $3`
+	return r.queryVideos(ctx, q, userID, limit, offset)
+}
+
+// DeletedBefore lists up to limit videos moved to the trash before t
+func (r *VideoRepoPG) DeletedBefore(ctx context.Context, t time.Time, limit int) ([]models.Video, error) {
+	const q = `
+	SELECT ` + videoColumns + `
+	FROM videos
+	WHERE deleted_at < $1
+	ORDER BY deleted_at
+	LIMIT $2`
+	return r.queryVideos(ctx, q, t, limit)
+}
+
+func (r *VideoRepoPG) queryVideos(ctx context.Context, q string, args ...any) ([]models.Video, error) {
+	rows, err := r.DB.QueryContext(ctx, q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []models.Video
+	for rows.Next() {
+		v, err := scanVideo(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, v)
+	}
+	return out, rows.Err()
+}
+
+// DeleteWithJobs deletes the video with its votes and cancels its processing
+// jobs, returning their IDs. Videos entered in a contest running at now are
+// kept (ErrInContest).
+func (r *VideoRepoPG) DeleteWithJobs(ctx context.Context, id int, now time.Time) ([]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if err := checkNotInContest(ctx, tx, id, now); err != nil {
+		return nil, err
+	}
+	jobIDs, err := CancelJobs(ctx, tx, id)
+	if err != nil {
+		return nil, err
+	}
+	res, err := tx.ExecContext(ctx, `DELETE FROM videos WHERE id=$1`, id)
+	if err != nil {
+		return nil, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil, ErrNotFound
+	}
+	return jobIDs, tx.Commit()
+}
+
 func (r *VideoRepoPG) UpdateStatus(ctx context.Context, id int, status models.VideoStatus, updatedAt time.Time) error {
-	const q = `UPDATE videos SET status=$1, processed_at=$2 WHERE id=$3`
+	// leaving the failed state clears the stored failure reason
+	const q = `
+	UPDATE videos
+	SET status=$1, processed_at=$2, failure_reason = CASE WHEN $1 = 'failed' THEN failure_reason END
+	WHERE id=$3`
 	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
 	res, err := r.DB.ExecContext(ctx, q, status, updatedAt, id)
@@ -148,3 +549,264 @@ func (r *VideoRepoPG) UpdateThumbURL(ctx context.Context, id int, url string, up
 	}
 	return nil
 }
+
+// MarkFailed moves the video to the terminal failed state with the reason shown to its owner
+func (r *VideoRepoPG) MarkFailed(ctx context.Context, id int, reason string, updatedAt time.Time) error {
+	const q = `UPDATE videos SET status=$1, failure_reason=$2, processed_at=$3 WHERE id=$4`
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	res, err := r.DB.ExecContext(ctx, q, models.StatusFailed, reason, updatedAt, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// MarkProcessed publishes the processing outputs and moves the video to
+// processed in a single statement, so re-running it is harmless.
+func (r *VideoRepoPG) MarkProcessed(ctx context.Context, id int, out models.ProcessedOutputs, updatedAt time.Time) error {
+	const q = `
+	UPDATE videos
+	SET status=$1, processed_url=$2, thumb_url=$3, hls_url=NULLIF($4,''), audio_policy=NULLIF($5,''),
+	    thumbnails=$6::jsonb, sprite_url=NULLIF($7,''), sprite_vtt_url=NULLIF($8,''),
+	    preview_url=NULLIF($9,''), preview_gif_url=NULLIF($10,''),
+	    processed_at=$11, failure_reason=NULL
+	WHERE id=$12`
+	thumbs, err := json.Marshal(out.Thumbnails)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	res, err := r.DB.ExecContext(ctx, q, models.StatusProcessed, out.ProcessedURL, out.ThumbURL, out.HLSURL, out.AudioPolicy,
+		string(thumbs), out.SpriteURL, out.SpriteVTTURL, out.PreviewURL, out.PreviewGIFURL, updatedAt, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// UpdateMetadata stores the editable fields of v: title, description, tags,
+// visibility with its share token, and publish date. Videos in the trash are
+// not found.
+func (r *VideoRepoPG) UpdateMetadata(ctx context.Context, v models.Video) error {
+	tags := v.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+	b, err := json.Marshal(tags)
+	if err != nil {
+		return err
+	}
+	const q = `
+	UPDATE videos SET title=$1, description=NULLIF($2,''), tags=$3::jsonb, visibility=$4,
+	    share_token=NULLIF($5,''), publish_at=$6
+	WHERE id=$7 AND deleted_at IS NULL`
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	res, err := r.DB.ExecContext(ctx, q, v.Title, v.Description, string(b), v.Visibility, v.ShareToken, v.PublishAt, v.VideoID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// ReplaceSource points video v.VideoID at the original file v.OriginURL, with
+// its content hash and profile, and writes the processing job in a single
+// transaction. The votes are reset unless keepVotes. Only a video whose
+// processing finished (processed or failed) and that has no pending job
+// (see lockIdle) can be replaced: ErrProcessing otherwise, ErrNotFound when
+// it went to the trash; ErrDuplicate when the user has another video with
+// the same content.
+func (r *VideoRepoPG) ReplaceSource(ctx context.Context, v models.Video, keepVotes bool, jobID string, now time.Time) (models.Video, error) {
+	const q = `
+	UPDATE videos
+	SET origin_url=$1, content_sha256=NULLIF($2,''), profile=$3, status=$4, uploaded_at=$5, failure_reason=NULL,
+	    votes = CASE WHEN $6 THEN votes ELSE 0 END
+	WHERE id=$7 AND status IN ($8, $9) AND deleted_at IS NULL
+	RETURNING ` + videoColumns
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return models.Video{}, err
+	}
+	defer tx.Rollback()
+
+	if err := lockIdle(ctx, tx, v.VideoID); err != nil {
+		return models.Video{}, err
+	}
+	out, err := scanVideo(tx.QueryRowContext(ctx, q, v.OriginURL, v.ContentSHA256, v.Profile, models.StatusUploaded, now,
+		keepVotes, v.VideoID, models.StatusProcessed, models.StatusFailed))
+	switch {
+	case isDuplicateContent(err):
+		return models.Video{}, ErrDuplicate
+	case errors.Is(err, sql.ErrNoRows):
+		return models.Video{}, ErrProcessing
+	case err != nil:
+		return models.Video{}, err
+	}
+	if !keepVotes {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM votes WHERE video_id=$1`, v.VideoID); err != nil {
+			return models.Video{}, err
+		}
+	}
+
+	err = WriteOutbox(ctx, tx, models.VideoProcessingPayload{
+		JobID:     jobID,
+		VideoID:   out.VideoID,
+		InputPath: out.OriginURL,
+		Title:     out.Title,
+		UserID:    out.UserID,
+		Profile:   out.Profile,
+	})
+	if err != nil {
+		return models.Video{}, err
+	}
+	return out, tx.Commit()
+}
+
+// lockIdle locks the row of video id inside tx and returns ErrProcessing
+// when one of its jobs has not finished, ErrNotFound when it does not exist
+// or is in the trash. Holding the lock until commit keeps two requests from
+// queueing jobs for the same video.
+func lockIdle(ctx context.Context, tx *sql.Tx, id int) error {
+	var status models.VideoStatus
+	err := tx.QueryRowContext(ctx, `SELECT status FROM videos WHERE id=$1 AND deleted_at IS NULL FOR UPDATE`, id).Scan(&status)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if status != models.StatusProcessed && status != models.StatusFailed {
+		return ErrProcessing
+	}
+	pending, err := HasPendingJob(ctx, tx, id)
+	if err != nil {
+		return err
+	}
+	if pending {
+		return ErrProcessing
+	}
+	return nil
+}
+
+// Reprocess writes a new processing job for video id from its stored
+// original, with the checks of lockIdle. A processed video stays published
+// until the job finalizes (VideoProcessingPayload.Reprocess); a failed one
+// goes back to uploaded.
+func (r *VideoRepoPG) Reprocess(ctx context.Context, id int, jobID string) (models.Video, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return models.Video{}, err
+	}
+	defer tx.Rollback()
+
+	if err := lockIdle(ctx, tx, id); err != nil {
+		return models.Video{}, err
+	}
+	v, err := scanVideo(tx.QueryRowContext(ctx, `SELECT `+videoColumns+` FROM videos WHERE id=$1`, id))
+	if err != nil {
+		return models.Video{}, err
+	}
+	published := v.Status == models.StatusProcessed
+	if !published {
+		const q = `UPDATE videos SET status=$1, failure_reason=NULL WHERE id=$2`
+		if _, err := tx.ExecContext(ctx, q, models.StatusUploaded, id); err != nil {
+			return models.Video{}, err
+		}
+		v.Status, v.FailureReason = models.StatusUploaded, ""
+	}
+
+	err = WriteOutbox(ctx, tx, models.VideoProcessingPayload{
+		JobID:     jobID,
+		VideoID:   v.VideoID,
+		InputPath: v.OriginURL,
+		Title:     v.Title,
+		UserID:    v.UserID,
+		Profile:   v.Profile,
+		Reprocess: published,
+	})
+	if err != nil {
+		return models.Video{}, err
+	}
+	return v, tx.Commit()
+}
+
+// FindForReprocess lists up to f.Limit videos, not in the trash, whose
+// processing finished and that match the filters set in f
+func (r *VideoRepoPG) FindForReprocess(ctx context.Context, f models.ReprocessFilter) ([]models.Video, error) {
+	q := `SELECT ` + videoColumns + ` FROM videos WHERE deleted_at IS NULL AND status IN ($1, $2)`
+	args := []any{models.StatusProcessed, models.StatusFailed}
+	where := func(cond string, v any) {
+		args = append(args, v)
+		q += fmt.Sprintf(" AND "+cond, len(args))
+	}
+	if f.Status != "" {
+		where("status = $%d", f.Status)
+	}
+	if !f.From.IsZero() {
+		where("uploaded_at >= $%d", f.From)
+	}
+	if !f.To.IsZero() {
+		where("uploaded_at < $%d", f.To)
+	}
+	if f.Profile != "" {
+		where("profile = $%d", f.Profile)
+	}
+	args = append(args, f.Limit)
+	q += fmt.Sprintf(" ORDER BY id LIMIT $%d", len(args))
+	return r.queryVideos(ctx, q, args...)
+}
+
+// JobIDs returns the IDs of every processing job written for video id
+func (r *VideoRepoPG) JobIDs(ctx context.Context, id int) ([]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	rows, err := r.DB.QueryContext(ctx, `SELECT job_id FROM outbox WHERE video_id = $1 ORDER BY id`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var ids []string
+	for rows.Next() {
+		var jobID string
+		if err := rows.Scan(&jobID); err != nil {
+			return nil, err
+		}
+		ids = append(ids, jobID)
+	}
+	return ids, rows.Err()
+}
+
+// UpdateMediaInfo stores the probe metadata of the uploaded file
+func (r *VideoRepoPG) UpdateMediaInfo(ctx context.Context, id int, m models.MediaInfo) error {
+	const q = `
+	UPDATE videos
+	SET duration_sec=$1, width=$2, height=$3, fps=$4, video_codec=$5, audio_codec=NULLIF($6,'')
+	WHERE id=$7`
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	res, err := r.DB.ExecContext(ctx, q, m.DurationSec, m.Width, m.Height, m.FPS, m.VideoCodec, m.AudioCodec, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
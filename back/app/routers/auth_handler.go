@@ -10,18 +10,18 @@ import (
 
 	"ISIS4426-Entrega1/app/middleware"
 	"ISIS4426-Entrega1/app/services"
-	"ISIS4426-Entrega1/internal/s3client"
+	"ISIS4426-Entrega1/internal/storage"
 )
 
 const invalidJSONMsg = "invalid json"
 
 type AuthHandler struct {
-	svc      *services.AuthService
-	s3Client *s3client.S3Client
+	svc   *services.AuthService
+	store storage.Storage
 }
 
-func NewAuthHandler(svc *services.AuthService, s3 *s3client.S3Client) *AuthHandler {
-	return &AuthHandler{svc: svc, s3Client: s3}
+func NewAuthHandler(svc *services.AuthService, store storage.Storage) *AuthHandler {
+	return &AuthHandler{svc: svc, store: store}
 }
 
 func (h *AuthHandler) Signup(w http.ResponseWriter, r *http.Request) {
@@ -156,17 +156,17 @@ func (h *AuthHandler) UploadAvatar(w http.ResponseWriter, r *http.Request) {
 	s3Key := fmt.Sprintf("avatars/%d/%s", uid, filepath.Base(hdr.Filename))
 
 	// Upload to S3 processed bucket (avatars should be publicly accessible)
-	if err := h.s3Client.UploadToProcessed(r.Context(), s3Key, f); err != nil {
+	if err := h.store.UploadToProcessed(r.Context(), s3Key, f); err != nil {
 		http.Error(w, "cannot upload avatar to S3", http.StatusInternalServerError)
 		return
 	}
 
 	// Generate S3 URL for the avatar
-	avatarURL := h.s3Client.GetProcessedFileURL(s3Key)
+	avatarURL := h.store.GetProcessedFileURL(s3Key)
 
 	if err := h.svc.Users().UpdateAvatar(r.Context(), uid, avatarURL); err != nil {
 		// Clean up S3 upload if DB update fails
-		_ = h.s3Client.DeleteFile(r.Context(), h.s3Client.GetProcessedBucket(), s3Key)
+		_ = h.store.DeleteFile(r.Context(), h.store.GetProcessedBucket(), s3Key)
 		http.Error(w, "error al actualizar", http.StatusInternalServerError)
 		return
 	}
@@ -3,6 +3,7 @@ package routers
 import (
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strconv"
 
@@ -16,6 +17,12 @@ const HeaderClass = "Content-Type"
 const HeaderJSON = "application/json"
 const TXerror = "tx error"
 
+// publicVideo is the condition on videos v for anyone to see them in the
+// gallery and the ranking, and to vote them: processed, not in the trash,
+// public and past their scheduled publish date
+const publicVideo = `v.status = 'processed' AND v.deleted_at IS NULL AND v.visibility = 'public'
+	AND (v.publish_at IS NULL OR v.publish_at <= NOW())`
+
 type PublicHandler struct{ DB *sql.DB }
 
 func NewPublicHandler(db *sql.DB) *PublicHandler { return &PublicHandler{DB: db} }
@@ -72,10 +79,10 @@ func (h *PublicHandler) ListVideos(w http.ResponseWriter, r *http.Request) {
 	}
 
 	const qsql = `
-	SELECT v.id, v.title, v.processed_url, v.thumb_url, v.votes, u.first_name, u.last_name, u.city
+	SELECT ` + publicColumns + `
 	FROM videos v
 	JOIN users u ON u.id = v.user_id
-	WHERE v.status = 'processed' AND v.processed_url IS NOT NULL
+	WHERE v.processed_url IS NOT NULL AND ` + publicVideo + `
 	ORDER BY v.votes DESC, v.id DESC
 	LIMIT $1 OFFSET $2`
 	rows, err := h.DB.Query(qsql, limit, offset)
@@ -84,30 +91,74 @@ func (h *PublicHandler) ListVideos(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	defer rows.Close()
-	type item struct {
-		VideoID      int    `json:"video_id"`
-		Title        string `json:"title"`
-		ProcessedURL string `json:"processed_url"`
-		ThumbURL     string `json:"thumb_url"`
-		Votes        int    `json:"votes"`
-		Author       string `json:"author"`
-		City         string `json:"city"`
-	}
-	var out []item
+	var out []publicItem
 	for rows.Next() {
-		var it item
-		var fn, ln string
-		if err := rows.Scan(&it.VideoID, &it.Title, &it.ProcessedURL, &it.ThumbURL, &it.Votes, &fn, &ln, &it.City); err != nil {
+		it, err := scanPublicItem(rows)
+		if err != nil {
 			http.Error(w, DBerror, http.StatusInternalServerError)
 			return
 		}
-		it.Author = fn + " " + ln
 		out = append(out, it)
 	}
 	w.Header().Set(HeaderClass, HeaderJSON)
 	json.NewEncoder(w).Encode(out)
 }
 
+// publicColumns are the columns of a video v and its author u read by
+// scanPublicItem
+const publicColumns = `v.id, v.title, v.processed_url, v.thumb_url, v.votes, u.first_name, u.last_name, u.city,
+	       COALESCE(v.hls_url,''), COALESCE(v.preview_url,''), COALESCE(v.preview_gif_url,'')`
+
+type publicItem struct {
+	VideoID      int    `json:"video_id"`
+	Title        string `json:"title"`
+	ProcessedURL string `json:"processed_url"`
+	HLSURL       string `json:"hls_url,omitempty"`
+	ThumbURL     string `json:"thumb_url"`
+	PreviewURL   string `json:"preview_url,omitempty"`
+	PreviewGIF   string `json:"preview_gif_url,omitempty"`
+	Votes        int    `json:"votes"`
+	Author       string `json:"author"`
+	City         string `json:"city"`
+}
+
+func scanPublicItem(row interface{ Scan(...any) error }) (publicItem, error) {
+	var it publicItem
+	var fn, ln string
+	err := row.Scan(&it.VideoID, &it.Title, &it.ProcessedURL, &it.ThumbURL, &it.Votes, &fn, &ln, &it.City, &it.HLSURL, &it.PreviewURL, &it.PreviewGIF)
+	it.Author = fn + " " + ln
+	return it, err
+}
+
+// GET /api/public/videos/shared/{token}
+//
+// Plays an unlisted video through its share link, with no login. Public
+// videos answer too; private ones, or videos not processed yet, are not found.
+func (h *PublicHandler) GetShared(w http.ResponseWriter, r *http.Request) {
+	token := mux.Vars(r)["token"]
+	if token == "" {
+		http.Error(w, "video no encontrado", http.StatusNotFound)
+		return
+	}
+	q := `
+	SELECT ` + publicColumns + `
+	FROM videos v
+	JOIN users u ON u.id = v.user_id
+	WHERE v.share_token = $1 AND v.processed_url IS NOT NULL
+	  AND ((v.status = 'processed' AND v.deleted_at IS NULL AND v.visibility = 'unlisted') OR (` + publicVideo + `))`
+	it, err := scanPublicItem(h.DB.QueryRow(q, token))
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "video no encontrado", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, DBerror, http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set(HeaderClass, HeaderJSON)
+	json.NewEncoder(w).Encode(it)
+}
+
 // POST /api/public/videos/{id}/vote (JWT)
 func (h *PublicHandler) Vote(w http.ResponseWriter, r *http.Request) {
 	uid, ok := middleware.UserIDFromContext(r.Context())
@@ -129,6 +180,17 @@ func (h *PublicHandler) Vote(w http.ResponseWriter, r *http.Request) {
 	}
 	defer tx.Rollback()
 
+	// only videos in the public gallery take votes
+	var exists bool
+	if err := tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM videos v WHERE v.id=$1 AND `+publicVideo+`)`, vid).Scan(&exists); err != nil {
+		http.Error(w, DBerror, http.StatusInternalServerError)
+		return
+	}
+	if !exists {
+		http.Error(w, "video no encontrado", http.StatusNotFound)
+		return
+	}
+
 	var totalUserVotes int
 	if err := tx.QueryRow(`SELECT COUNT(*) FROM votes WHERE user_id=$1`, uid).Scan(&totalUserVotes); err != nil {
 		http.Error(w, DBerror, http.StatusInternalServerError)
@@ -187,6 +249,8 @@ func (h *PublicHandler) Unvote(w http.ResponseWriter, r *http.Request) {
 	}
 	defer tx.Rollback()
 
+	// no visibility check: a vote can be retracted after the video is
+	// hidden, so it stops counting against the voter's limit
 	res, err := tx.Exec(`DELETE FROM votes WHERE video_id=$1 AND user_id=$2`, vid, uid)
 	if err != nil {
 		http.Error(w, DBerror, http.StatusInternalServerError)
@@ -220,13 +284,13 @@ func (h *PublicHandler) Rankings(w http.ResponseWriter, r *http.Request) {
 		rows, err = h.DB.Query(`
 			SELECT u.first_name, u.last_name, u.city, SUM(v.votes) as total
 			FROM videos v JOIN users u ON u.id=v.user_id
-			WHERE v.status='processed' AND u.city=$1
+			WHERE `+publicVideo+` AND u.city=$1
 			GROUP BY u.id ORDER BY total DESC`, city)
 	} else {
 		rows, err = h.DB.Query(`
 			SELECT u.first_name, u.last_name, u.city, SUM(v.votes) as total
 			FROM videos v JOIN users u ON u.id=v.user_id
-			WHERE v.status='processed'
+			WHERE ` + publicVideo + `
 			GROUP BY u.id ORDER BY total DESC`)
 	}
 	if err != nil {
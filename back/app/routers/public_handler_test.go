@@ -7,6 +7,8 @@ import (
 	"net/url"
 	"testing"
 
+	"ISIS4426-Entrega1/app/middleware"
+
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/gorilla/mux"
 )
@@ -27,9 +29,9 @@ func TestPublic_ListVideos_OK(t *testing.T) {
 
 	// Espera query con LIMIT $1 OFFSET $2
 	rows := sqlmock.NewRows([]string{
-		"id", "title", "processed_url", "thumb_url", "votes", "first_name", "last_name", "city",
-	}).AddRow(10, "Video A", "http://x/10.mp4", "http://x/10.jpg", 7, "Ana", "Gomez", "Bogotá").
-		AddRow(9, "Video B", "http://x/9.mp4", "http://x/9.jpg", 5, "Luis", "Ruiz", "Medellín")
+		"id", "title", "processed_url", "thumb_url", "votes", "first_name", "last_name", "city", "hls_url", "preview_url", "preview_gif_url",
+	}).AddRow(10, "Video A", "http://x/10.mp4", "http://x/10.jpg", 7, "Ana", "Gomez", "Bogotá", "http://x/10/hls/master.m3u8", "http://x/10/preview.mp4", "").
+		AddRow(9, "Video B", "http://x/9.mp4", "http://x/9.jpg", 5, "Luis", "Ruiz", "Medellín", "", "", "")
 
 	mock.ExpectQuery(`SELECT v\.id, v\.title, v\.processed_url, v\.thumb_url, v\.votes, u\.first_name, u\.last_name, u\.city`).
 		WithArgs(2, 1). // limit=2, offset=1
@@ -49,6 +51,15 @@ func TestPublic_ListVideos_OK(t *testing.T) {
 	if want := `"author":"Ana Gomez"`; !contains(body, want) {
 		t.Errorf("response missing %s; got %s", want, body)
 	}
+	if want := `"hls_url":"http://x/10/hls/master.m3u8"`; !contains(body, want) {
+		t.Errorf("response missing %s; got %s", want, body)
+	}
+	if want := `"preview_url":"http://x/10/preview.mp4"`; !contains(body, want) {
+		t.Errorf("response missing %s; got %s", want, body)
+	}
+	if contains(body, "preview_gif_url") {
+		t.Errorf("preview_gif_url vacío no debería aparecer; got %s", body)
+	}
 	if err := mock.ExpectationsWereMet(); err != nil {
 		t.Errorf("unmet db expectations: %v", err)
 	}
@@ -170,6 +181,62 @@ func TestPublic_Unvote_Unauthorized(t *testing.T) {
 	}
 }
 
+func TestPublic_Vote_HiddenVideo(t *testing.T) {
+	h, mock, db := newHandlerWithMockDB(t)
+	defer db.Close()
+
+	// private, unlisted or not yet published: it does not exist for voters
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT EXISTS \(SELECT 1 FROM videos v WHERE v\.id=\$1 AND v\.status = 'processed' AND v\.deleted_at IS NULL AND v\.visibility = 'public'`).
+		WithArgs(5).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+	mock.ExpectRollback()
+
+	r := mux.NewRouter()
+	r.Handle("/api/public/videos/{id}/vote", middleware.AuthRequired(http.HandlerFunc(h.Vote))).Methods(http.MethodPost)
+	req := authed(t, httptest.NewRequest(http.MethodPost, "/api/public/videos/5/vote", nil))
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusNotFound {
+		t.Fatalf("status = %d; want 404", rr.Code)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet db expectations: %v", err)
+	}
+}
+
+func TestPublic_GetShared(t *testing.T) {
+	h, mock, db := newHandlerWithMockDB(t)
+	defer db.Close()
+
+	cols := []string{"id", "title", "processed_url", "thumb_url", "votes", "first_name", "last_name", "city", "hls_url", "preview_url", "preview_gif_url"}
+	mock.ExpectQuery(`WHERE v\.share_token = \$1`).
+		WithArgs("tok123").
+		WillReturnRows(sqlmock.NewRows(cols).AddRow(10, "Video A", "http://x/10.mp4", "http://x/10.jpg", 0, "Ana", "Gomez", "Bogotá", "", "", ""))
+	mock.ExpectQuery(`WHERE v\.share_token = \$1`).
+		WithArgs("otro").
+		WillReturnRows(sqlmock.NewRows(cols))
+
+	r := mux.NewRouter()
+	r.HandleFunc("/api/public/videos/shared/{token}", h.GetShared).Methods(http.MethodGet)
+
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/public/videos/shared/tok123", nil))
+	if rr.Code != http.StatusOK || !contains(rr.Body.String(), `"author":"Ana Gomez"`) {
+		t.Errorf("status = %d, body %s", rr.Code, rr.Body.String())
+	}
+
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/public/videos/shared/otro", nil))
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("token desconocido: status = %d; want 404", rr.Code)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet db expectations: %v", err)
+	}
+}
+
 // ---------------- helpers ----------------
 
 func contains(s, sub string) bool {
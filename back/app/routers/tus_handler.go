@@ -0,0 +1,240 @@
+package routers
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+
+	"ISIS4426-Entrega1/app/middleware"
+	"ISIS4426-Entrega1/app/models"
+	"ISIS4426-Entrega1/app/repos"
+	"ISIS4426-Entrega1/app/services"
+	"ISIS4426-Entrega1/internal/media"
+
+	"github.com/gorilla/mux"
+)
+
+// tusVersion is the only version of the tus protocol we speak
+const tusVersion = "1.0.0"
+
+// TusHandler serves resumable uploads with the tus protocol (core plus the
+// creation, expiration and termination extensions), see https://tus.io.
+// There is no OPTIONS discovery: the CORS middleware answers every OPTIONS.
+type TusHandler struct {
+	uploads  *services.UploadService
+	profiles *media.Profiles
+}
+
+func NewTusHandler(uploads *services.UploadService, profiles *media.Profiles) *TusHandler {
+	return &TusHandler{uploads: uploads, profiles: profiles}
+}
+
+// tusRequest sets the protocol header of the response and checks the one of
+// the request, answering 412 when the client speaks another version.
+func tusRequest(w http.ResponseWriter, r *http.Request) bool {
+	w.Header().Set("Tus-Resumable", tusVersion)
+	if r.Header.Get("Tus-Resumable") != tusVersion {
+		w.Header().Set("Tus-Version", tusVersion)
+		http.Error(w, "versión del protocolo tus no soportada", http.StatusPreconditionFailed)
+		return false
+	}
+	return true
+}
+
+// parseUploadMetadata decodes Upload-Metadata: comma separated pairs of a
+// key and its base64 value; the value may be omitted.
+func parseUploadMetadata(h string) (map[string]string, error) {
+	meta := map[string]string{}
+	if strings.TrimSpace(h) == "" {
+		return meta, nil
+	}
+	for _, pair := range strings.Split(h, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(pair), " ")
+		if key == "" {
+			return nil, errors.New("empty metadata key")
+		}
+		if _, dup := meta[key]; dup {
+			return nil, fmt.Errorf("duplicate metadata key %q", key)
+		}
+		b, err := base64.StdEncoding.DecodeString(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("metadata %q: %w", key, err)
+		}
+		meta[key] = string(b)
+	}
+	return meta, nil
+}
+
+// setUploadHeaders describes u; once it is completed the client also gets
+// the video and the processing job.
+func setUploadHeaders(w http.ResponseWriter, u models.ResumableUpload) {
+	w.Header().Set("Upload-Offset", strconv.FormatInt(u.Offset, 10))
+	w.Header().Set("X-Video-Id", strconv.Itoa(u.VideoID))
+	if u.Completed() {
+		if u.JobID != "" {
+			w.Header().Set("X-Task-Id", u.JobID)
+		}
+		return
+	}
+	w.Header().Set("Upload-Expires", u.ExpiresAt.UTC().Format(http.TimeFormat))
+}
+
+// POST /api/videos/tus
+//
+// Creates an upload of Upload-Length bytes. Upload-Metadata carries the
+// title, filename and (optional) profile, visibility and publish_at, like a
+// direct upload.
+func (h *TusHandler) Create(w http.ResponseWriter, r *http.Request) {
+	if !tusRequest(w, r) {
+		return
+	}
+	uid, ok := middleware.UserIDFromContext(r.Context())
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	length, err := strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64)
+	if err != nil || length <= 0 {
+		http.Error(w, "Upload-Length inválido", http.StatusBadRequest)
+		return
+	}
+	if length > maxUpload {
+		http.Error(w, fmt.Sprintf("el archivo supera los %d MB", maxUpload>>20), http.StatusRequestEntityTooLarge)
+		return
+	}
+	meta, err := parseUploadMetadata(r.Header.Get("Upload-Metadata"))
+	if err != nil {
+		http.Error(w, "Upload-Metadata inválido", http.StatusBadRequest)
+		return
+	}
+	if strings.TrimSpace(meta["title"]) == "" {
+		http.Error(w, "título requerido", http.StatusBadRequest)
+		return
+	}
+	profile, err := h.profiles.Get(meta["profile"])
+	if err != nil {
+		http.Error(w, "perfil de procesamiento desconocido", http.StatusBadRequest)
+		return
+	}
+	name, ok := uploadName(meta["filename"])
+	if !ok {
+		http.Error(w, "nombre de archivo requerido", http.StatusBadRequest)
+		return
+	}
+	access := uploadAccess(meta["visibility"], meta["publish_at"])
+	if err := services.CheckAccess(access); err != nil {
+		writeAccessError(w, err)
+		return
+	}
+
+	u, err := h.uploads.Create(r.Context(), uid, meta["title"], name, profile.Name, access, length)
+	if err != nil {
+		log.Printf("[api] resumable upload: create failed user_id=%d err=%v", uid, err)
+		http.Error(w, "error al crear la subida", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("[api] resumable upload: created user_id=%d video_id=%d upload_id=%s length=%d", uid, u.VideoID, u.ID, length)
+
+	w.Header().Set("Location", path.Join(r.URL.Path, u.ID))
+	setUploadHeaders(w, u)
+	w.WriteHeader(http.StatusCreated)
+}
+
+// HEAD /api/videos/tus/{id}
+//
+// Tells the client where to resume from.
+func (h *TusHandler) Head(w http.ResponseWriter, r *http.Request) {
+	if !tusRequest(w, r) {
+		return
+	}
+	uid, ok := middleware.UserIDFromContext(r.Context())
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	u, err := h.uploads.Get(r.Context(), uid, mux.Vars(r)["id"])
+	if err != nil {
+		writeDraftError(w, err)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Upload-Length", strconv.FormatInt(u.Length, 10))
+	setUploadHeaders(w, *u)
+	w.WriteHeader(http.StatusOK)
+}
+
+// PATCH /api/videos/tus/{id}
+//
+// Appends the body at Upload-Offset. The request that brings the last byte
+// also creates the processing job, or answers 409 and drops the upload when
+// the user already has a video with the same content.
+func (h *TusHandler) Patch(w http.ResponseWriter, r *http.Request) {
+	if !tusRequest(w, r) {
+		return
+	}
+	uid, ok := middleware.UserIDFromContext(r.Context())
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if r.Header.Get("Content-Type") != "application/offset+octet-stream" {
+		http.Error(w, "Content-Type debe ser application/offset+octet-stream", http.StatusUnsupportedMediaType)
+		return
+	}
+	offset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		http.Error(w, "Upload-Offset inválido", http.StatusBadRequest)
+		return
+	}
+
+	id := mux.Vars(r)["id"]
+	u, err := h.uploads.Append(r.Context(), uid, id, offset, r.Body)
+	var dup *services.DuplicateError
+	switch {
+	case err == nil:
+	case errors.Is(err, services.ErrOffsetMismatch), errors.Is(err, repos.ErrOffsetConflict):
+		http.Error(w, "Upload-Offset no coincide con lo recibido", http.StatusConflict)
+		return
+	case errors.Is(err, repos.ErrNotFound), errors.Is(err, repos.ErrDraftExpired):
+		writeDraftError(w, err)
+		return
+	case errors.As(err, &dup):
+		log.Printf("[api] resumable upload: duplicate upload_id=%s video_id=%d", id, dup.Video.VideoID)
+		writeDuplicateError(w, dup)
+		return
+	default:
+		log.Printf("[api] resumable upload: append failed upload_id=%s offset=%d stored=%d err=%v", id, offset, u.Offset, err)
+		http.Error(w, "error al guardar el fragmento", http.StatusInternalServerError)
+		return
+	}
+	if u.Completed() && offset < u.Length {
+		log.Printf("[api] resumable upload: complete user_id=%d video_id=%d job_id=%s size=%d", uid, u.VideoID, u.JobID, u.Length)
+	}
+
+	setUploadHeaders(w, u)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// DELETE /api/videos/tus/{id}
+//
+// Cancels an upload that was not completed, with its draft video.
+func (h *TusHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	if !tusRequest(w, r) {
+		return
+	}
+	uid, ok := middleware.UserIDFromContext(r.Context())
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if err := h.uploads.Terminate(r.Context(), uid, mux.Vars(r)["id"]); err != nil {
+		writeDraftError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
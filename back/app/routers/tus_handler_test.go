@@ -0,0 +1,39 @@
+package routers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestParseUploadMetadata(t *testing.T) {
+	// title "Clavada", filename "clip.mp4", profile sin valor
+	got, err := parseUploadMetadata("title Q2xhdmFkYQ==, filename Y2xpcC5tcDQ=,profile")
+	if err != nil {
+		t.Fatalf("parseUploadMetadata error = %v", err)
+	}
+	want := map[string]string{"title": "Clavada", "filename": "clip.mp4", "profile": ""}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("metadata = %v; want %v", got, want)
+	}
+
+	for _, bad := range []string{"title no-base64!", "title Q2xhdmFkYQ==,title Q2xhdmFkYQ==", " ,title"} {
+		if _, err := parseUploadMetadata(bad); err == nil {
+			t.Errorf("parseUploadMetadata(%q) debería fallar", bad)
+		}
+	}
+}
+
+func TestTus_RejectsOtherVersions(t *testing.T) {
+	h := NewTusHandler(nil, nil)
+	req := httptest.NewRequest(http.MethodPost, "/api/videos/tus", nil)
+	req.Header.Set("Tus-Resumable", "0.2.2")
+	rr := httptest.NewRecorder()
+
+	h.Create(rr, req)
+
+	if rr.Code != http.StatusPreconditionFailed || rr.Header().Get("Tus-Version") != tusVersion {
+		t.Errorf("status = %d, Tus-Version = %q; want 412, %s", rr.Code, rr.Header().Get("Tus-Version"), tusVersion)
+	}
+}
@@ -2,38 +2,84 @@ package routers
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"hash"
+	"io"
 	"log"
 	"net/http"
-	"path/filepath"
+	"path"
+	"slices"
 	"strconv"
+	"strings"
 	"time"
 
 	"ISIS4426-Entrega1/app/middleware"
 	"ISIS4426-Entrega1/app/models"
 	"ISIS4426-Entrega1/app/repos"
 	"ISIS4426-Entrega1/app/services"
-	"ISIS4426-Entrega1/internal/s3client"
+	"ISIS4426-Entrega1/internal/media"
+	"ISIS4426-Entrega1/internal/storage"
 
+	"github.com/google/uuid"
 	"github.com/gorilla/mux"
 )
 
-type Enqueuer interface {
-	EnqueueVideoProcessing(ctx context.Context, videoID, userID int, title, s3Key string) (string, error)
-}
-
 type VideosHandler struct {
-	enqueuer Enqueuer
 	svc      *services.VideoService
-	s3Client *s3client.S3Client
+	store    storage.Storage
+	rules    *media.Rules // nil skips upload validation (ffprobe unavailable)
+	profiles *media.Profiles
+	draftTTL time.Duration // how long a direct upload stays open
+
+	trashRetention time.Duration // how long a deleted video can be restored
+}
+
+func NewVideosHandler(s *services.VideoService, store storage.Storage, rules *media.Rules, profiles *media.Profiles, draftTTL, trashRetention time.Duration) *VideosHandler {
+	return &VideosHandler{svc: s, store: store, rules: rules, profiles: profiles, draftTTL: draftTTL, trashRetention: trashRetention}
 }
 
-func NewVideosHandler(enq Enqueuer, s *services.VideoService, s3 *s3client.S3Client) *VideosHandler {
-	return &VideosHandler{enqueuer: enq, svc: s, s3Client: s3}
+const maxUpload = 100 << 20 // 100MB
+
+// maxField bounds the text fields of the upload form
+const maxField = 4 << 10
+
+// digestReader measures and hashes what is read through it, and keeps the
+// first read error so it can be told apart from storage errors
+type digestReader struct {
+	r    io.Reader
+	size int64
+	hash hash.Hash
+	err  error
 }
 
+func newDigestReader(r io.Reader) *digestReader {
+	return &digestReader{r: r, hash: sha256.New()}
+}
+
+func (d *digestReader) Read(p []byte) (int, error) {
+	n, err := d.r.Read(p)
+	d.size += int64(n)
+	d.hash.Write(p[:n])
+	if err != nil && err != io.EOF && d.err == nil {
+		d.err = err
+	}
+	return n, err
+}
+
+func (d *digestReader) sha256() string { return hex.EncodeToString(d.hash.Sum(nil)) }
+
+// POST /api/videos
+//
+// Multipart upload through the API. The form is read as a stream: the file
+// part goes straight to the uploads bucket while its size and SHA-256 are
+// computed, so nothing is buffered whole in memory or on disk. Fields may
+// come in any order; with rules set, the stored object is probed afterwards
+// and deleted if rejected. The optional visibility and publish_at fields work
+// like in Update; the video is private by default.
 func (h *VideosHandler) Create(w http.ResponseWriter, r *http.Request) {
 	uid, ok := middleware.UserIDFromContext(r.Context())
 	if !ok {
@@ -42,81 +88,438 @@ func (h *VideosHandler) Create(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	const maxUpload = 100 << 20 // 100MB
-	r.Body = http.MaxBytesReader(w, r.Body, maxUpload)
-	if err := r.ParseMultipartForm(32 << 20); err != nil {
-		http.Error(w, "multipart parse error", http.StatusBadRequest)
+	up, ok := h.receiveUpload(w, r, uid, "title", "profile", "visibility", "publish_at")
+	if !ok {
+		return
+	}
+	title := up.fields["title"]
+	if strings.TrimSpace(title) == "" {
+		h.discard(r, up)
+		http.Error(w, "título requerido", http.StatusBadRequest)
+		return
+	}
+	profile, err := h.profiles.Get(up.fields["profile"])
+	if err != nil {
+		h.discard(r, up)
+		http.Error(w, "perfil de procesamiento desconocido", http.StatusBadRequest)
+		return
+	}
+	access := uploadAccess(up.fields["visibility"], up.fields["publish_at"])
+	if err := services.CheckAccess(access); err != nil {
+		h.discard(r, up)
+		writeAccessError(w, err)
+		return
+	}
+	if !h.checkUpload(w, r, uid, up) {
+		return
+	}
+	// Create registro en DB y trabajo de procesamiento en una sola transacción (outbox)
+	created, jobID, err := h.svc.CreateWithJob(r.Context(), uid, title, up.key, profile.Name, up.file.sha256(), access)
+	var dup *services.DuplicateError
+	if errors.As(err, &dup) {
+		log.Printf("[api] upload: duplicate user_id=%d sha256=%s video_id=%d", uid, up.file.sha256(), dup.Video.VideoID)
+		h.discard(r, up)
+		writeDuplicateError(w, dup)
 		return
 	}
+	if err != nil {
+		// If DB creation fails, clean up S3 upload
+		log.Printf("[api] upload: db create failed user_id=%d s3_key=%q err=%v", uid, up.key, err)
+		h.discard(r, up)
+		http.Error(w, "error al crear registro", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("[api] upload: db create ok user_id=%d video_id=%d job_id=%s", uid, created.VideoID, jobID)
 
-	title := r.FormValue("title")
-	f, hdr, err := r.FormFile("video_file")
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(map[string]string{
+		"message": "Video subido correctamente. Procesamiento en curso.",
+		"task_id": jobID,
+	})
+}
+
+// receivedUpload is a multipart upload form whose file was streamed to the
+// uploads bucket
+type receivedUpload struct {
+	fields map[string]string
+	key    string        // empty when the form had no file
+	file   *digestReader // size and SHA-256 of the stored file
+}
+
+// receiveUpload reads the upload form of r as a stream: the video_file part
+// goes straight to the uploads bucket under a new key of userID while its
+// size and SHA-256 are computed, and the text fields named are kept. Fields
+// may come in any order. On failure it answers the request, leaves nothing
+// stored and returns false; afterwards the caller discards the object if it
+// rejects the upload.
+func (h *VideosHandler) receiveUpload(w http.ResponseWriter, r *http.Request, userID int, names ...string) (*receivedUpload, bool) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxUpload)
+	mr, err := r.MultipartReader()
 	if err != nil {
+		http.Error(w, "multipart parse error", http.StatusBadRequest)
+		return nil, false
+	}
+
+	up := &receivedUpload{fields: map[string]string{}}
+	bucket := h.store.GetUploadsBucket()
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			h.discard(r, up)
+			writeUploadReadError(w, err)
+			return nil, false
+		}
+		name := part.FormName()
+		switch {
+		case name == "video_file":
+			if up.key != "" {
+				h.discard(r, up)
+				http.Error(w, "se permite un solo archivo", http.StatusBadRequest)
+				return nil, false
+			}
+			// Each upload gets its own key: two files with the same name must
+			// not overwrite each other
+			fname, ok := uploadName(part.FileName())
+			if !ok {
+				fname = "video"
+			}
+			up.key = fmt.Sprintf("videos/%d/%s/%s", userID, uuid.New().String(), fname)
+			log.Printf("[api] upload: start user_id=%d s3_key=%q", userID, up.key)
+			up.file = newDigestReader(part)
+			if err := h.store.UploadStream(r.Context(), up.key, bucket, up.file); err != nil {
+				log.Printf("[api] upload: s3 upload failed user_id=%d s3_key=%q size=%d err=%v", userID, up.key, up.file.size, err)
+				h.discard(r, up)
+				if up.file.err != nil {
+					writeUploadReadError(w, up.file.err)
+				} else {
+					http.Error(w, "cannot upload to S3", http.StatusInternalServerError)
+				}
+				return nil, false
+			}
+			log.Printf("[api] upload: s3 upload ok user_id=%d s3_key=%q size=%d sha256=%s", userID, up.key, up.file.size, up.file.sha256())
+		case slices.Contains(names, name):
+			b, err := io.ReadAll(io.LimitReader(part, maxField))
+			if err != nil {
+				h.discard(r, up)
+				writeUploadReadError(w, err)
+				return nil, false
+			}
+			up.fields[name] = string(b)
+		}
+		part.Close()
+	}
+	return up, true
+}
+
+// discard removes the stored file of up, if any, even when r was cancelled
+func (h *VideosHandler) discard(r *http.Request, up *receivedUpload) {
+	if up.key != "" {
+		_ = h.store.DeleteFile(context.WithoutCancel(r.Context()), h.store.GetUploadsBucket(), up.key)
+	}
+}
+
+// checkUpload checks that the form had a non-empty file and, with rules set,
+// probes the stored object. A rejected upload is discarded and answered.
+func (h *VideosHandler) checkUpload(w http.ResponseWriter, r *http.Request, userID int, up *receivedUpload) bool {
+	if up.file == nil {
 		http.Error(w, "archivo faltante", http.StatusBadRequest)
+		return false
+	}
+	if up.file.size == 0 {
+		h.discard(r, up)
+		writeValidationError(w, &media.ValidationError{
+			Code:    media.CodeFileSize,
+			Message: fmt.Sprintf("el archivo debe pesar entre 1 byte y %d MB", maxUpload>>20),
+		})
+		return false
+	}
+	if h.rules == nil {
+		return true
+	}
+
+	// ffprobe reads the stored object through a short-lived URL
+	var info *media.Info
+	url, err := h.store.GeneratePresignedURL(r.Context(), h.store.GetUploadsBucket(), up.key, 5*time.Minute)
+	if err == nil {
+		info, err = media.Probe(r.Context(), url)
+	}
+	if err == nil {
+		err = h.rules.Validate(info)
+	}
+	var verr *media.ValidationError
+	if errors.As(err, &verr) {
+		log.Printf("[api] upload: rejected user_id=%d code=%s detail=%q", userID, verr.Code, verr.Detail)
+		h.discard(r, up)
+		writeValidationError(w, verr)
+		return false
+	}
+	if err != nil {
+		log.Printf("[api] upload: probe failed user_id=%d err=%v", userID, err)
+		h.discard(r, up)
+		http.Error(w, "no se pudo analizar el video", http.StatusInternalServerError)
+		return false
+	}
+	return true
+}
+
+// writeUploadReadError answers a failure while reading the upload form: 422
+// when the body went over maxUpload, 400 when it was malformed or cut short.
+func writeUploadReadError(w http.ResponseWriter, err error) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		writeValidationError(w, &media.ValidationError{
+			Code:    media.CodeFileSize,
+			Message: fmt.Sprintf("el archivo debe pesar entre 1 byte y %d MB", maxUpload>>20),
+		})
 		return
 	}
-	defer f.Close()
+	http.Error(w, "multipart parse error", http.StatusBadRequest)
+}
 
-	// Generate S3 key for the uploaded file
-	s3Key := fmt.Sprintf("videos/%d/%s", uid, filepath.Base(hdr.Filename))
+// uploadAccess builds the access fields of an upload from its optional
+// visibility and publish_at values; empty ones keep the defaults
+func uploadAccess(visibility, publishAt string) models.VideoPatch {
+	var p models.VideoPatch
+	if visibility != "" {
+		vis := models.Visibility(visibility)
+		p.Visibility = &vis
+	}
+	if publishAt != "" {
+		p.PublishAt = &publishAt
+	}
+	return p
+}
 
-	log.Printf("[api] upload: start user_id=%d title=%q", uid, title)
+// writeAccessError answers an invalid visibility or publish_at, checked by
+// services.CheckAccess or UpdateFor
+func writeAccessError(w http.ResponseWriter, err error) {
+	if errors.Is(err, services.ErrInvalidPublishAt) {
+		http.Error(w, "publish_at debe ser una fecha RFC 3339", http.StatusBadRequest)
+		return
+	}
+	http.Error(w, "visibilidad inválida: public, unlisted o private", http.StatusBadRequest)
+}
 
-	// Upload directly to S3 uploads bucket
-	if err := h.s3Client.UploadToUploads(r.Context(), s3Key, f); err != nil {
-		log.Printf("[api] upload: s3 upload failed user_id=%d s3_key=%q err=%v", uid, s3Key, err)
-		http.Error(w, "cannot upload to S3", http.StatusInternalServerError)
+// POST /api/videos/uploads
+//
+// First step of a direct upload: creates a draft and returns a presigned PUT
+// URL for the uploads bucket, so the file never goes through the API. The
+// optional visibility and publish_at work like in Create.
+func (h *VideosHandler) CreateUpload(w http.ResponseWriter, r *http.Request) {
+	uid, ok := middleware.UserIDFromContext(r.Context())
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	var req struct {
+		Title      string `json:"title"`
+		Profile    string `json:"profile"`
+		Filename   string `json:"filename"`
+		Visibility string `json:"visibility"`
+		PublishAt  string `json:"publish_at"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "JSON inválido", http.StatusBadRequest)
+		return
+	}
+	if strings.TrimSpace(req.Title) == "" {
+		http.Error(w, "título requerido", http.StatusBadRequest)
+		return
+	}
+	profile, err := h.profiles.Get(req.Profile)
+	if err != nil {
+		http.Error(w, "perfil de procesamiento desconocido", http.StatusBadRequest)
+		return
+	}
+	name, ok := uploadName(req.Filename)
+	if !ok {
+		http.Error(w, "nombre de archivo requerido", http.StatusBadRequest)
+		return
+	}
+	access := uploadAccess(req.Visibility, req.PublishAt)
+	if err := services.CheckAccess(access); err != nil {
+		writeAccessError(w, err)
 		return
 	}
-	log.Printf("[api] upload: s3 upload ok user_id=%d s3_key=%q", uid, s3Key)
 
-	// Create registro en DB with S3 key instead of local path
-	created, err := h.svc.Create(uid, title, s3Key)
+	// a random segment keeps drafts with the same file name apart
+	s3Key := fmt.Sprintf("videos/%d/%s/%s", uid, uuid.New().String(), name)
+	draft, expiresAt, err := h.svc.CreateDraft(r.Context(), uid, req.Title, s3Key, profile.Name, access, h.draftTTL)
 	if err != nil {
-		// If DB creation fails, clean up S3 upload
-		log.Printf("[api] upload: db create failed user_id=%d s3_key=%q err=%v", uid, s3Key, err)
-		_ = h.s3Client.DeleteFile(r.Context(), h.s3Client.GetUploadsBucket(), s3Key)
+		log.Printf("[api] upload draft: db create failed user_id=%d err=%v", uid, err)
 		http.Error(w, "error al crear registro", http.StatusInternalServerError)
 		return
 	}
-	log.Printf("[api] upload: db create ok user_id=%d video_id=%d", uid, created.VideoID)
-
-	// Encolar trabajo with S3 key
-	jobID, err := h.enqueuer.EnqueueVideoProcessing(r.Context(), created.VideoID, uid, title, s3Key)
+	uploadURL, err := h.store.GenerateUploadPresignedURL(r.Context(), h.store.GetUploadsBucket(), s3Key, h.draftTTL)
 	if err != nil {
-		log.Printf("[api] upload: enqueue failed user_id=%d video_id=%d s3_key=%q err=%v", uid, created.VideoID, s3Key, err)
-		http.Error(w, "queue error", http.StatusInternalServerError)
+		log.Printf("[api] upload draft: presign failed video_id=%d err=%v", draft.VideoID, err)
+		http.Error(w, "no se pudo generar la URL de subida", http.StatusInternalServerError)
 		return
 	}
-	log.Printf("[api] upload: enqueue ok user_id=%d video_id=%d job_id=%s", uid, created.VideoID, jobID)
+	log.Printf("[api] upload draft: created user_id=%d video_id=%d s3_key=%q", uid, draft.VideoID, s3Key)
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"video_id":   strconv.Itoa(draft.VideoID),
+		"upload_url": uploadURL,
+		"method":     http.MethodPut,
+		"max_bytes":  maxUpload,
+		"expires_at": expiresAt.UTC().Format(time.RFC3339),
+	})
+}
+
+// uploadName is the base name of a client file name, from any platform
+func uploadName(filename string) (string, bool) {
+	name := path.Base(strings.ReplaceAll(filename, "\\", "/"))
+	if strings.TrimSpace(filename) == "" || name == "." || name == "/" || name == ".." {
+		return "", false
+	}
+	return name, true
+}
+
+// POST /api/videos/uploads/{id}/complete
+//
+// Second step of a direct upload: checks that the object was uploaded with a
+// sane size and creates the processing job. The content itself is validated
+// by the worker probe stage.
+func (h *VideosHandler) CompleteUpload(w http.ResponseWriter, r *http.Request) {
+	uid, ok := middleware.UserIDFromContext(r.Context())
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil || id <= 0 {
+		http.Error(w, "id inválido", http.StatusBadRequest)
+		return
+	}
+
+	draft, err := h.svc.GetDraft(r.Context(), uid, id)
+	if err != nil {
+		writeDraftError(w, err)
+		return
+	}
+	size, err := h.store.ObjectSize(r.Context(), h.store.GetUploadsBucket(), draft.OriginURL)
+	if storage.IsNotFound(err) {
+		http.Error(w, "el archivo aún no fue subido", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Printf("[api] upload complete: stat failed video_id=%d err=%v", id, err)
+		http.Error(w, "no se pudo verificar el archivo", http.StatusInternalServerError)
+		return
+	}
+	if size <= 0 || size > maxUpload {
+		log.Printf("[api] upload complete: rejected video_id=%d size=%d", id, size)
+		writeValidationError(w, &media.ValidationError{
+			Code:    media.CodeFileSize,
+			Message: fmt.Sprintf("el archivo debe pesar entre 1 byte y %d MB", maxUpload>>20),
+		})
+		return
+	}
+
+	// the file did not go through the API: the worker hashes it
+	_, jobID, err := h.svc.CompleteDraft(r.Context(), uid, id, "")
+	if err != nil {
+		writeDraftError(w, err)
+		return
+	}
+	log.Printf("[api] upload complete: ok user_id=%d video_id=%d job_id=%s size=%d", uid, id, jobID, size)
+
+	w.Header().Set("Content-Type", "application/json")
 	_ = json.NewEncoder(w).Encode(map[string]string{
 		"message": "Video subido correctamente. Procesamiento en curso.",
 		"task_id": jobID,
 	})
 }
 
+// writeDraftError maps the draft lookup errors to their status
+func writeDraftError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, repos.ErrNotFound):
+		http.Error(w, "subida no encontrada", http.StatusNotFound)
+	case errors.Is(err, repos.ErrNotDraft):
+		http.Error(w, "la subida ya fue completada", http.StatusConflict)
+	case errors.Is(err, repos.ErrDraftExpired):
+		http.Error(w, "la subida expiró, iníciela de nuevo", http.StatusGone)
+	default:
+		log.Printf("[api] upload draft error: %v", err)
+		http.Error(w, "error al consultar la subida", http.StatusInternalServerError)
+	}
+}
+
+// writeDuplicateError answers 409 with the video that already has the content
+func writeDuplicateError(w http.ResponseWriter, dup *services.DuplicateError) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusConflict)
+	_ = json.NewEncoder(w).Encode(map[string]string{
+		"code":     "duplicate_video",
+		"message":  "ya subiste este mismo video",
+		"video_id": strconv.Itoa(dup.Video.VideoID),
+		"status":   string(dup.Video.Status),
+	})
+}
+
+// writeValidationError answers 422 with the machine-readable rejection code
+func writeValidationError(w http.ResponseWriter, verr *media.ValidationError) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusUnprocessableEntity)
+	_ = json.NewEncoder(w).Encode(map[string]string{
+		"code":    verr.Code,
+		"message": verr.Message,
+	})
+}
+
+// actorFrom is the authenticated user of r, as seen by the video policy
+func actorFrom(r *http.Request) (services.Actor, bool) {
+	uid, ok := middleware.UserIDFromContext(r.Context())
+	return services.Actor{UserID: uid, Admin: middleware.RoleFromContext(r.Context()) == models.RoleAdmin}, ok
+}
+
+// writeVideoError maps the video lookup and policy errors to their status
+func writeVideoError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, repos.ErrNotFound):
+		http.Error(w, "video no encontrado", http.StatusNotFound)
+	case errors.Is(err, services.ErrForbidden):
+		http.Error(w, "no tienes permiso sobre este video", http.StatusForbidden)
+	default:
+		log.Printf("[api] video error: %v", err)
+		http.Error(w, "error al consultar el video", http.StatusInternalServerError)
+	}
+}
+
+// GET /api/videos
+//
+// Lists the videos of the user; admins may pass user_id, or omit it to list
+// every user's videos.
 func (h *VideosHandler) List(w http.ResponseWriter, r *http.Request) {
+	actor, ok := actorFrom(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
 	q := r.URL.Query()
 	limit, _ := strconv.Atoi(q.Get("limit"))
 	offset, _ := strconv.Atoi(q.Get("offset"))
-	userIDStr := q.Get("user_id")
-
-	var (
-		items []models.Video
-		err   error
-	)
-	if userIDStr != "" {
-		uid, convErr := strconv.Atoi(userIDStr)
-		if convErr != nil {
+	userID := 0
+	if s := q.Get("user_id"); s != "" {
+		var err error
+		if userID, err = strconv.Atoi(s); err != nil || userID <= 0 {
 			http.Error(w, "user_id inválido", http.StatusBadRequest)
 			return
 		}
-		items, err = h.svc.ListByUser(r.Context(), uid, limit, offset)
-	} else {
-		items, err = h.svc.List(r.Context(), limit, offset)
+	}
+
+	items, err := h.svc.ListFor(r.Context(), actor, userID, limit, offset)
+	if errors.Is(err, services.ErrForbidden) {
+		http.Error(w, "no puedes listar los videos de otro usuario", http.StatusForbidden)
+		return
 	}
 	if err != nil {
 		http.Error(w, "Error al consultar videos", http.StatusInternalServerError)
@@ -127,6 +530,7 @@ func (h *VideosHandler) List(w http.ResponseWriter, r *http.Request) {
 		VideoID      string `json:"video_id"`
 		Title        string `json:"title"`
 		Status       string `json:"status"`
+		Visibility   string `json:"visibility"`
 		UploadedAt   string `json:"uploaded_at"`
 		ProcessedAt  string `json:"processed_at,omitempty"`
 		ProcessedURL string `json:"processed_url,omitempty"`
@@ -137,6 +541,7 @@ func (h *VideosHandler) List(w http.ResponseWriter, r *http.Request) {
 			VideoID:    strconv.Itoa(it.VideoID),
 			Title:      it.Title,
 			Status:     string(it.Status),
+			Visibility: string(it.Visibility),
 			UploadedAt: it.UploadedAt.Format(time.RFC3339),
 		}
 		if !it.ProcessedAt.IsZero() {
@@ -152,25 +557,31 @@ func (h *VideosHandler) List(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *VideosHandler) GetByID(w http.ResponseWriter, r *http.Request) {
+	actor, ok := actorFrom(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
 	idStr := mux.Vars(r)["id"]
 	id, err := strconv.Atoi(idStr)
 	if err != nil || id <= 0 {
 		http.Error(w, "id inválido", http.StatusBadRequest)
 		return
 	}
-	v, err := h.svc.GetByID(r.Context(), id)
+	v, err := h.svc.GetFor(r.Context(), actor, id)
 	if err != nil {
-		if errors.Is(err, repos.ErrNotFound) {
-			http.Error(w, "video no encontrado", http.StatusNotFound)
-			return
-		}
-		http.Error(w, "video no encontrado", http.StatusNotFound)
+		writeVideoError(w, err)
 		return
 	}
 	_ = json.NewEncoder(w).Encode(v)
 }
 
 func (h *VideosHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	actor, ok := actorFrom(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
 	idStr := mux.Vars(r)["id"]
 	if idStr == "" {
 		idStr = r.URL.Query().Get("id")
@@ -181,11 +592,334 @@ func (h *VideosHandler) Delete(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := h.svc.Delete(r.Context(), id); err != nil {
+	if err := h.svc.DeleteFor(r.Context(), actor, id); err != nil {
+		if errors.Is(err, repos.ErrNotFound) || errors.Is(err, services.ErrForbidden) {
+			writeVideoError(w, err)
+			return
+		}
+		if errors.Is(err, repos.ErrInContest) {
+			http.Error(w, "el video participa en un concurso activo y no se puede eliminar", http.StatusConflict)
+			return
+		}
+		log.Printf("[api] delete video_id=%d failed: %v", id, err)
 		http.Error(w, "error al eliminar video", http.StatusInternalServerError)
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
-	_ = json.NewEncoder(w).Encode(map[string]string{"message": "El video ha sido eliminado exitosamente.", "video_id": idStr})
+	_ = json.NewEncoder(w).Encode(map[string]string{
+		"message":          "El video ha sido eliminado exitosamente.",
+		"video_id":         idStr,
+		"restorable_until": time.Now().Add(h.trashRetention).UTC().Format(time.RFC3339),
+	})
+}
+
+// GET /api/videos/trash
+//
+// Lists the deleted videos of the user, with the deadline to restore them.
+func (h *VideosHandler) Trash(w http.ResponseWriter, r *http.Request) {
+	actor, ok := actorFrom(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+	items, err := h.svc.TrashFor(r.Context(), actor, limit, offset)
+	if err != nil {
+		log.Printf("[api] trash list failed user_id=%d: %v", actor.UserID, err)
+		http.Error(w, "Error al consultar videos", http.StatusInternalServerError)
+		return
+	}
+
+	type respItem struct {
+		VideoID         string `json:"video_id"`
+		Title           string `json:"title"`
+		Status          string `json:"status"`
+		Votes           int    `json:"votes"`
+		DeletedAt       string `json:"deleted_at"`
+		RestorableUntil string `json:"restorable_until"`
+	}
+	out := make([]respItem, 0, len(items))
+	for _, it := range items {
+		out = append(out, respItem{
+			VideoID:         strconv.Itoa(it.VideoID),
+			Title:           it.Title,
+			Status:          string(it.Status),
+			Votes:           it.Votes,
+			DeletedAt:       it.DeletedAt.UTC().Format(time.RFC3339),
+			RestorableUntil: it.DeletedAt.Add(h.trashRetention).UTC().Format(time.RFC3339),
+		})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(out)
+}
+
+// POST /api/videos/{id}/restore
+//
+// Takes a deleted video out of the trash, with its votes.
+func (h *VideosHandler) Restore(w http.ResponseWriter, r *http.Request) {
+	actor, ok := actorFrom(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil || id <= 0 {
+		http.Error(w, "id inválido", http.StatusBadRequest)
+		return
+	}
+	v, err := h.svc.RestoreFor(r.Context(), actor, id, h.trashRetention)
+	var dup *services.DuplicateError
+	switch {
+	case err == nil:
+	case errors.As(err, &dup):
+		writeDuplicateError(w, dup)
+		return
+	case errors.Is(err, services.ErrNotInTrash):
+		http.Error(w, "el video no está en la papelera", http.StatusConflict)
+		return
+	case errors.Is(err, services.ErrTrashExpired):
+		http.Error(w, "el plazo para restaurar el video venció", http.StatusGone)
+		return
+	default:
+		writeVideoError(w, err)
+		return
+	}
+	log.Printf("[api] restore ok user_id=%d video_id=%d", actor.UserID, id)
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// PATCH /api/videos/{id}
+//
+// Changes the title, description, tags, visibility or scheduled publish date
+// of a video; the fields left out of the JSON body keep their value. The
+// response carries the share token of an unlisted video.
+func (h *VideosHandler) Update(w http.ResponseWriter, r *http.Request) {
+	actor, ok := actorFrom(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil || id <= 0 {
+		http.Error(w, "id inválido", http.StatusBadRequest)
+		return
+	}
+	var patch models.VideoPatch
+	if err := json.NewDecoder(io.LimitReader(r.Body, 64<<10)).Decode(&patch); err != nil {
+		http.Error(w, "JSON inválido", http.StatusBadRequest)
+		return
+	}
+
+	v, err := h.svc.UpdateFor(r.Context(), actor, id, patch)
+	switch {
+	case err == nil:
+	case errors.Is(err, services.ErrInvalidTitle):
+		http.Error(w, "título requerido", http.StatusBadRequest)
+		return
+	case errors.Is(err, services.ErrTitleTooLong):
+		http.Error(w, "el título es demasiado largo", http.StatusBadRequest)
+		return
+	case errors.Is(err, services.ErrInvalidDescription):
+		http.Error(w, "la descripción es demasiado larga", http.StatusBadRequest)
+		return
+	case errors.Is(err, services.ErrInvalidTags):
+		http.Error(w, "máximo 10 etiquetas de hasta 30 caracteres", http.StatusBadRequest)
+		return
+	case errors.Is(err, services.ErrInvalidVisibility), errors.Is(err, services.ErrInvalidPublishAt):
+		writeAccessError(w, err)
+		return
+	default:
+		writeVideoError(w, err)
+		return
+	}
+	log.Printf("[api] update ok user_id=%d video_id=%d", actor.UserID, id)
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// PUT /api/videos/{id}/source
+//
+// Replaces the clip of a video with the video_file of a multipart form,
+// streamed like in Create, and processes it again under the same id. The
+// optional profile field changes the processing profile; keep_votes=false
+// resets the votes, which are kept by default. Only videos whose processing
+// finished can be replaced.
+func (h *VideosHandler) ReplaceSource(w http.ResponseWriter, r *http.Request) {
+	actor, ok := actorFrom(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil || id <= 0 {
+		http.Error(w, "id inválido", http.StatusBadRequest)
+		return
+	}
+	// fail before receiving the file when it cannot be used
+	v, err := h.svc.GetFor(r.Context(), actor, id)
+	if err != nil {
+		writeVideoError(w, err)
+		return
+	}
+	if v.Status != models.StatusProcessed && v.Status != models.StatusFailed {
+		http.Error(w, "el video aún se está procesando", http.StatusConflict)
+		return
+	}
+
+	// the new clip is stored under the owner, also when an admin replaces it
+	up, ok := h.receiveUpload(w, r, v.UserID, "profile", "keep_votes")
+	if !ok {
+		return
+	}
+	profile := ""
+	if name := up.fields["profile"]; name != "" {
+		p, err := h.profiles.Get(name)
+		if err != nil {
+			h.discard(r, up)
+			http.Error(w, "perfil de procesamiento desconocido", http.StatusBadRequest)
+			return
+		}
+		profile = p.Name
+	}
+	keepVotes := true
+	if s := up.fields["keep_votes"]; s != "" {
+		if keepVotes, err = strconv.ParseBool(s); err != nil {
+			h.discard(r, up)
+			http.Error(w, "keep_votes inválido", http.StatusBadRequest)
+			return
+		}
+	}
+	if !h.checkUpload(w, r, v.UserID, up) {
+		return
+	}
+
+	updated, jobID, err := h.svc.ReplaceSourceFor(r.Context(), actor, id, up.key, profile, up.file.sha256(), keepVotes)
+	var dup *services.DuplicateError
+	switch {
+	case err == nil:
+	case errors.As(err, &dup):
+		log.Printf("[api] replace source: duplicate video_id=%d of video_id=%d", id, dup.Video.VideoID)
+		h.discard(r, up)
+		writeDuplicateError(w, dup)
+		return
+	case errors.Is(err, repos.ErrProcessing):
+		h.discard(r, up)
+		http.Error(w, "el video aún se está procesando", http.StatusConflict)
+		return
+	default:
+		h.discard(r, up)
+		writeVideoError(w, err)
+		return
+	}
+	log.Printf("[api] replace source ok user_id=%d video_id=%d job_id=%s keep_votes=%t", actor.UserID, id, jobID, keepVotes)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"message":  "Video reemplazado. Procesamiento en curso.",
+		"video_id": strconv.Itoa(updated.VideoID),
+		"task_id":  jobID,
+		"votes":    updated.Votes,
+	})
+}
+
+// POST /api/videos/{id}/reprocess
+//
+// Runs the processing again from the stored original, e.g. after changing
+// the bumpers. A processed video stays online with its current outputs until
+// the new ones are published.
+func (h *VideosHandler) Reprocess(w http.ResponseWriter, r *http.Request) {
+	actor, ok := actorFrom(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil || id <= 0 {
+		http.Error(w, "id inválido", http.StatusBadRequest)
+		return
+	}
+	_, jobID, err := h.svc.ReprocessFor(r.Context(), actor, id)
+	if errors.Is(err, repos.ErrProcessing) {
+		http.Error(w, "el video aún se está procesando", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		writeVideoError(w, err)
+		return
+	}
+	log.Printf("[api] reprocess queued user_id=%d video_id=%d job_id=%s", actor.UserID, id, jobID)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	_ = json.NewEncoder(w).Encode(map[string]string{
+		"message":  "Reprocesamiento en cola.",
+		"video_id": strconv.Itoa(id),
+		"task_id":  jobID,
+	})
+}
+
+// POST /api/videos/reprocess (admin)
+//
+// Queues a reprocessing of every video matching the JSON filters: status
+// (processed or failed), from/to (RFC 3339, on the upload date), profile and
+// limit (100 by default, at most 500). Videos with a job in progress are
+// skipped.
+func (h *VideosHandler) ReprocessBulk(w http.ResponseWriter, r *http.Request) {
+	actor, ok := actorFrom(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	var f models.ReprocessFilter
+	if err := json.NewDecoder(io.LimitReader(r.Body, maxField)).Decode(&f); err != nil {
+		http.Error(w, "JSON inválido", http.StatusBadRequest)
+		return
+	}
+	if f.Profile != "" {
+		if _, err := h.profiles.Get(f.Profile); err != nil {
+			http.Error(w, "perfil de procesamiento desconocido", http.StatusBadRequest)
+			return
+		}
+	}
+
+	res, err := h.svc.ReprocessBulk(r.Context(), actor, f)
+	switch {
+	case err == nil:
+	case errors.Is(err, services.ErrForbidden):
+		http.Error(w, "solo un administrador puede reprocesar en bloque", http.StatusForbidden)
+		return
+	case errors.Is(err, services.ErrInvalidFilter):
+		http.Error(w, "filtro inválido: status debe ser processed o failed y from anterior a to", http.StatusBadRequest)
+		return
+	default:
+		// the jobs queued before the error stay queued
+		log.Printf("[api] bulk reprocess failed after %d job(s): %v", len(res.Jobs), err)
+		http.Error(w, "error al reprocesar videos", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("[api] bulk reprocess user_id=%d queued=%d skipped=%d", actor.UserID, len(res.Jobs), len(res.Skipped))
+
+	type jobItem struct {
+		VideoID string `json:"video_id"`
+		TaskID  string `json:"task_id"`
+	}
+	jobs := make([]jobItem, 0, len(res.Jobs))
+	for _, j := range res.Jobs {
+		jobs = append(jobs, jobItem{VideoID: strconv.Itoa(j.VideoID), TaskID: j.JobID})
+	}
+	skipped := make([]string, 0, len(res.Skipped))
+	for _, id := range res.Skipped {
+		skipped = append(skipped, strconv.Itoa(id))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"queued":  len(jobs),
+		"jobs":    jobs,
+		"skipped": skipped,
+	})
 }
@@ -0,0 +1,252 @@
+package routers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"database/sql/driver"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/fs"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"ISIS4426-Entrega1/app/middleware"
+	"ISIS4426-Entrega1/app/repos"
+	"ISIS4426-Entrega1/app/services"
+	"ISIS4426-Entrega1/internal/media"
+	"ISIS4426-Entrega1/internal/storage"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/mux"
+)
+
+// newVideosHandlerForTest returns the handler, its database mock and the
+// directory of its local uploads bucket
+func newVideosHandlerForTest(t *testing.T) (*VideosHandler, sqlmock.Sqlmock, string) {
+	t.Helper()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	root := t.TempDir()
+	store, err := storage.NewLocal(root, "http://api/files", "secret")
+	if err != nil {
+		t.Fatalf("NewLocal: %v", err)
+	}
+	svc := services.NewVideoService(repos.NewVideoRepoPG(db), store)
+	return NewVideosHandler(svc, store, nil, media.DefaultProfiles(), time.Hour, 24*time.Hour), mock, filepath.Join(root, storage.LocalUploadsBucket)
+}
+
+// storedObjects maps the key of each object under dir to its content
+func storedObjects(t *testing.T, dir string) map[string]string {
+	t.Helper()
+	out := map[string]string{}
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		b, err := os.ReadFile(p)
+		rel, _ := filepath.Rel(dir, p)
+		out[filepath.ToSlash(rel)] = string(b)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("listar objetos: %v", err)
+	}
+	return out
+}
+
+// uploadRequest builds a multipart POST /api/videos of user 7 with the file
+// part first, before the text fields
+func uploadRequest(t *testing.T, file string, fields map[string]string) *http.Request {
+	t.Helper()
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	fw, _ := mw.CreateFormFile("video_file", "clip.mp4")
+	_, _ = io.WriteString(fw, file)
+	for k, v := range fields {
+		_ = mw.WriteField(k, v)
+	}
+	mw.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/videos", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	return authed(t, req)
+}
+
+func serveCreate(h *VideosHandler, req *http.Request) *httptest.ResponseRecorder {
+	rr := httptest.NewRecorder()
+	middleware.AuthRequired(http.HandlerFunc(h.Create)).ServeHTTP(rr, req)
+	return rr
+}
+
+func TestCreate_StreamsFileToStorage(t *testing.T) {
+	h, mock, dir := newVideosHandlerForTest(t)
+	mock.ExpectQuery(`FROM videos\s+WHERE user_id=\$1 AND content_sha256=\$2`).
+		WithArgs(7, sha256Hex("not really a video"), 0, "failed").
+		WillReturnRows(sqlmock.NewRows(nil))
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT INTO videos`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "uploaded_at", "processed_at"}).AddRow(9, time.Now(), time.Now()))
+	mock.ExpectExec(`INSERT INTO outbox`).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(`INSERT INTO job_status`).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	rr := serveCreate(h, uploadRequest(t, "not really a video", map[string]string{"title": "Clavada"}))
+
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("status = %d; body %s", rr.Code, rr.Body.String())
+	}
+	objs := storedObjects(t, dir)
+	if len(objs) != 1 {
+		t.Fatalf("objetos = %v; want uno", objs)
+	}
+	for key, content := range objs {
+		if !strings.HasPrefix(key, "videos/7/") || !strings.HasSuffix(key, "/clip.mp4") || content != "not really a video" {
+			t.Errorf("objeto %q = %q", key, content)
+		}
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("expectativas sqlmock: %v", err)
+	}
+}
+
+func TestCreate_RejectsAndCleansUp(t *testing.T) {
+	cases := []struct {
+		name   string
+		file   string
+		fields map[string]string
+		want   int
+	}{
+		{"sin título", "data", map[string]string{"profile": "default"}, http.StatusBadRequest},
+		{"perfil desconocido", "data", map[string]string{"title": "x", "profile": "nope"}, http.StatusBadRequest},
+		{"visibilidad inválida", "data", map[string]string{"title": "x", "visibility": "secret"}, http.StatusBadRequest},
+		{"publish_at inválido", "data", map[string]string{"title": "x", "publish_at": "mañana"}, http.StatusBadRequest},
+		{"archivo vacío", "", map[string]string{"title": "x"}, http.StatusUnprocessableEntity},
+		{"archivo muy grande", strings.Repeat("x", maxUpload+1), map[string]string{"title": "x"}, http.StatusUnprocessableEntity},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			h, _, dir := newVideosHandlerForTest(t)
+			rr := serveCreate(h, uploadRequest(t, c.file, c.fields))
+
+			if rr.Code != c.want {
+				t.Errorf("status = %d; want %d (body %s)", rr.Code, c.want, rr.Body.String())
+			}
+			if objs := storedObjects(t, dir); len(objs) != 0 {
+				t.Errorf("el objeto rechazado debería haberse eliminado: %v", objs)
+			}
+		})
+	}
+}
+
+func sha256Hex(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+// videoRows has the columns of a video as read by the repository
+func videoRows() *sqlmock.Rows {
+	return sqlmock.NewRows([]string{"id", "title", "status", "uploaded_at", "processed_at", "origin_url", "processed_url", "thumb_url", "votes", "user_id",
+		"failure_reason", "duration_sec", "width", "height", "fps", "video_codec", "audio_codec", "hls_url", "profile", "audio_policy",
+		"thumbnails", "sprite_url", "sprite_vtt_url", "preview_url", "preview_gif_url", "content_sha256", "deleted_at",
+		"description", "tags", "visibility", "share_token", "publish_at"})
+}
+
+// videoRow is a video "Clavada" of userID for videoRows
+func videoRow(id, userID int, status, contentSHA256 string) []driver.Value {
+	return []driver.Value{id, "Clavada", status, time.Now(), time.Now(), "videos/7/x/clip.mp4", "", "", 0, userID,
+		"", 0, 0, 0, 0, "", "", "", "default", "", "", "", "", "", "", contentSHA256, nil,
+		"", "[]", "public", "", nil}
+}
+
+func TestCreate_DuplicateContent(t *testing.T) {
+	h, mock, dir := newVideosHandlerForTest(t)
+	mock.ExpectQuery(`content_sha256=\$2`).
+		WillReturnRows(videoRows().AddRow(videoRow(3, 7, "processed", sha256Hex("same bytes"))...))
+
+	rr := serveCreate(h, uploadRequest(t, "same bytes", map[string]string{"title": "Otra vez"}))
+
+	if rr.Code != http.StatusConflict {
+		t.Fatalf("status = %d; body %s", rr.Code, rr.Body.String())
+	}
+	var body map[string]string
+	if err := json.NewDecoder(rr.Body).Decode(&body); err != nil || body["code"] != "duplicate_video" || body["video_id"] != "3" {
+		t.Errorf("body = %v, %v", body, err)
+	}
+	if objs := storedObjects(t, dir); len(objs) != 0 {
+		t.Errorf("el duplicado debería haberse eliminado: %v", objs)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("expectativas sqlmock: %v", err)
+	}
+}
+
+// authed signs req as user 7
+func authed(t *testing.T, req *http.Request) *http.Request {
+	t.Helper()
+	t.Setenv("JWT_SECRET", "test-secret")
+	tok, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"user_id": 7}).SignedString([]byte("test-secret"))
+	req.Header.Set("Authorization", "Bearer "+tok)
+	return req
+}
+
+func TestUpdate_ChangesMetadata(t *testing.T) {
+	h, mock, _ := newVideosHandlerForTest(t)
+	mock.ExpectQuery(`FROM videos WHERE id = \$1`).WithArgs(5).
+		WillReturnRows(videoRows().AddRow(videoRow(5, 7, "processed", "")...))
+	mock.ExpectExec(`UPDATE videos SET title=\$1, description=NULLIF\(\$2,''\), tags=\$3::jsonb, visibility=\$4`).
+		WithArgs("Clavada final", "", `["dunk"]`, "private", "", nil, 5).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	req := authed(t, httptest.NewRequest(http.MethodPatch, "/api/videos/5", strings.NewReader(`{"title":"Clavada final","tags":["Dunk"],"visibility":"private"}`)))
+	req = mux.SetURLVars(req, map[string]string{"id": "5"})
+	rr := httptest.NewRecorder()
+	middleware.AuthRequired(http.HandlerFunc(h.Update)).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status = %d; body %s", rr.Code, rr.Body.String())
+	}
+	var body struct {
+		Title      string   `json:"title"`
+		Tags       []string `json:"tags"`
+		Visibility string   `json:"visibility"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&body); err != nil || body.Title != "Clavada final" || body.Visibility != "private" || len(body.Tags) != 1 {
+		t.Errorf("body = %+v, %v", body, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("expectativas sqlmock: %v", err)
+	}
+}
+
+func TestReplaceSource_RejectsWhileProcessing(t *testing.T) {
+	h, mock, dir := newVideosHandlerForTest(t)
+	mock.ExpectQuery(`FROM videos WHERE id = \$1`).WithArgs(5).
+		WillReturnRows(videoRows().AddRow(videoRow(5, 7, "processing", "")...))
+
+	req := uploadRequest(t, "new clip", nil)
+	req.Method = http.MethodPut
+	req = mux.SetURLVars(req, map[string]string{"id": "5"})
+	rr := httptest.NewRecorder()
+	middleware.AuthRequired(http.HandlerFunc(h.ReplaceSource)).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusConflict {
+		t.Fatalf("status = %d; body %s", rr.Code, rr.Body.String())
+	}
+	if objs := storedObjects(t, dir); len(objs) != 0 {
+		t.Errorf("no debería guardarse el archivo: %v", objs)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("expectativas sqlmock: %v", err)
+	}
+}
@@ -77,6 +77,7 @@ func (a *AuthService) Login(ctx context.Context, email, password string, remembe
 	claims := jwt.MapClaims{
 		"user_id": u.ID,
 		"email":   u.Email,
+		"role":    u.Role,
 		"exp":     exp.Unix(),
 	}
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
@@ -0,0 +1,63 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"ISIS4426-Entrega1/internal/storage"
+)
+
+// DraftCleaner deletes upload drafts that were never completed: the object
+// the client may have uploaded, then the draft itself.
+type DraftCleaner struct {
+	repo     VideoRepo
+	store    storage.Storage
+	interval time.Duration
+	batch    int
+}
+
+func NewDraftCleaner(repo VideoRepo, store storage.Storage) *DraftCleaner {
+	return &DraftCleaner{repo: repo, store: store, interval: 10 * time.Minute, batch: 100}
+}
+
+// Run cleans periodically until ctx is cancelled
+func (c *DraftCleaner) Run(ctx context.Context) {
+	t := time.NewTicker(c.interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+		if n, err := c.Clean(ctx, time.Now()); err != nil {
+			log.Printf("[api] draft cleanup error: %v", err)
+		} else if n > 0 {
+			log.Printf("[api] draft cleanup removed %d expired draft(s)", n)
+		}
+	}
+}
+
+// Clean removes one batch of drafts expired at now. The object goes first, so
+// a failure leaves the draft in place and the next run retries it.
+func (c *DraftCleaner) Clean(ctx context.Context, now time.Time) (int, error) {
+	drafts, err := c.repo.ExpiredDrafts(ctx, now, c.batch)
+	if err != nil {
+		return 0, fmt.Errorf("list expired drafts: %w", err)
+	}
+	removed := 0
+	for _, d := range drafts {
+		if err := c.store.DeleteFile(ctx, c.store.GetUploadsBucket(), d.OriginURL); err != nil && !storage.IsNotFound(err) {
+			log.Printf("[api] draft cleanup: cannot delete %s (video %d): %v", d.OriginURL, d.VideoID, err)
+			continue
+		}
+		if err := c.repo.DeleteExpiredDraft(ctx, d.VideoID, now); err != nil {
+			log.Printf("[api] draft cleanup: cannot delete video %d: %v", d.VideoID, err)
+			continue
+		}
+		removed++
+	}
+	return removed, nil
+}
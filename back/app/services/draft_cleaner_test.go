@@ -0,0 +1,39 @@
+package services
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"ISIS4426-Entrega1/app/models"
+	"ISIS4426-Entrega1/internal/storage"
+)
+
+func TestDraftCleaner_RemovesObjectsAndDrafts(t *testing.T) {
+	store, err := storage.NewLocal(t.TempDir(), "http://api/files", "secret")
+	if err != nil {
+		t.Fatalf("NewLocal: %v", err)
+	}
+	ctx := context.Background()
+	if err := store.UploadToUploads(ctx, "videos/7/a/clip.mp4", strings.NewReader("partial")); err != nil {
+		t.Fatalf("UploadToUploads: %v", err)
+	}
+	f := &fakeVideoRepo{retExpiredDrafts: []models.Video{
+		{VideoID: 3, OriginURL: "videos/7/a/clip.mp4"},
+		{VideoID: 4, OriginURL: "videos/7/b/never-uploaded.mp4"}, // the client never sent the file
+		{VideoID: 5, OriginURL: "../escape.mp4"},                 // cannot be deleted: kept for the next run
+	}}
+
+	n, err := NewDraftCleaner(f, store).Clean(ctx, time.Now())
+	if err != nil {
+		t.Fatalf("Clean error = %v", err)
+	}
+	if n != 2 || !reflect.DeepEqual(f.gotDeletedDrafts, []int{3, 4}) {
+		t.Errorf("removed %d, drafts deleted %v; want 2, [3 4]", n, f.gotDeletedDrafts)
+	}
+	if ok, _ := store.FileExists(ctx, store.GetUploadsBucket(), "videos/7/a/clip.mp4"); ok {
+		t.Error("el objeto del borrador debería haberse eliminado")
+	}
+}
@@ -0,0 +1,340 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"log"
+	"time"
+
+	"ISIS4426-Entrega1/app/models"
+	"ISIS4426-Entrega1/app/repos"
+	"ISIS4426-Entrega1/internal/s3client"
+	"ISIS4426-Entrega1/internal/storage"
+
+	"github.com/google/uuid"
+)
+
+// MinPartSize is the smallest multipart upload part S3 accepts, except for
+// the last one
+const MinPartSize = 5 << 20
+
+// ErrOffsetMismatch means the client resumed from another offset than the
+// one stored
+var ErrOffsetMismatch = errors.New("upload offset mismatch")
+
+type UploadRepo interface {
+	Create(ctx context.Context, u models.ResumableUpload) error
+	Get(ctx context.Context, id string, userID int) (*models.ResumableUpload, error)
+	Advance(ctx context.Context, u models.ResumableUpload, from int64) error
+	Finish(ctx context.Context, id, jobID string, now time.Time) error
+	Expired(ctx context.Context, now time.Time, limit int) ([]models.ResumableUpload, error)
+	Delete(ctx context.Context, id string) error
+}
+
+// UploadService implements resumable (tus) uploads. The file is assembled as
+// a multipart upload in the uploads bucket while a draft video waits for it;
+// the last chunk completes the draft, which creates the processing job.
+type UploadService struct {
+	repo     UploadRepo
+	videos   *VideoService
+	store    storage.Storage
+	ttl      time.Duration
+	partSize int64
+}
+
+func NewUploadService(repo UploadRepo, videos *VideoService, store storage.Storage, ttl time.Duration) *UploadService {
+	return &UploadService{repo: repo, videos: videos, store: store, ttl: ttl, partSize: MinPartSize}
+}
+
+// tailKey holds the bytes received after the stored parts, which always
+// start where part number begins: rewriting it never changes bytes another
+// request may have counted.
+func tailKey(id string, number int) string {
+	return fmt.Sprintf("resumable/%s/tail-%05d", id, number)
+}
+
+// restoreHash returns the SHA-256 of the parts stored in u; nil when the
+// state was not kept (uploads started before content hashing).
+func restoreHash(u models.ResumableUpload) hash.Hash {
+	h := sha256.New()
+	if len(u.HashState) == 0 {
+		if len(u.Parts) > 0 {
+			return nil
+		}
+		return h
+	}
+	if err := h.(encoding.BinaryUnmarshaler).UnmarshalBinary(u.HashState); err != nil {
+		return nil
+	}
+	return h
+}
+
+// Create opens a resumable upload of length bytes, stored as name, whose
+// video gets the visibility in access
+func (s *UploadService) Create(ctx context.Context, userID int, title, name, profile string, access models.VideoPatch, length int64) (models.ResumableUpload, error) {
+	id := uuid.New().String()
+	u := models.ResumableUpload{
+		ID:     id,
+		UserID: userID,
+		S3Key:  fmt.Sprintf("videos/%d/%s/%s", userID, id, name),
+		Length: length,
+	}
+	draft, expiresAt, err := s.videos.CreateDraft(ctx, userID, title, u.S3Key, profile, access, s.ttl)
+	if err != nil {
+		return u, fmt.Errorf("create draft: %w", err)
+	}
+	u.VideoID, u.CreatedAt, u.ExpiresAt = draft.VideoID, draft.UploadedAt, expiresAt
+
+	u.MultipartID, err = s.store.CreateMultipartUpload(ctx, s.store.GetUploadsBucket(), u.S3Key)
+	if err != nil {
+		return u, fmt.Errorf("create multipart upload: %w", err)
+	}
+	if err := s.repo.Create(ctx, u); err != nil {
+		_ = s.store.AbortMultipartUpload(ctx, s.store.GetUploadsBucket(), u.S3Key, u.MultipartID)
+		return u, err
+	}
+	return u, nil
+}
+
+// Get returns the upload id of userID; repos.ErrDraftExpired once it is
+// past its deadline without being completed.
+func (s *UploadService) Get(ctx context.Context, userID int, id string) (*models.ResumableUpload, error) {
+	u, err := s.repo.Get(ctx, id, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !u.Completed() && !time.Now().Before(u.ExpiresAt) {
+		return nil, repos.ErrDraftExpired
+	}
+	return u, nil
+}
+
+// Append stores body at offset, which must be the current offset of the
+// upload. Whatever arrives before body fails is kept, so the client resumes
+// from the offset returned. Once every byte is stored the object is
+// assembled and the video handed to processing.
+func (s *UploadService) Append(ctx context.Context, userID int, id string, offset int64, body io.Reader) (models.ResumableUpload, error) {
+	u, err := s.Get(ctx, userID, id)
+	if err != nil {
+		return models.ResumableUpload{}, err
+	}
+	if offset != u.Offset {
+		return *u, ErrOffsetMismatch
+	}
+	// a dropped connection must not discard what was already received
+	ctx = context.WithoutCancel(ctx)
+	if u.Offset < u.Length {
+		if err := s.write(ctx, u, body); err != nil {
+			return *u, err
+		}
+	}
+	if u.Offset == u.Length && !u.Completed() {
+		if err := s.finish(ctx, u); err != nil {
+			return *u, fmt.Errorf("complete upload %s: %w", u.ID, err)
+		}
+	}
+	return *u, nil
+}
+
+// write cuts the stored tail plus body into parts of partSize and keeps the
+// remainder as the new tail (or as the last part, at the end of the file).
+// u is updated with what was saved.
+func (s *UploadService) write(ctx context.Context, u *models.ResumableUpload, body io.Reader) error {
+	bucket := s.store.GetUploadsBucket()
+	next := len(u.Parts) + 1
+	tail := io.Reader(bytes.NewReader(nil))
+	if u.TailSize > 0 {
+		rc, err := s.store.DownloadFromUploads(ctx, tailKey(u.ID, next))
+		if err != nil {
+			return fmt.Errorf("read tail: %w", err)
+		}
+		defer rc.Close()
+		tail = io.LimitReader(rc, u.TailSize)
+	}
+	in := &readErr{r: io.MultiReader(tail, io.LimitReader(body, u.Length-u.Offset))}
+
+	upd := *u
+	stored := u.Offset - u.TailSize // bytes already in parts
+	sum := restoreHash(*u)
+	buf := make([]byte, s.partSize)
+	var writeErr error
+	for writeErr == nil {
+		n, rerr := io.ReadFull(in, buf)
+		chunk := buf[:n]
+		switch {
+		case n == 0:
+		case int64(n) == s.partSize || stored+int64(n) == u.Length:
+			part, err := s.store.UploadPart(ctx, bucket, u.S3Key, u.MultipartID, int32(len(upd.Parts)+1), bytes.NewReader(chunk), int64(n))
+			if err != nil {
+				writeErr = fmt.Errorf("upload part %d: %w", len(upd.Parts)+1, err)
+				break
+			}
+			upd.Parts = append(upd.Parts, models.UploadPart{Number: part.Number, ETag: part.ETag})
+			if sum != nil {
+				sum.Write(chunk)
+				upd.HashState, _ = sum.(encoding.BinaryMarshaler).MarshalBinary()
+			}
+			stored += int64(n)
+			upd.Offset, upd.TailSize = stored, 0
+		default:
+			if err := s.store.UploadToUploads(ctx, tailKey(u.ID, len(upd.Parts)+1), bytes.NewReader(chunk)); err != nil {
+				writeErr = fmt.Errorf("write tail: %w", err)
+				break
+			}
+			upd.Offset, upd.TailSize = stored+int64(n), int64(n)
+		}
+		if rerr != nil {
+			break
+		}
+	}
+	if writeErr == nil {
+		writeErr = in.err
+	}
+
+	if upd.Offset != u.Offset {
+		if err := s.repo.Advance(ctx, upd, u.Offset); err != nil {
+			return err
+		}
+		if u.TailSize > 0 && len(upd.Parts) >= next {
+			_ = s.store.DeleteFile(ctx, bucket, tailKey(u.ID, next))
+		}
+		*u = upd
+	}
+	return writeErr
+}
+
+// readErr records the first read error other than io.EOF, which io.ReadFull
+// would report as io.ErrUnexpectedEOF, the same as a short last read
+type readErr struct {
+	r   io.Reader
+	err error
+}
+
+func (e *readErr) Read(p []byte) (int, error) {
+	n, err := e.r.Read(p)
+	if err != nil && err != io.EOF && e.err == nil {
+		e.err = err
+	}
+	return n, err
+}
+
+// finish assembles the object and completes the draft. Each step tolerates
+// having been done by an earlier attempt that failed afterwards. When the user
+// already uploaded the same content, the upload and its draft are discarded
+// and the *DuplicateError returned.
+func (s *UploadService) finish(ctx context.Context, u *models.ResumableUpload) error {
+	bucket := s.store.GetUploadsBucket()
+	parts := make([]s3client.Part, len(u.Parts))
+	for i, p := range u.Parts {
+		parts[i] = s3client.Part{Number: p.Number, ETag: p.ETag}
+	}
+	if err := s.store.CompleteMultipartUpload(ctx, bucket, u.S3Key, u.MultipartID, parts); err != nil {
+		if size, serr := s.store.ObjectSize(ctx, bucket, u.S3Key); serr != nil || size != u.Length {
+			return err
+		}
+	}
+	var contentSHA256 string
+	if sum := restoreHash(*u); sum != nil {
+		contentSHA256 = hex.EncodeToString(sum.Sum(nil))
+	}
+	_, jobID, err := s.videos.CompleteDraft(ctx, u.UserID, u.VideoID, contentSHA256)
+	var dup *DuplicateError
+	if errors.As(err, &dup) {
+		_ = s.store.DeleteFile(ctx, bucket, u.S3Key)
+		if derr := s.videos.Delete(ctx, u.VideoID); derr != nil {
+			return derr
+		}
+		if derr := s.repo.Delete(ctx, u.ID); derr != nil {
+			return derr
+		}
+		return err
+	}
+	if err != nil && !errors.Is(err, repos.ErrNotDraft) {
+		return err
+	}
+	now := time.Now()
+	if err := s.repo.Finish(ctx, u.ID, jobID, now); err != nil {
+		return err
+	}
+	u.JobID, u.CompletedAt = jobID, now
+	return nil
+}
+
+// Terminate discards an upload that was not completed, with its draft
+func (s *UploadService) Terminate(ctx context.Context, userID int, id string) error {
+	u, err := s.repo.Get(ctx, id, userID)
+	if err != nil {
+		return err
+	}
+	if u.Completed() {
+		return repos.ErrNotDraft
+	}
+	if err := s.discard(ctx, *u); err != nil {
+		return err
+	}
+	if u.VideoID != 0 {
+		return s.videos.Delete(ctx, u.VideoID)
+	}
+	return nil
+}
+
+// discard removes the stored parts and tail of u, then u itself
+func (s *UploadService) discard(ctx context.Context, u models.ResumableUpload) error {
+	bucket := s.store.GetUploadsBucket()
+	if !u.Completed() {
+		err := s.store.AbortMultipartUpload(ctx, bucket, u.S3Key, u.MultipartID)
+		if err != nil && !storage.IsNotFound(err) {
+			return fmt.Errorf("abort multipart upload: %w", err)
+		}
+	}
+	if u.TailSize > 0 {
+		err := s.store.DeleteFile(ctx, bucket, tailKey(u.ID, len(u.Parts)+1))
+		if err != nil && !storage.IsNotFound(err) {
+			return fmt.Errorf("delete tail: %w", err)
+		}
+	}
+	return s.repo.Delete(ctx, u.ID)
+}
+
+// RunCleaner discards expired uploads every interval until ctx is cancelled.
+// Their draft videos are removed by the DraftCleaner.
+func (s *UploadService) RunCleaner(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+		if n, err := s.Clean(ctx, time.Now()); err != nil {
+			log.Printf("[api] resumable upload cleanup error: %v", err)
+		} else if n > 0 {
+			log.Printf("[api] resumable upload cleanup removed %d expired upload(s)", n)
+		}
+	}
+}
+
+// Clean discards one batch of uploads expired at now
+func (s *UploadService) Clean(ctx context.Context, now time.Time) (int, error) {
+	expired, err := s.repo.Expired(ctx, now, 100)
+	if err != nil {
+		return 0, fmt.Errorf("list expired uploads: %w", err)
+	}
+	removed := 0
+	for _, u := range expired {
+		if err := s.discard(ctx, u); err != nil {
+			log.Printf("[api] resumable upload cleanup: cannot discard %s: %v", u.ID, err)
+			continue
+		}
+		removed++
+	}
+	return removed, nil
+}
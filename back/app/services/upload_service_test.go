@@ -0,0 +1,179 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"ISIS4426-Entrega1/app/models"
+	"ISIS4426-Entrega1/app/repos"
+	"ISIS4426-Entrega1/internal/storage"
+)
+
+type fakeUploadRepo struct {
+	uploads map[string]models.ResumableUpload
+}
+
+func (f *fakeUploadRepo) Create(ctx context.Context, u models.ResumableUpload) error {
+	f.uploads[u.ID] = u
+	return nil
+}
+func (f *fakeUploadRepo) Get(ctx context.Context, id string, userID int) (*models.ResumableUpload, error) {
+	u, ok := f.uploads[id]
+	if !ok || u.UserID != userID {
+		return nil, repos.ErrNotFound
+	}
+	return &u, nil
+}
+func (f *fakeUploadRepo) Advance(ctx context.Context, u models.ResumableUpload, from int64) error {
+	if f.uploads[u.ID].Offset != from {
+		return repos.ErrOffsetConflict
+	}
+	f.uploads[u.ID] = u
+	return nil
+}
+func (f *fakeUploadRepo) Finish(ctx context.Context, id, jobID string, now time.Time) error {
+	u := f.uploads[id]
+	u.JobID, u.CompletedAt = jobID, now
+	f.uploads[id] = u
+	return nil
+}
+func (f *fakeUploadRepo) Expired(ctx context.Context, now time.Time, limit int) ([]models.ResumableUpload, error) {
+	var out []models.ResumableUpload
+	for _, u := range f.uploads {
+		if !u.ExpiresAt.After(now) {
+			out = append(out, u)
+		}
+	}
+	return out, nil
+}
+func (f *fakeUploadRepo) Delete(ctx context.Context, id string) error {
+	delete(f.uploads, id)
+	return nil
+}
+
+// brokenReader returns data and then fails, like a dropped connection
+type brokenReader struct{ data io.Reader }
+
+func (r brokenReader) Read(p []byte) (int, error) {
+	n, err := r.data.Read(p)
+	if err == io.EOF {
+		return n, io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+func newTestUploads(t *testing.T) (*UploadService, *fakeUploadRepo, *fakeVideoRepo, storage.Storage) {
+	t.Helper()
+	store, err := storage.NewLocal(t.TempDir(), "http://api/files", "secret")
+	if err != nil {
+		t.Fatalf("NewLocal: %v", err)
+	}
+	repo := &fakeUploadRepo{uploads: map[string]models.ResumableUpload{}}
+	videos := &fakeVideoRepo{}
+	s := NewUploadService(repo, NewVideoService(videos, nil), store, time.Hour)
+	s.partSize = 4
+	return s, repo, videos, store
+}
+
+func TestUploadService_ResumesAndCompletes(t *testing.T) {
+	s, _, videos, store := newTestUploads(t)
+	ctx := context.Background()
+
+	u, err := s.Create(ctx, 7, "Clavada", "clip.mp4", "vertical", models.VideoPatch{}, 10)
+	if err != nil {
+		t.Fatalf("Create error = %v", err)
+	}
+	if u.VideoID != 50 || videos.gotCreateDraft.Profile != "vertical" || !strings.HasSuffix(u.S3Key, "/clip.mp4") {
+		t.Fatalf("upload = %+v; draft %+v", u, videos.gotCreateDraft)
+	}
+
+	steps := []struct {
+		offset   int64
+		body     io.Reader
+		wantOff  int64
+		wantTail int64
+		wantErr  bool
+	}{
+		{0, strings.NewReader("abc"), 3, 3, false},                   // less than a part: kept as tail
+		{3, strings.NewReader("defgh"), 8, 0, false},                 // tail + body make two parts
+		{8, brokenReader{strings.NewReader("i")}, 9, 1, true},        // connection dropped, the byte is kept
+		{9, strings.NewReader("jEXTRA-BEYOND-LENGTH"), 10, 0, false}, // last part, extra bytes ignored
+	}
+	for i, st := range steps {
+		got, err := s.Append(ctx, 7, u.ID, st.offset, st.body)
+		if (err != nil) != st.wantErr {
+			t.Fatalf("paso %d: err = %v; wantErr %t", i, err, st.wantErr)
+		}
+		if got.Offset != st.wantOff || got.TailSize != st.wantTail {
+			t.Fatalf("paso %d: offset/tail = %d/%d; want %d/%d", i, got.Offset, got.TailSize, st.wantOff, st.wantTail)
+		}
+	}
+
+	got, err := s.Get(ctx, 7, u.ID)
+	if err != nil || !got.Completed() || got.JobID == "" || len(got.Parts) != 3 {
+		t.Fatalf("upload final = %+v, %v; want completed with job and 3 parts", got, err)
+	}
+	// sha256("abcdefghij"), computed across requests from the stored hash state
+	const wantSHA = "72399361da6a7754fec986dca5b7cbaf1c810a28ded4abaf56b2106d06cb78b0"
+	if videos.gotCompleteDraft.id != 50 || videos.gotCompleteDraft.userID != 7 || videos.gotCompleteDraft.sha != wantSHA || videos.gotCreateJobID != got.JobID {
+		t.Errorf("CompleteDraft got %+v job %q", videos.gotCompleteDraft, videos.gotCreateJobID)
+	}
+	rc, err := store.DownloadFromUploads(ctx, u.S3Key)
+	if err != nil {
+		t.Fatalf("objeto ensamblado: %v", err)
+	}
+	b, _ := io.ReadAll(rc)
+	rc.Close()
+	if string(b) != "abcdefghij" {
+		t.Errorf("contenido = %q; want abcdefghij", b)
+	}
+	if ok, _ := store.FileExists(ctx, store.GetUploadsBucket(), tailKey(u.ID, 1)); ok {
+		t.Error("la cola anterior debería haberse eliminado")
+	}
+}
+
+func TestUploadService_Errors(t *testing.T) {
+	s, repo, _, _ := newTestUploads(t)
+	ctx := context.Background()
+	u, _ := s.Create(ctx, 7, "Clavada", "clip.mp4", "", models.VideoPatch{}, 10)
+
+	if _, err := s.Append(ctx, 7, u.ID, 4, strings.NewReader("x")); !errors.Is(err, ErrOffsetMismatch) {
+		t.Errorf("offset distinto: err = %v; want ErrOffsetMismatch", err)
+	}
+	if _, err := s.Append(ctx, 8, u.ID, 0, strings.NewReader("x")); !errors.Is(err, repos.ErrNotFound) {
+		t.Errorf("otro usuario: err = %v; want ErrNotFound", err)
+	}
+
+	expired := repo.uploads[u.ID]
+	expired.ExpiresAt = time.Now().Add(-time.Minute)
+	repo.uploads[u.ID] = expired
+	if _, err := s.Append(ctx, 7, u.ID, 0, strings.NewReader("x")); !errors.Is(err, repos.ErrDraftExpired) {
+		t.Errorf("vencida: err = %v; want ErrDraftExpired", err)
+	}
+	if n, err := s.Clean(ctx, time.Now()); err != nil || n != 1 || len(repo.uploads) != 0 {
+		t.Errorf("Clean = %d, %v; quedan %d", n, err, len(repo.uploads))
+	}
+}
+
+func TestUploadService_DuplicateDiscardsUpload(t *testing.T) {
+	s, repo, videos, store := newTestUploads(t)
+	ctx := context.Background()
+	videos.retFindByContent = &models.Video{VideoID: 3, UserID: 7}
+	u, _ := s.Create(ctx, 7, "Clavada", "clip.mp4", "", models.VideoPatch{}, 4)
+
+	_, err := s.Append(ctx, 7, u.ID, 0, strings.NewReader("abcd"))
+	var dup *DuplicateError
+	if !errors.As(err, &dup) || dup.Video.VideoID != 3 {
+		t.Fatalf("err = %v; want DuplicateError of video 3", err)
+	}
+	if _, ok := repo.uploads[u.ID]; ok || videos.gotDelete != 50 {
+		t.Errorf("la subida y su borrador deberían eliminarse (deleted video %d)", videos.gotDelete)
+	}
+	if ok, _ := store.FileExists(ctx, store.GetUploadsBucket(), u.S3Key); ok {
+		t.Error("el objeto duplicado debería haberse eliminado")
+	}
+}
@@ -0,0 +1,176 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"ISIS4426-Entrega1/app/models"
+	"ISIS4426-Entrega1/app/repos"
+	"ISIS4426-Entrega1/internal/storage"
+
+	"github.com/google/uuid"
+)
+
+const (
+	maxTitleLen       = 200
+	maxDescriptionLen = 5000
+	maxTags           = 10
+	maxTagLen         = 30
+)
+
+var (
+	ErrTitleTooLong       = errors.New("title too long")
+	ErrInvalidDescription = errors.New("description too long")
+	ErrInvalidTags        = errors.New("too many tags or tag too long")
+	ErrInvalidVisibility  = errors.New("unknown visibility")
+	ErrInvalidPublishAt   = errors.New("publish_at must be an RFC 3339 time")
+)
+
+// UpdateFor applies p to the metadata of video id, with the checks of GetFor
+func (s *VideoService) UpdateFor(ctx context.Context, a Actor, id int, p models.VideoPatch) (*models.Video, error) {
+	v, err := s.GetFor(ctx, a, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := applyPatch(v, p); err != nil {
+		return nil, err
+	}
+	if err := s.repo.UpdateMetadata(ctx, *v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// applyPatch validates p and sets its fields on v. Tags are trimmed,
+// lowercased and deduplicated. An unlisted video gets a share token the
+// first time; it is kept afterwards, so its link works again whenever the
+// video goes back to unlisted.
+func applyPatch(v *models.Video, p models.VideoPatch) error {
+	if p.Title != nil {
+		title := strings.TrimSpace(*p.Title)
+		if title == "" {
+			return ErrInvalidTitle
+		}
+		if utf8.RuneCountInString(title) > maxTitleLen {
+			return ErrTitleTooLong
+		}
+		v.Title = title
+	}
+	if p.Description != nil {
+		if utf8.RuneCountInString(*p.Description) > maxDescriptionLen {
+			return ErrInvalidDescription
+		}
+		v.Description = strings.TrimSpace(*p.Description)
+	}
+	if p.Tags != nil {
+		tags := []string{}
+		seen := map[string]bool{}
+		for _, t := range *p.Tags {
+			t = strings.ToLower(strings.TrimSpace(t))
+			if t == "" || seen[t] {
+				continue
+			}
+			if utf8.RuneCountInString(t) > maxTagLen {
+				return ErrInvalidTags
+			}
+			seen[t] = true
+			tags = append(tags, t)
+		}
+		if len(tags) > maxTags {
+			return ErrInvalidTags
+		}
+		v.Tags = tags
+	}
+	if p.Visibility != nil {
+		if !p.Visibility.Valid() {
+			return ErrInvalidVisibility
+		}
+		v.Visibility = *p.Visibility
+	}
+	if p.PublishAt != nil {
+		v.PublishAt = nil
+		if *p.PublishAt != "" {
+			t, err := time.Parse(time.RFC3339, *p.PublishAt)
+			if err != nil {
+				return ErrInvalidPublishAt
+			}
+			t = t.UTC()
+			v.PublishAt = &t
+		}
+	}
+	if v.Visibility == models.VisibilityUnlisted && v.ShareToken == "" {
+		token, err := newShareToken()
+		if err != nil {
+			return err
+		}
+		v.ShareToken = token
+	}
+	return nil
+}
+
+// AccessPatch keeps the fields of p that can be chosen with an upload: the
+// visibility and the scheduled publish date.
+func AccessPatch(p models.VideoPatch) models.VideoPatch {
+	return models.VideoPatch{Visibility: p.Visibility, PublishAt: p.PublishAt}
+}
+
+// CheckAccess validates the access fields of p like UpdateFor does, so an
+// upload can be rejected before its file is stored or probed
+func CheckAccess(p models.VideoPatch) error {
+	var v models.Video
+	return applyPatch(&v, AccessPatch(p))
+}
+
+// newShareToken returns a random, URL-safe share token
+func newShareToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("share token: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// ReplaceSourceFor points video id at a new original file, already stored
+// at s3Key in the uploads bucket, and creates its processing job, returning
+// the job ID. The video keeps its id and, with keepVotes, its votes; profile
+// empty keeps the current one. The previous original is then removed; the
+// outputs of the previous job go when the worker publishes the new ones.
+// repos.ErrProcessing while a job of the video has not finished; a
+// *DuplicateError when another video of the owner has the same content.
+func (s *VideoService) ReplaceSourceFor(ctx context.Context, a Actor, id int, s3Key, profile, contentSHA256 string, keepVotes bool) (*models.Video, string, error) {
+	v, err := s.GetFor(ctx, a, id)
+	if err != nil {
+		return nil, "", err
+	}
+	if v.Status != models.StatusProcessed && v.Status != models.StatusFailed {
+		return nil, "", repos.ErrProcessing
+	}
+	if err := s.checkDuplicate(ctx, v.UserID, contentSHA256, id, nil); err != nil {
+		return nil, "", err
+	}
+	previous := v.OriginURL
+	src := *v
+	src.OriginURL, src.ContentSHA256 = s3Key, contentSHA256
+	if profile != "" {
+		src.Profile = profile
+	}
+	jobID := uuid.New().String()
+	updated, err := s.repo.ReplaceSource(ctx, src, keepVotes, jobID, time.Now())
+	if err != nil {
+		return nil, "", s.checkDuplicate(ctx, v.UserID, contentSHA256, id, err)
+	}
+	if s.store != nil && previous != s3Key {
+		err := s.store.DeleteFile(ctx, s.store.GetUploadsBucket(), previous)
+		if err != nil && !storage.IsNotFound(err) {
+			log.Printf("[api] replace source: cannot delete previous original video_id=%d key=%q: %v", id, previous, err)
+		}
+	}
+	return &updated, jobID, nil
+}
@@ -0,0 +1,72 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"ISIS4426-Entrega1/app/models"
+	"ISIS4426-Entrega1/app/repos"
+)
+
+// ErrForbidden means the video exists but belongs to someone else
+var ErrForbidden = errors.New("video belongs to another user")
+
+// Actor is the authenticated user an operation runs for
+type Actor struct {
+	UserID int
+	Admin  bool
+}
+
+// owns tells whether a may read private data of v, change it or delete it
+func (a Actor) owns(v *models.Video) bool {
+	return a.Admin || v.UserID == a.UserID
+}
+
+// GetFor returns video id when a owns it: repos.ErrNotFound when it does not
+// exist or is in the trash, ErrForbidden when it belongs to another user.
+func (s *VideoService) GetFor(ctx context.Context, a Actor, id int) (*models.Video, error) {
+	v, err := s.getAny(ctx, a, id)
+	if err != nil {
+		return nil, err
+	}
+	if v.DeletedAt != nil {
+		return nil, repos.ErrNotFound
+	}
+	return v, nil
+}
+
+// getAny is GetFor including videos in the trash
+func (s *VideoService) getAny(ctx context.Context, a Actor, id int) (*models.Video, error) {
+	v, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if !a.owns(v) {
+		return nil, ErrForbidden
+	}
+	return v, nil
+}
+
+// DeleteFor moves video id to the trash, with the checks of GetFor. It can
+// be restored within the trash retention, then it is purged (PurgeTrash).
+func (s *VideoService) DeleteFor(ctx context.Context, a Actor, id int) error {
+	if _, err := s.GetFor(ctx, a, id); err != nil {
+		return err
+	}
+	return s.repo.SoftDelete(ctx, id, time.Now())
+}
+
+// ListFor lists the videos of userID. Without userID (0) users get their
+// own videos and admins everyone's; only admins may list another user.
+func (s *VideoService) ListFor(ctx context.Context, a Actor, userID, limit, offset int) ([]models.Video, error) {
+	switch {
+	case userID == 0 && a.Admin:
+		return s.List(ctx, limit, offset)
+	case userID == 0:
+		userID = a.UserID
+	case userID != a.UserID && !a.Admin:
+		return nil, ErrForbidden
+	}
+	return s.ListByUser(ctx, userID, limit, offset)
+}
@@ -0,0 +1,87 @@
+package services
+
+import (
+	"context"
+	"errors"
+
+	"ISIS4426-Entrega1/app/models"
+	"ISIS4426-Entrega1/app/repos"
+
+	"github.com/google/uuid"
+)
+
+// maxReprocessBatch bounds the videos queued by one bulk reprocessing
+const maxReprocessBatch = 500
+
+// ErrInvalidFilter means a bulk reprocessing filter cannot match anything
+var ErrInvalidFilter = errors.New("invalid reprocess filter")
+
+// ReprocessJob is a processing job queued for a video
+type ReprocessJob struct {
+	VideoID int
+	JobID   string
+}
+
+// ReprocessResult lists the jobs queued by a bulk reprocessing and the
+// videos skipped because one of their jobs had not finished
+type ReprocessResult struct {
+	Jobs    []ReprocessJob
+	Skipped []int
+}
+
+// ReprocessFor queues a new processing job for video id from its stored
+// original, with the checks of GetFor, and returns the job ID. A processed
+// video keeps its published outputs until the new ones are ready.
+// repos.ErrProcessing while another job of the video has not finished.
+func (s *VideoService) ReprocessFor(ctx context.Context, a Actor, id int) (*models.Video, string, error) {
+	if _, err := s.GetFor(ctx, a, id); err != nil {
+		return nil, "", err
+	}
+	jobID := uuid.New().String()
+	v, err := s.repo.Reprocess(ctx, id, jobID)
+	if err != nil {
+		return nil, "", err
+	}
+	return &v, jobID, nil
+}
+
+// ReprocessBulk queues a job for every video matching f, up to f.Limit (100
+// by default, at most maxReprocessBatch). Only admins may run it. Videos with
+// a job in progress are skipped; on error the jobs queued so far are kept and
+// returned.
+func (s *VideoService) ReprocessBulk(ctx context.Context, a Actor, f models.ReprocessFilter) (ReprocessResult, error) {
+	var res ReprocessResult
+	if !a.Admin {
+		return res, ErrForbidden
+	}
+	if f.Status != "" && f.Status != models.StatusProcessed && f.Status != models.StatusFailed {
+		return res, ErrInvalidFilter
+	}
+	if !f.From.IsZero() && !f.To.IsZero() && !f.From.Before(f.To) {
+		return res, ErrInvalidFilter
+	}
+	if f.Limit <= 0 {
+		f.Limit = 100
+	}
+	if f.Limit > maxReprocessBatch {
+		f.Limit = maxReprocessBatch
+	}
+
+	videos, err := s.repo.FindForReprocess(ctx, f)
+	if err != nil {
+		return res, err
+	}
+	for _, v := range videos {
+		jobID := uuid.New().String()
+		_, err := s.repo.Reprocess(ctx, v.VideoID, jobID)
+		switch {
+		case err == nil:
+			res.Jobs = append(res.Jobs, ReprocessJob{VideoID: v.VideoID, JobID: jobID})
+		case errors.Is(err, repos.ErrProcessing), errors.Is(err, repos.ErrNotFound):
+			res.Skipped = append(res.Skipped, v.VideoID)
+		default:
+			return res, err
+		}
+	}
+	return res, nil
+}
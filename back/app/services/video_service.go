@@ -3,9 +3,15 @@ package services
 import (
 	"context"
 	"errors"
+	"fmt"
+	"strings"
 	"time"
 
 	"ISIS4426-Entrega1/app/models"
+	"ISIS4426-Entrega1/app/repos"
+	"ISIS4426-Entrega1/internal/storage"
+
+	"github.com/google/uuid"
 )
 
 var (
@@ -13,30 +19,175 @@ var (
 	ErrInvalidURL   = errors.New("url is required")
 )
 
+// DuplicateError is returned when a user uploads the same content as one of
+// their videos, which is kept in Video
+type DuplicateError struct {
+	Video models.Video
+}
+
+func (e *DuplicateError) Error() string {
+	return fmt.Sprintf("content already uploaded as video %d", e.Video.VideoID)
+}
+
 type VideoRepo interface {
 	Create(v models.Video) (models.Video, error)
+	CreateWithJob(ctx context.Context, v models.Video, jobID string) (models.Video, error)
 	GetByID(ctx context.Context, id int) (*models.Video, error)
+	FindByContent(ctx context.Context, userID int, contentSHA256 string, exceptID int) (*models.Video, error)
+	SetContentSHA256(ctx context.Context, id int, contentSHA256 string) error
 	List(ctx context.Context, limit, offset int) ([]models.Video, error)
 	ListByUser(ctx context.Context, userID, limit, offset int) ([]models.Video, error)
 	Delete(ctx context.Context, id int) error
+	DeleteWithJobs(ctx context.Context, id int, now time.Time) ([]string, error)
+	SoftDelete(ctx context.Context, id int, now time.Time) error
+	Restore(ctx context.Context, id int) error
+	ListTrash(ctx context.Context, userID, limit, offset int) ([]models.Video, error)
+	DeletedBefore(ctx context.Context, t time.Time, limit int) ([]models.Video, error)
 	UpdateStatus(ctx context.Context, id int, status models.VideoStatus, updatedAt time.Time) error
 	UpdateProcessedURL(ctx context.Context, id int, url string, updatedAt time.Time) error
 	UpdateThumbURL(ctx context.Context, id int, url string, updatedAt time.Time) error
+	MarkFailed(ctx context.Context, id int, reason string, updatedAt time.Time) error
+	MarkProcessed(ctx context.Context, id int, out models.ProcessedOutputs, updatedAt time.Time) error
+	UpdateMediaInfo(ctx context.Context, id int, m models.MediaInfo) error
+	UpdateMetadata(ctx context.Context, v models.Video) error
+	ReplaceSource(ctx context.Context, v models.Video, keepVotes bool, jobID string, now time.Time) (models.Video, error)
+	Reprocess(ctx context.Context, id int, jobID string) (models.Video, error)
+	FindForReprocess(ctx context.Context, f models.ReprocessFilter) ([]models.Video, error)
+	JobIDs(ctx context.Context, id int) ([]string, error)
+
+	CreateDraft(ctx context.Context, v models.Video, expiresAt time.Time) (models.Video, error)
+	GetDraft(ctx context.Context, id, userID int, now time.Time) (*models.Video, error)
+	CompleteDraft(ctx context.Context, id, userID int, jobID, contentSHA256 string, now time.Time) (models.Video, error)
+	ExpiredDrafts(ctx context.Context, now time.Time, limit int) ([]models.Video, error)
+	DeleteExpiredDraft(ctx context.Context, id int, now time.Time) error
 }
 
-type VideoService struct{ repo VideoRepo }
+type VideoService struct {
+	repo  VideoRepo
+	store storage.Storage // nil: deleting a video leaves its objects
+}
 
-func NewVideoService(r VideoRepo) *VideoService { return &VideoService{repo: r} }
+func NewVideoService(r VideoRepo, store storage.Storage) *VideoService {
+	return &VideoService{repo: r, store: store}
+}
 
-func (s *VideoService) Create(userID int, title, s3Key string) (models.Video, error) {
+// newUpload validates and builds a freshly uploaded video record. New
+// videos are private unless access says otherwise (see AccessPatch).
+func newUpload(userID int, title, s3Key string, access models.VideoPatch) (models.Video, error) {
+	if strings.TrimSpace(title) == "" {
+		return models.Video{}, ErrInvalidTitle
+	}
+	if strings.TrimSpace(s3Key) == "" {
+		return models.Video{}, ErrInvalidURL
+	}
 	// Store the S3 key in origin_url field for now
 	// The full S3 URL will be generated when needed
-	return s.repo.Create(models.Video{
-		Title:     title,
-		OriginURL: s3Key, // Store S3 key, not full URL
-		Status:    models.StatusUploaded,
-		UserID:    userID,
-	})
+	v := models.Video{
+		Title:      title,
+		OriginURL:  s3Key, // Store S3 key, not full URL
+		Status:     models.StatusUploaded,
+		UploadedAt: time.Now(),
+		UserID:     userID,
+		Visibility: models.VisibilityPrivate,
+	}
+	if err := applyPatch(&v, AccessPatch(access)); err != nil {
+		return models.Video{}, err
+	}
+	return v, nil
+}
+
+func (s *VideoService) Create(userID int, title, s3Key string) (models.Video, error) {
+	v, err := newUpload(userID, title, s3Key, models.VideoPatch{})
+	if err != nil {
+		return models.Video{}, err
+	}
+	return s.repo.Create(v)
+}
+
+// CreateWithJob stores the video and its processing job atomically and
+// returns the job ID. The job reaches the queue through the outbox relay.
+// profile names the processing profile, already validated by the caller;
+// access the visibility chosen with the upload.
+// A *DuplicateError means the user already uploaded contentSHA256.
+func (s *VideoService) CreateWithJob(ctx context.Context, userID int, title, s3Key, profile, contentSHA256 string, access models.VideoPatch) (models.Video, string, error) {
+	v, err := newUpload(userID, title, s3Key, access)
+	if err != nil {
+		return models.Video{}, "", err
+	}
+	if err := s.checkDuplicate(ctx, userID, contentSHA256, 0, nil); err != nil {
+		return models.Video{}, "", err
+	}
+	v.Profile, v.ContentSHA256 = profile, contentSHA256
+	jobID := uuid.New().String()
+	created, err := s.repo.CreateWithJob(ctx, v, jobID)
+	if err != nil {
+		return models.Video{}, "", s.checkDuplicate(ctx, userID, contentSHA256, 0, err)
+	}
+	return created, jobID, nil
+}
+
+// checkDuplicate looks for another video of userID with the same content and
+// returns it as a *DuplicateError. cause is the error of a write that hit
+// the unique index (a concurrent upload); nil to check before writing.
+func (s *VideoService) checkDuplicate(ctx context.Context, userID int, contentSHA256 string, exceptID int, cause error) error {
+	if contentSHA256 == "" || (cause != nil && !errors.Is(cause, repos.ErrDuplicate)) {
+		return cause
+	}
+	dup, err := s.repo.FindByContent(ctx, userID, contentSHA256, exceptID)
+	switch {
+	case err == nil:
+		return &DuplicateError{Video: *dup}
+	case errors.Is(err, repos.ErrNotFound):
+		return cause
+	default:
+		return err
+	}
+}
+
+// CreateDraft registers a video whose file the client uploads straight to
+// the uploads bucket. The draft expires after ttl unless CompleteDraft runs.
+func (s *VideoService) CreateDraft(ctx context.Context, userID int, title, s3Key, profile string, access models.VideoPatch, ttl time.Duration) (models.Video, time.Time, error) {
+	v, err := newUpload(userID, title, s3Key, access)
+	if err != nil {
+		return models.Video{}, time.Time{}, err
+	}
+	v.Profile = profile
+	expiresAt := v.UploadedAt.Add(ttl)
+	created, err := s.repo.CreateDraft(ctx, v, expiresAt)
+	if err != nil {
+		return models.Video{}, time.Time{}, err
+	}
+	return created, expiresAt, nil
+}
+
+// GetDraft returns a pending draft of userID
+func (s *VideoService) GetDraft(ctx context.Context, userID, id int) (*models.Video, error) {
+	return s.repo.GetDraft(ctx, id, userID, time.Now())
+}
+
+// CompleteDraft turns a pending draft into an upload and creates its
+// processing job, atomically like CreateWithJob. It returns the job ID.
+// contentSHA256 is empty when the file did not go through the API; the
+// worker hashes it then (RecordContent).
+func (s *VideoService) CompleteDraft(ctx context.Context, userID, id int, contentSHA256 string) (models.Video, string, error) {
+	if err := s.checkDuplicate(ctx, userID, contentSHA256, id, nil); err != nil {
+		return models.Video{}, "", err
+	}
+	jobID := uuid.New().String()
+	v, err := s.repo.CompleteDraft(ctx, id, userID, jobID, contentSHA256, time.Now())
+	if err != nil {
+		return models.Video{}, "", s.checkDuplicate(ctx, userID, contentSHA256, id, err)
+	}
+	return v, jobID, nil
+}
+
+// RecordContent stores the content hash of video id, when it has none yet.
+// A *DuplicateError means another video of userID has the same content.
+func (s *VideoService) RecordContent(ctx context.Context, userID, id int, contentSHA256 string) error {
+	if err := s.repo.SetContentSHA256(ctx, id, contentSHA256); err != nil {
+		return s.checkDuplicate(ctx, userID, contentSHA256, id, err)
+	}
+	return nil
 }
 
 func (s *VideoService) UpdateStatus(ctx context.Context, id int, st models.VideoStatus) error {
@@ -78,3 +229,23 @@ func (s *VideoService) UpdateProcessedURL(ctx context.Context, id int, url strin
 func (s *VideoService) UpdateThumbURL(ctx context.Context, id int, url string) error {
 	return s.repo.UpdateThumbURL(ctx, id, url, time.Now())
 }
+
+// MarkFailed sets the terminal failed status and the reason shown to the owner
+func (s *VideoService) MarkFailed(ctx context.Context, id int, reason string) error {
+	return s.repo.MarkFailed(ctx, id, reason, time.Now())
+}
+
+// MarkProcessed publishes the processing outputs and sets the processed status
+func (s *VideoService) MarkProcessed(ctx context.Context, id int, out models.ProcessedOutputs) error {
+	return s.repo.MarkProcessed(ctx, id, out, time.Now())
+}
+
+// JobIDs returns the IDs of every processing job of video id, oldest first
+func (s *VideoService) JobIDs(ctx context.Context, id int) ([]string, error) {
+	return s.repo.JobIDs(ctx, id)
+}
+
+// UpdateMediaInfo records the probe metadata of the uploaded file
+func (s *VideoService) UpdateMediaInfo(ctx context.Context, id int, m models.MediaInfo) error {
+	return s.repo.UpdateMediaInfo(ctx, id, m)
+}
@@ -3,10 +3,14 @@ package services
 import (
 	"context"
 	"errors"
+	"reflect"
+	"strings"
 	"testing"
 	"time"
 
 	"ISIS4426-Entrega1/app/models"
+	"ISIS4426-Entrega1/app/repos"
+	"ISIS4426-Entrega1/internal/storage"
 )
 
 // ----- Fake Repo (mock manual) -----
@@ -14,6 +18,7 @@ import (
 type fakeVideoRepo struct {
 	// inputs capturados
 	gotCreate       *models.Video
+	gotCreateJobID  string
 	gotGetByID      int
 	gotList         struct{ limit, offset int }
 	gotListByUser   struct{ userID, limit, offset int }
@@ -33,6 +38,35 @@ type fakeVideoRepo struct {
 		url string
 		at  time.Time
 	}
+	gotMarkFailed struct {
+		id     int
+		reason string
+	}
+	gotMediaInfo struct {
+		id int
+		m  models.MediaInfo
+	}
+	gotMarkProcessed struct {
+		id  int
+		out models.ProcessedOutputs
+		at  time.Time
+	}
+	gotCreateDraft   *models.Video
+	gotDraftExpires  time.Time
+	gotCompleteDraft struct {
+		id, userID int
+		sha        string
+	}
+	gotDeletedDrafts []int
+	gotFindByContent struct {
+		userID   int
+		sha      string
+		exceptID int
+	}
+	gotSetContent struct {
+		id  int
+		sha string
+	}
 
 	// valores de retorno configurables
 	retCreate             models.Video
@@ -47,12 +81,42 @@ type fakeVideoRepo struct {
 	errUpdateStatus       error
 	errUpdateProcessedURL error
 	errUpdateThumbURL     error
+	errMarkFailed         error
+	errMarkProcessed      error
+	errMediaInfo          error
+	retExpiredDrafts      []models.Video
+	errCompleteDraft      error
+	retFindByContent      *models.Video // nil: ErrNotFound
+	errSetContent         error
+	retDeleteJobs         []string
+	gotSoftDelete         int
+	errSoftDelete         error
+	gotRestore            int
+	errRestore            error
+	gotDeletedBefore      time.Time
+	retTrash              []models.Video
+	gotUpdateMetadata     *models.Video
+	gotReplaceSource      struct {
+		v         models.Video
+		keepVotes bool
+		jobID     string
+	}
+	errReplaceSource error
+	gotReprocess     []int
+	errReprocess     map[int]error
+	gotReprocessF    models.ReprocessFilter
+	retReprocessF    []models.Video
 }
 
 func (f *fakeVideoRepo) Create(v models.Video) (models.Video, error) {
 	f.gotCreate = &v
 	return f.retCreate, f.errCreate
 }
+func (f *fakeVideoRepo) CreateWithJob(ctx context.Context, v models.Video, jobID string) (models.Video, error) {
+	f.gotCreate = &v
+	f.gotCreateJobID = jobID
+	return f.retCreate, f.errCreate
+}
 func (f *fakeVideoRepo) GetByID(ctx context.Context, id int) (*models.Video, error) {
 	f.gotGetByID = id
 	return f.retGetByID, f.errGetByID
@@ -69,6 +133,26 @@ func (f *fakeVideoRepo) Delete(ctx context.Context, id int) error {
 	f.gotDelete = id
 	return f.errDelete
 }
+func (f *fakeVideoRepo) DeleteWithJobs(ctx context.Context, id int, now time.Time) ([]string, error) {
+	f.gotDelete = id
+	return f.retDeleteJobs, f.errDelete
+}
+func (f *fakeVideoRepo) SoftDelete(ctx context.Context, id int, now time.Time) error {
+	f.gotSoftDelete = id
+	return f.errSoftDelete
+}
+func (f *fakeVideoRepo) Restore(ctx context.Context, id int) error {
+	f.gotRestore = id
+	return f.errRestore
+}
+func (f *fakeVideoRepo) ListTrash(ctx context.Context, userID, limit, offset int) ([]models.Video, error) {
+	f.gotListByUser.userID, f.gotListByUser.limit, f.gotListByUser.offset = userID, limit, offset
+	return f.retListByUser, f.errListByUser
+}
+func (f *fakeVideoRepo) DeletedBefore(ctx context.Context, t time.Time, limit int) ([]models.Video, error) {
+	f.gotDeletedBefore = t
+	return f.retTrash, nil
+}
 func (f *fakeVideoRepo) UpdateStatus(ctx context.Context, id int, status models.VideoStatus, updatedAt time.Time) error {
 	f.gotUpdateStatus = struct {
 		id     int
@@ -93,6 +177,75 @@ func (f *fakeVideoRepo) UpdateThumbURL(ctx context.Context, id int, url string,
 	}{id: id, url: url, at: updatedAt}
 	return f.errUpdateThumbURL
 }
+func (f *fakeVideoRepo) MarkFailed(ctx context.Context, id int, reason string, updatedAt time.Time) error {
+	f.gotMarkFailed.id, f.gotMarkFailed.reason = id, reason
+	return f.errMarkFailed
+}
+func (f *fakeVideoRepo) MarkProcessed(ctx context.Context, id int, out models.ProcessedOutputs, updatedAt time.Time) error {
+	f.gotMarkProcessed.id, f.gotMarkProcessed.out, f.gotMarkProcessed.at = id, out, updatedAt
+	return f.errMarkProcessed
+}
+func (f *fakeVideoRepo) UpdateMediaInfo(ctx context.Context, id int, m models.MediaInfo) error {
+	f.gotMediaInfo.id, f.gotMediaInfo.m = id, m
+	return f.errMediaInfo
+}
+func (f *fakeVideoRepo) UpdateMetadata(ctx context.Context, v models.Video) error {
+	f.gotUpdateMetadata = &v
+	return nil
+}
+func (f *fakeVideoRepo) ReplaceSource(ctx context.Context, v models.Video, keepVotes bool, jobID string, now time.Time) (models.Video, error) {
+	f.gotReplaceSource.v, f.gotReplaceSource.keepVotes, f.gotReplaceSource.jobID = v, keepVotes, jobID
+	if !keepVotes {
+		v.Votes = 0
+	}
+	v.Status = models.StatusUploaded
+	return v, f.errReplaceSource
+}
+func (f *fakeVideoRepo) Reprocess(ctx context.Context, id int, jobID string) (models.Video, error) {
+	if err := f.errReprocess[id]; err != nil {
+		return models.Video{}, err
+	}
+	f.gotReprocess = append(f.gotReprocess, id)
+	return models.Video{VideoID: id, Status: models.StatusProcessed}, nil
+}
+func (f *fakeVideoRepo) FindForReprocess(ctx context.Context, rf models.ReprocessFilter) ([]models.Video, error) {
+	f.gotReprocessF = rf
+	return f.retReprocessF, nil
+}
+func (f *fakeVideoRepo) JobIDs(ctx context.Context, id int) ([]string, error) {
+	return nil, nil
+}
+func (f *fakeVideoRepo) CreateDraft(ctx context.Context, v models.Video, expiresAt time.Time) (models.Video, error) {
+	f.gotCreateDraft, f.gotDraftExpires = &v, expiresAt
+	v.VideoID, v.Status = 50, models.StatusDraft
+	return v, f.errCreate
+}
+func (f *fakeVideoRepo) GetDraft(ctx context.Context, id, userID int, now time.Time) (*models.Video, error) {
+	return f.retGetByID, f.errGetByID
+}
+func (f *fakeVideoRepo) CompleteDraft(ctx context.Context, id, userID int, jobID, contentSHA256 string, now time.Time) (models.Video, error) {
+	f.gotCompleteDraft.id, f.gotCompleteDraft.userID, f.gotCompleteDraft.sha, f.gotCreateJobID = id, userID, contentSHA256, jobID
+	return models.Video{VideoID: id, UserID: userID, Status: models.StatusUploaded}, f.errCompleteDraft
+}
+func (f *fakeVideoRepo) ExpiredDrafts(ctx context.Context, now time.Time, limit int) ([]models.Video, error) {
+	return f.retExpiredDrafts, nil
+}
+func (f *fakeVideoRepo) DeleteExpiredDraft(ctx context.Context, id int, now time.Time) error {
+	f.gotDeletedDrafts = append(f.gotDeletedDrafts, id)
+	return nil
+}
+
+func (f *fakeVideoRepo) FindByContent(ctx context.Context, userID int, contentSHA256 string, exceptID int) (*models.Video, error) {
+	f.gotFindByContent.userID, f.gotFindByContent.sha, f.gotFindByContent.exceptID = userID, contentSHA256, exceptID
+	if f.retFindByContent == nil {
+		return nil, repos.ErrNotFound
+	}
+	return f.retFindByContent, nil
+}
+func (f *fakeVideoRepo) SetContentSHA256(ctx context.Context, id int, contentSHA256 string) error {
+	f.gotSetContent.id, f.gotSetContent.sha = id, contentSHA256
+	return f.errSetContent
+}
 
 // ----- Tests -----
 
@@ -100,7 +253,7 @@ func TestVideoService_Create_Success(t *testing.T) {
 	f := &fakeVideoRepo{
 		retCreate: models.Video{VideoID: 42, Title: "Tiro de 3", OriginURL: "/data/uploads/a.mp4", Status: models.StatusUploaded, UserID: 7},
 	}
-	s := NewVideoService(f)
+	s := NewVideoService(f, nil)
 
 	got, err := s.Create(7, "Tiro de 3", "/data/uploads/a.mp4")
 	if err != nil {
@@ -137,7 +290,7 @@ func TestVideoService_Create_Success(t *testing.T) {
 }
 
 func TestVideoService_Create_Validation(t *testing.T) {
-	s := NewVideoService(&fakeVideoRepo{})
+	s := NewVideoService(&fakeVideoRepo{}, nil)
 
 	_, err := s.Create(1, "", "/x.mp4")
 	if !errors.Is(err, ErrInvalidTitle) {
@@ -150,9 +303,148 @@ func TestVideoService_Create_Validation(t *testing.T) {
 	}
 }
 
+func TestVideoService_CreateWithJob_Success(t *testing.T) {
+	f := &fakeVideoRepo{
+		retCreate: models.Video{VideoID: 42, Title: "Tiro de 3", OriginURL: "videos/7/a.mp4", Status: models.StatusUploaded, UserID: 7},
+	}
+	s := NewVideoService(f, nil)
+
+	got, jobID, err := s.CreateWithJob(context.TODO(), 7, "Tiro de 3", "videos/7/a.mp4", "vertical", "abc123", models.VideoPatch{})
+	if err != nil {
+		t.Fatalf("CreateWithJob() error = %v", err)
+	}
+	if jobID == "" {
+		t.Fatal("jobID no debería ser vacío")
+	}
+	if f.gotCreateJobID != jobID {
+		t.Errorf("repo jobID = %q; want %q", f.gotCreateJobID, jobID)
+	}
+	if f.gotCreate == nil || f.gotCreate.Status != models.StatusUploaded || f.gotCreate.UserID != 7 || f.gotCreate.Profile != "vertical" || f.gotCreate.ContentSHA256 != "abc123" ||
+		f.gotCreate.Visibility != models.VisibilityPrivate {
+		t.Errorf("repo got video = %+v", f.gotCreate)
+	}
+	if got.VideoID != 42 {
+		t.Errorf("VideoID = %d; want 42", got.VideoID)
+	}
+}
+
+func TestVideoService_CreateWithJob_Validation(t *testing.T) {
+	f := &fakeVideoRepo{}
+	s := NewVideoService(f, nil)
+
+	if _, _, err := s.CreateWithJob(context.TODO(), 1, " ", "videos/1/a.mp4", "default", "", models.VideoPatch{}); !errors.Is(err, ErrInvalidTitle) {
+		t.Errorf("esperaba ErrInvalidTitle, got %v", err)
+	}
+	secret := models.Visibility("secret")
+	if _, _, err := s.CreateWithJob(context.TODO(), 1, "x", "videos/1/a.mp4", "default", "", models.VideoPatch{Visibility: &secret}); !errors.Is(err, ErrInvalidVisibility) {
+		t.Errorf("esperaba ErrInvalidVisibility, got %v", err)
+	}
+	when := "mañana"
+	if _, _, err := s.CreateWithJob(context.TODO(), 1, "x", "videos/1/a.mp4", "default", "", models.VideoPatch{PublishAt: &when}); !errors.Is(err, ErrInvalidPublishAt) {
+		t.Errorf("esperaba ErrInvalidPublishAt, got %v", err)
+	}
+	if f.gotCreate != nil {
+		t.Error("repo no debería ser llamado con datos inválidos")
+	}
+}
+
+func TestVideoService_CreateDraft_SetsExpiry(t *testing.T) {
+	f := &fakeVideoRepo{}
+	s := NewVideoService(f, nil)
+
+	unlisted, when := models.VisibilityUnlisted, "2026-03-01T12:00:00-05:00"
+	access := models.VideoPatch{Visibility: &unlisted, PublishAt: &when}
+	got, expiresAt, err := s.CreateDraft(context.TODO(), 7, "Clavada", "videos/7/x/a.mp4", "vertical", access, time.Hour)
+	if err != nil {
+		t.Fatalf("CreateDraft error = %v", err)
+	}
+	if got.VideoID != 50 || f.gotCreateDraft.Profile != "vertical" || f.gotCreateDraft.UserID != 7 {
+		t.Errorf("draft = %+v; repo got %+v", got, f.gotCreateDraft)
+	}
+	if !expiresAt.Equal(f.gotDraftExpires) || expiresAt.Sub(f.gotCreateDraft.UploadedAt) != time.Hour {
+		t.Errorf("expiresAt = %s; repo got %s (uploaded %s)", expiresAt, f.gotDraftExpires, f.gotCreateDraft.UploadedAt)
+	}
+	d := f.gotCreateDraft
+	if d.Visibility != models.VisibilityUnlisted || d.ShareToken == "" || d.PublishAt == nil || !d.PublishAt.Equal(time.Date(2026, 3, 1, 17, 0, 0, 0, time.UTC)) {
+		t.Errorf("acceso del draft = %q token %q publish_at %v", d.Visibility, d.ShareToken, d.PublishAt)
+	}
+
+	if _, _, err := s.CreateDraft(context.TODO(), 7, " ", "videos/7/x/a.mp4", "", models.VideoPatch{}, time.Hour); !errors.Is(err, ErrInvalidTitle) {
+		t.Errorf("err = %v; want ErrInvalidTitle", err)
+	}
+}
+
+func TestVideoService_CompleteDraft_ReturnsJobID(t *testing.T) {
+	f := &fakeVideoRepo{}
+	s := NewVideoService(f, nil)
+
+	v, jobID, err := s.CompleteDraft(context.TODO(), 7, 50, "")
+	if err != nil {
+		t.Fatalf("CompleteDraft error = %v", err)
+	}
+	if jobID == "" || jobID != f.gotCreateJobID || v.VideoID != 50 || f.gotCompleteDraft.userID != 7 {
+		t.Errorf("jobID = %q, video = %+v, repo got %+v", jobID, v, f.gotCompleteDraft)
+	}
+
+	f.errCompleteDraft = errors.New("draft expired")
+	if _, jobID, err := s.CompleteDraft(context.TODO(), 7, 50, ""); err == nil || jobID != "" {
+		t.Errorf("se esperaba error sin job; got %q, %v", jobID, err)
+	}
+}
+
+func TestVideoService_CreateWithJob_Duplicate(t *testing.T) {
+	f := &fakeVideoRepo{retFindByContent: &models.Video{VideoID: 3, UserID: 7}}
+	s := NewVideoService(f, nil)
+
+	_, jobID, err := s.CreateWithJob(context.TODO(), 7, "Tiro de 3", "videos/7/b.mp4", "default", "abc123", models.VideoPatch{})
+	var dup *DuplicateError
+	if !errors.As(err, &dup) || dup.Video.VideoID != 3 || jobID != "" {
+		t.Fatalf("err = %v, jobID = %q; want DuplicateError of video 3", err, jobID)
+	}
+	if f.gotCreate != nil {
+		t.Error("no debería crearse el video duplicado")
+	}
+	if f.gotFindByContent.userID != 7 || f.gotFindByContent.sha != "abc123" {
+		t.Errorf("FindByContent got %+v", f.gotFindByContent)
+	}
+}
+
+func TestVideoService_CompleteDraft_Duplicate(t *testing.T) {
+	f := &fakeVideoRepo{retFindByContent: &models.Video{VideoID: 3, UserID: 7}}
+	s := NewVideoService(f, nil)
+
+	var dup *DuplicateError
+	if _, _, err := s.CompleteDraft(context.TODO(), 7, 50, "abc123"); !errors.As(err, &dup) {
+		t.Fatalf("err = %v; want DuplicateError", err)
+	}
+	if f.gotFindByContent.exceptID != 50 || f.gotCompleteDraft.id != 0 {
+		t.Errorf("FindByContent got %+v, CompleteDraft got %+v", f.gotFindByContent, f.gotCompleteDraft)
+	}
+}
+
+func TestVideoService_RecordContent(t *testing.T) {
+	f := &fakeVideoRepo{}
+	s := NewVideoService(f, nil)
+
+	if err := s.RecordContent(context.TODO(), 7, 50, "abc123"); err != nil {
+		t.Fatalf("RecordContent error = %v", err)
+	}
+	if f.gotSetContent.id != 50 || f.gotSetContent.sha != "abc123" {
+		t.Errorf("SetContentSHA256 got %+v", f.gotSetContent)
+	}
+
+	// another upload of the same content got the index first
+	f.errSetContent = repos.ErrDuplicate
+	f.retFindByContent = &models.Video{VideoID: 3, UserID: 7}
+	var dup *DuplicateError
+	if err := s.RecordContent(context.TODO(), 7, 50, "abc123"); !errors.As(err, &dup) || dup.Video.VideoID != 3 {
+		t.Errorf("err = %v; want DuplicateError of video 3", err)
+	}
+}
+
 func TestVideoService_UpdateStatus_PassesParams(t *testing.T) {
 	f := &fakeVideoRepo{}
-	s := NewVideoService(f)
+	s := NewVideoService(f, nil)
 
 	ctx := context.TODO()
 	if err := s.UpdateStatus(ctx, 10, models.StatusProcessing); err != nil {
@@ -172,7 +464,7 @@ func TestVideoService_UpdateStatus_PassesParams(t *testing.T) {
 
 func TestVideoService_List_NormalizesBounds(t *testing.T) {
 	f := &fakeVideoRepo{retList: []models.Video{}}
-	s := NewVideoService(f)
+	s := NewVideoService(f, nil)
 
 	ctx := context.TODO()
 
@@ -197,7 +489,7 @@ func TestVideoService_List_NormalizesBounds(t *testing.T) {
 
 func TestVideoService_ListByUser_NormalizesBoundsAndUser(t *testing.T) {
 	f := &fakeVideoRepo{retListByUser: []models.Video{}}
-	s := NewVideoService(f)
+	s := NewVideoService(f, nil)
 
 	ctx := context.TODO()
 
@@ -216,7 +508,7 @@ func TestVideoService_ListByUser_NormalizesBoundsAndUser(t *testing.T) {
 func TestVideoService_GetByID_PassesThrough(t *testing.T) {
 	want := &models.Video{VideoID: 5, Title: "X"}
 	f := &fakeVideoRepo{retGetByID: want}
-	s := NewVideoService(f)
+	s := NewVideoService(f, nil)
 
 	got, err := s.GetByID(context.TODO(), 5)
 	if err != nil {
@@ -232,7 +524,7 @@ func TestVideoService_GetByID_PassesThrough(t *testing.T) {
 
 func TestVideoService_Delete_PassesThrough(t *testing.T) {
 	f := &fakeVideoRepo{}
-	s := NewVideoService(f)
+	s := NewVideoService(f, nil)
 
 	if err := s.Delete(context.TODO(), 77); err != nil {
 		t.Fatalf("Delete error = %v", err)
@@ -242,9 +534,303 @@ func TestVideoService_Delete_PassesThrough(t *testing.T) {
 	}
 }
 
+func TestVideoService_GetFor_OwnerOrAdmin(t *testing.T) {
+	f := &fakeVideoRepo{retGetByID: &models.Video{VideoID: 5, UserID: 7}}
+	s := NewVideoService(f, nil)
+
+	cases := []struct {
+		name  string
+		actor Actor
+		want  error
+	}{
+		{"dueño", Actor{UserID: 7}, nil},
+		{"otro usuario", Actor{UserID: 8}, ErrForbidden},
+		{"admin", Actor{UserID: 8, Admin: true}, nil},
+	}
+	for _, c := range cases {
+		v, err := s.GetFor(context.TODO(), c.actor, 5)
+		if !errors.Is(err, c.want) {
+			t.Errorf("%s: err = %v; want %v", c.name, err, c.want)
+		}
+		if (v != nil) != (c.want == nil) {
+			t.Errorf("%s: video = %+v", c.name, v)
+		}
+	}
+
+	f.retGetByID, f.errGetByID = nil, repos.ErrNotFound
+	if _, err := s.GetFor(context.TODO(), Actor{UserID: 7, Admin: true}, 5); !errors.Is(err, repos.ErrNotFound) {
+		t.Errorf("err = %v; want ErrNotFound", err)
+	}
+}
+
+func TestVideoService_DeleteFor_MovesToTrash(t *testing.T) {
+	f := &fakeVideoRepo{retGetByID: &models.Video{VideoID: 5, UserID: 7}}
+	s := NewVideoService(f, nil)
+
+	if err := s.DeleteFor(context.TODO(), Actor{UserID: 8}, 5); !errors.Is(err, ErrForbidden) {
+		t.Fatalf("err = %v; want ErrForbidden", err)
+	}
+	if f.gotSoftDelete != 0 {
+		t.Error("no debería borrarse el video de otro usuario")
+	}
+	if err := s.DeleteFor(context.TODO(), Actor{UserID: 7}, 5); err != nil || f.gotSoftDelete != 5 || f.gotDelete != 0 {
+		t.Errorf("err = %v, soft delete %d, delete %d; want only soft delete of 5", err, f.gotSoftDelete, f.gotDelete)
+	}
+
+	f.errSoftDelete = repos.ErrInContest
+	if err := s.DeleteFor(context.TODO(), Actor{UserID: 7}, 5); !errors.Is(err, repos.ErrInContest) {
+		t.Errorf("err = %v; want ErrInContest", err)
+	}
+
+	deleted := time.Now()
+	f.retGetByID.DeletedAt = &deleted
+	if _, err := s.GetFor(context.TODO(), Actor{UserID: 7}, 5); !errors.Is(err, repos.ErrNotFound) {
+		t.Errorf("GetFor en la papelera: err = %v; want ErrNotFound", err)
+	}
+}
+
+func TestVideoService_RestoreFor(t *testing.T) {
+	deleted := time.Now().Add(-2 * time.Hour)
+	f := &fakeVideoRepo{retGetByID: &models.Video{VideoID: 5, UserID: 7, DeletedAt: &deleted, ContentSHA256: "abc123"}}
+	s := NewVideoService(f, nil)
+
+	if _, err := s.RestoreFor(context.TODO(), Actor{UserID: 7}, 5, time.Hour); !errors.Is(err, ErrTrashExpired) {
+		t.Errorf("fuera de plazo: err = %v; want ErrTrashExpired", err)
+	}
+	if _, err := s.RestoreFor(context.TODO(), Actor{UserID: 8}, 5, 24*time.Hour); !errors.Is(err, ErrForbidden) {
+		t.Errorf("otro usuario: err = %v; want ErrForbidden", err)
+	}
+	v, err := s.RestoreFor(context.TODO(), Actor{UserID: 7}, 5, 24*time.Hour)
+	if err != nil || f.gotRestore != 5 || v.DeletedAt != nil {
+		t.Fatalf("err = %v, repo got %d, video %+v", err, f.gotRestore, v)
+	}
+
+	// the same content was uploaded again while the video was in the trash
+	f.retGetByID.DeletedAt = &deleted
+	f.errRestore = repos.ErrDuplicate
+	f.retFindByContent = &models.Video{VideoID: 9, UserID: 7}
+	var dup *DuplicateError
+	if _, err := s.RestoreFor(context.TODO(), Actor{UserID: 7}, 5, 24*time.Hour); !errors.As(err, &dup) || dup.Video.VideoID != 9 {
+		t.Errorf("err = %v; want DuplicateError of video 9", err)
+	}
+
+	f.retGetByID.DeletedAt = nil
+	if _, err := s.RestoreFor(context.TODO(), Actor{UserID: 7}, 5, 24*time.Hour); !errors.Is(err, ErrNotInTrash) {
+		t.Errorf("no borrado: err = %v; want ErrNotInTrash", err)
+	}
+}
+
+func TestVideoService_PurgeTrash_RemovesObjects(t *testing.T) {
+	store, err := storage.NewLocal(t.TempDir(), "http://api/files", "secret")
+	if err != nil {
+		t.Fatalf("NewLocal: %v", err)
+	}
+	ctx := context.Background()
+	objects := map[string]string{
+		"videos/7/u1/clip.mp4":         store.GetUploadsBucket(),
+		"work/job-1/output.mp4":        store.GetUploadsBucket(),
+		"processed/5/job-1/output.mp4": store.GetProcessedBucket(),
+		"processed/5/job-1/hls/a.m3u8": store.GetProcessedBucket(),
+		"videos/7/u2/other.mp4":        store.GetUploadsBucket(),
+	}
+	for key, bucket := range objects {
+		if err := store.UploadFile(ctx, key, bucket, strings.NewReader("x")); err != nil {
+			t.Fatalf("UploadFile %s: %v", key, err)
+		}
+	}
+	f := &fakeVideoRepo{
+		retTrash:      []models.Video{{VideoID: 5, UserID: 7, OriginURL: "videos/7/u1/clip.mp4"}},
+		retDeleteJobs: []string{"job-1"},
+	}
+	s := NewVideoService(f, store)
+
+	before := time.Now().Add(-time.Hour)
+	n, err := s.PurgeTrash(ctx, before)
+	if err != nil || n != 1 || f.gotDelete != 5 || !f.gotDeletedBefore.Equal(before) {
+		t.Fatalf("PurgeTrash = %d, %v; repo deleted %d before %s", n, err, f.gotDelete, f.gotDeletedBefore)
+	}
+	for key, bucket := range objects {
+		ok, _ := store.FileExists(ctx, bucket, key)
+		if want := key == "videos/7/u2/other.mp4"; ok != want {
+			t.Errorf("%s existe = %t; want %t", key, ok, want)
+		}
+	}
+}
+
+func TestVideoService_UpdateFor(t *testing.T) {
+	f := &fakeVideoRepo{retGetByID: &models.Video{VideoID: 5, UserID: 7, Title: "Clavada", Description: "antes", Visibility: models.VisibilityPublic}}
+	s := NewVideoService(f, nil)
+
+	title, tags, vis := "  Clavada final ", []string{" Dunk", "final", "dunk", ""}, models.VisibilityUnlisted
+	v, err := s.UpdateFor(context.TODO(), Actor{UserID: 7}, 5, models.VideoPatch{Title: &title, Tags: &tags, Visibility: &vis})
+	if err != nil {
+		t.Fatalf("UpdateFor error = %v", err)
+	}
+	// an unlisted video gets a share token
+	if len(v.ShareToken) < 20 {
+		t.Errorf("share token = %q", v.ShareToken)
+	}
+	want := models.Video{VideoID: 5, UserID: 7, Title: "Clavada final", Description: "antes", Tags: []string{"dunk", "final"}, Visibility: vis,
+		ShareToken: v.ShareToken}
+	if !reflect.DeepEqual(*v, want) || f.gotUpdateMetadata == nil || !reflect.DeepEqual(*f.gotUpdateMetadata, want) {
+		t.Errorf("video = %+v, repo got %+v; want %+v", v, f.gotUpdateMetadata, want)
+	}
+
+	// the token is kept across visibility changes; publish_at schedules the video
+	token := v.ShareToken
+	public, publishAt := models.VisibilityPublic, "2026-11-01T10:00:00-05:00"
+	if v, err = s.UpdateFor(context.TODO(), Actor{UserID: 7}, 5, models.VideoPatch{Visibility: &public, PublishAt: &publishAt}); err != nil {
+		t.Fatalf("UpdateFor error = %v", err)
+	}
+	if v.ShareToken != token || v.PublishAt == nil || !v.PublishAt.Equal(time.Date(2026, 11, 1, 15, 0, 0, 0, time.UTC)) {
+		t.Errorf("token %q (want %q), publish_at %v", v.ShareToken, token, v.PublishAt)
+	}
+	now := ""
+	if v, err = s.UpdateFor(context.TODO(), Actor{UserID: 7}, 5, models.VideoPatch{PublishAt: &now}); err != nil || v.PublishAt != nil {
+		t.Errorf("publish_at vacío: %v, %v; want nil", v.PublishAt, err)
+	}
+
+	empty, bad, badDate := " ", models.Visibility("friends"), "mañana"
+	many := strings.Split("a b c d e f g h i j k", " ")
+	cases := []struct {
+		name  string
+		patch models.VideoPatch
+		want  error
+	}{
+		{"título vacío", models.VideoPatch{Title: &empty}, ErrInvalidTitle},
+		{"demasiadas etiquetas", models.VideoPatch{Tags: &many}, ErrInvalidTags},
+		{"visibilidad desconocida", models.VideoPatch{Visibility: &bad}, ErrInvalidVisibility},
+		{"fecha inválida", models.VideoPatch{PublishAt: &badDate}, ErrInvalidPublishAt},
+	}
+	for _, c := range cases {
+		f.gotUpdateMetadata = nil
+		if _, err := s.UpdateFor(context.TODO(), Actor{UserID: 7}, 5, c.patch); !errors.Is(err, c.want) || f.gotUpdateMetadata != nil {
+			t.Errorf("%s: err = %v, repo got %+v; want %v", c.name, err, f.gotUpdateMetadata, c.want)
+		}
+	}
+	if _, err := s.UpdateFor(context.TODO(), Actor{UserID: 8}, 5, models.VideoPatch{Title: &title}); !errors.Is(err, ErrForbidden) {
+		t.Errorf("otro usuario: err = %v; want ErrForbidden", err)
+	}
+}
+
+func TestVideoService_ReplaceSourceFor(t *testing.T) {
+	store, err := storage.NewLocal(t.TempDir(), "http://api/files", "secret")
+	if err != nil {
+		t.Fatalf("NewLocal: %v", err)
+	}
+	ctx := context.Background()
+	for _, key := range []string{"videos/7/u1/old.mp4", "videos/7/u2/new.mp4"} {
+		if err := store.UploadFile(ctx, key, store.GetUploadsBucket(), strings.NewReader(key)); err != nil {
+			t.Fatalf("UploadFile %s: %v", key, err)
+		}
+	}
+	f := &fakeVideoRepo{retGetByID: &models.Video{VideoID: 5, UserID: 7, Status: models.StatusProcessing, Votes: 4,
+		OriginURL: "videos/7/u1/old.mp4", Profile: "default"}}
+	s := NewVideoService(f, store)
+
+	if _, _, err := s.ReplaceSourceFor(ctx, Actor{UserID: 7}, 5, "videos/7/u2/new.mp4", "", "def456", false); !errors.Is(err, repos.ErrProcessing) {
+		t.Fatalf("en proceso: err = %v; want ErrProcessing", err)
+	}
+
+	f.retGetByID.Status = models.StatusProcessed
+	v, jobID, err := s.ReplaceSourceFor(ctx, Actor{UserID: 1, Admin: true}, 5, "videos/7/u2/new.mp4", "", "def456", false)
+	if err != nil || jobID == "" {
+		t.Fatalf("ReplaceSourceFor = %q, %v", jobID, err)
+	}
+	got := f.gotReplaceSource
+	if got.v.OriginURL != "videos/7/u2/new.mp4" || got.v.ContentSHA256 != "def456" || got.v.Profile != "default" || got.keepVotes || got.jobID != jobID {
+		t.Errorf("repo got %+v", got)
+	}
+	if v.VideoID != 5 || v.Votes != 0 || v.Status != models.StatusUploaded {
+		t.Errorf("video = %+v; want id 5 uploaded without votes", v)
+	}
+	if ok, _ := store.FileExists(ctx, store.GetUploadsBucket(), "videos/7/u1/old.mp4"); ok {
+		t.Error("el archivo original anterior debería haberse eliminado")
+	}
+	if ok, _ := store.FileExists(ctx, store.GetUploadsBucket(), "videos/7/u2/new.mp4"); !ok {
+		t.Error("el archivo nuevo no debería eliminarse")
+	}
+
+	// another video of the owner already has the new content
+	f.retFindByContent = &models.Video{VideoID: 9, UserID: 7}
+	var dup *DuplicateError
+	if _, _, err := s.ReplaceSourceFor(ctx, Actor{UserID: 7}, 5, "videos/7/u3/copy.mp4", "", "abc123", true); !errors.As(err, &dup) || dup.Video.VideoID != 9 {
+		t.Errorf("err = %v; want DuplicateError of video 9", err)
+	}
+}
+
+func TestVideoService_ReprocessFor(t *testing.T) {
+	f := &fakeVideoRepo{retGetByID: &models.Video{VideoID: 5, UserID: 7, Status: models.StatusProcessed}}
+	s := NewVideoService(f, nil)
+
+	if _, _, err := s.ReprocessFor(context.TODO(), Actor{UserID: 8}, 5); !errors.Is(err, ErrForbidden) || len(f.gotReprocess) != 0 {
+		t.Errorf("otro usuario: err = %v, repo got %v; want ErrForbidden", err, f.gotReprocess)
+	}
+	v, jobID, err := s.ReprocessFor(context.TODO(), Actor{UserID: 7}, 5)
+	if err != nil || jobID == "" || v.Status != models.StatusProcessed || !reflect.DeepEqual(f.gotReprocess, []int{5}) {
+		t.Errorf("ReprocessFor = %+v, %q, %v; repo got %v", v, jobID, err, f.gotReprocess)
+	}
+	f.errReprocess = map[int]error{5: repos.ErrProcessing}
+	if _, _, err := s.ReprocessFor(context.TODO(), Actor{UserID: 7}, 5); !errors.Is(err, repos.ErrProcessing) {
+		t.Errorf("con un trabajo pendiente: err = %v; want ErrProcessing", err)
+	}
+}
+
+func TestVideoService_ReprocessBulk(t *testing.T) {
+	f := &fakeVideoRepo{
+		retReprocessF: []models.Video{{VideoID: 1}, {VideoID: 2}, {VideoID: 3}},
+		errReprocess:  map[int]error{2: repos.ErrProcessing},
+	}
+	s := NewVideoService(f, nil)
+
+	if _, err := s.ReprocessBulk(context.TODO(), Actor{UserID: 7}, models.ReprocessFilter{}); !errors.Is(err, ErrForbidden) {
+		t.Errorf("no admin: err = %v; want ErrForbidden", err)
+	}
+	admin := Actor{UserID: 1, Admin: true}
+	now := time.Now()
+	for name, bad := range map[string]models.ReprocessFilter{
+		"estado":         {Status: models.StatusProcessing},
+		"rango vacío":    {From: now, To: now},
+		"rango al revés": {From: now, To: now.Add(-time.Hour)},
+	} {
+		if _, err := s.ReprocessBulk(context.TODO(), admin, bad); !errors.Is(err, ErrInvalidFilter) {
+			t.Errorf("%s: err = %v; want ErrInvalidFilter", name, err)
+		}
+	}
+
+	res, err := s.ReprocessBulk(context.TODO(), admin, models.ReprocessFilter{Profile: "default", Limit: 10000})
+	if err != nil {
+		t.Fatalf("ReprocessBulk error = %v", err)
+	}
+	if f.gotReprocessF.Limit != maxReprocessBatch || f.gotReprocessF.Profile != "default" {
+		t.Errorf("repo got filter %+v", f.gotReprocessF)
+	}
+	if len(res.Jobs) != 2 || res.Jobs[0].VideoID != 1 || res.Jobs[1].VideoID != 3 || !reflect.DeepEqual(res.Skipped, []int{2}) {
+		t.Errorf("result = %+v; want jobs for 1 and 3, 2 skipped", res)
+	}
+}
+
+func TestVideoService_ListFor(t *testing.T) {
+	f := &fakeVideoRepo{retList: []models.Video{}, retListByUser: []models.Video{}}
+	s := NewVideoService(f, nil)
+
+	if _, err := s.ListFor(context.TODO(), Actor{UserID: 7}, 0, 10, 0); err != nil || f.gotListByUser.userID != 7 {
+		t.Errorf("sin user_id: err = %v, repo got user %d; want 7", err, f.gotListByUser.userID)
+	}
+	if _, err := s.ListFor(context.TODO(), Actor{UserID: 7}, 8, 10, 0); !errors.Is(err, ErrForbidden) {
+		t.Errorf("otro usuario: err = %v; want ErrForbidden", err)
+	}
+	if _, err := s.ListFor(context.TODO(), Actor{UserID: 1, Admin: true}, 8, 10, 0); err != nil || f.gotListByUser.userID != 8 {
+		t.Errorf("admin: err = %v, repo got user %d; want 8", err, f.gotListByUser.userID)
+	}
+	if _, err := s.ListFor(context.TODO(), Actor{UserID: 1, Admin: true}, 0, 10, 0); err != nil || f.gotList.limit != 10 {
+		t.Errorf("admin sin user_id: err = %v, repo got %+v; want List", err, f.gotList)
+	}
+}
+
 func TestVideoService_UpdateProcessedURL_PassesParams(t *testing.T) {
 	f := &fakeVideoRepo{}
-	s := NewVideoService(f)
+	s := NewVideoService(f, nil)
 
 	err := s.UpdateProcessedURL(context.TODO(), 11, "http://api/static/processed/a.mp4")
 	if err != nil {
@@ -263,7 +849,7 @@ func TestVideoService_UpdateProcessedURL_PassesParams(t *testing.T) {
 
 func TestVideoService_UpdateThumbURL_PassesParams(t *testing.T) {
 	f := &fakeVideoRepo{}
-	s := NewVideoService(f)
+	s := NewVideoService(f, nil)
 
 	err := s.UpdateThumbURL(context.TODO(), 12, "http://api/static/thumbs/a.jpg")
 	if err != nil {
@@ -280,6 +866,38 @@ func TestVideoService_UpdateThumbURL_PassesParams(t *testing.T) {
 	}
 }
 
+func TestVideoService_MarkFailed_PassesReason(t *testing.T) {
+	f := &fakeVideoRepo{}
+	s := NewVideoService(f, nil)
+
+	if err := s.MarkFailed(context.TODO(), 13, "duración inválida"); err != nil {
+		t.Fatalf("MarkFailed error = %v", err)
+	}
+	if f.gotMarkFailed.id != 13 || f.gotMarkFailed.reason != "duración inválida" {
+		t.Errorf("repo got = %+v", f.gotMarkFailed)
+	}
+}
+
+func TestVideoService_MarkProcessed_PassesOutputs(t *testing.T) {
+	f := &fakeVideoRepo{}
+	s := NewVideoService(f, nil)
+
+	out := models.ProcessedOutputs{
+		ProcessedURL: "https://cdn/p.mp4",
+		ThumbURL:     "https://cdn/t.jpg",
+		Thumbnails:   models.Thumbnails{"small": "https://cdn/t_small.jpg", "large": "https://cdn/t.jpg"},
+	}
+	if err := s.MarkProcessed(context.TODO(), 21, out); err != nil {
+		t.Fatalf("MarkProcessed error = %v", err)
+	}
+	if f.gotMarkProcessed.id != 21 || !reflect.DeepEqual(f.gotMarkProcessed.out, out) {
+		t.Errorf("repo got = %+v", f.gotMarkProcessed)
+	}
+	if f.gotMarkProcessed.at.IsZero() {
+		t.Error("updatedAt no debería ser cero")
+	}
+}
+
 // (Opcional) errores propagados desde el repo:
 func TestVideoService_RepoErrorsPropagate(t *testing.T) {
 	repoErr := errors.New("repo boom")
@@ -291,7 +909,7 @@ func TestVideoService_RepoErrorsPropagate(t *testing.T) {
 		errUpdateProcessedURL: repoErr,
 		errUpdateThumbURL:     repoErr,
 	}
-	s := NewVideoService(f)
+	s := NewVideoService(f, nil)
 	ctx := context.TODO()
 
 	if _, err := s.List(ctx, 10, 0); !errors.Is(err, repoErr) {
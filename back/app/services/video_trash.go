@@ -0,0 +1,116 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"ISIS4426-Entrega1/app/models"
+	"ISIS4426-Entrega1/app/repos"
+	"ISIS4426-Entrega1/internal/storage"
+)
+
+var (
+	ErrNotInTrash   = errors.New("video is not in the trash")
+	ErrTrashExpired = errors.New("video trash retention expired")
+)
+
+// TrashFor lists the videos a moved to the trash
+func (s *VideoService) TrashFor(ctx context.Context, a Actor, limit, offset int) ([]models.Video, error) {
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	return s.repo.ListTrash(ctx, a.UserID, limit, offset)
+}
+
+// RestoreFor takes video id out of the trash, provided it was deleted less
+// than retention ago. A *DuplicateError means the user uploaded the same
+// content again meanwhile.
+func (s *VideoService) RestoreFor(ctx context.Context, a Actor, id int, retention time.Duration) (*models.Video, error) {
+	v, err := s.getAny(ctx, a, id)
+	if err != nil {
+		return nil, err
+	}
+	if v.DeletedAt == nil {
+		return nil, ErrNotInTrash
+	}
+	if time.Since(*v.DeletedAt) >= retention {
+		return nil, ErrTrashExpired
+	}
+	if err := s.repo.Restore(ctx, id); err != nil {
+		return nil, s.checkDuplicate(ctx, v.UserID, v.ContentSHA256, id, err)
+	}
+	v.DeletedAt = nil
+	return v, nil
+}
+
+// RunTrashPurge purges the videos deleted more than retention ago every
+// interval until ctx is cancelled
+func (s *VideoService) RunTrashPurge(ctx context.Context, retention, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+		if n, err := s.PurgeTrash(ctx, time.Now().Add(-retention)); err != nil {
+			log.Printf("[api] trash purge error: %v", err)
+		} else if n > 0 {
+			log.Printf("[api] trash purge removed %d video(s)", n)
+		}
+	}
+}
+
+// PurgeTrash deletes for good one batch of videos moved to the trash before
+// t: the rows with their votes and jobs, then their stored objects.
+func (s *VideoService) PurgeTrash(ctx context.Context, t time.Time) (int, error) {
+	videos, err := s.repo.DeletedBefore(ctx, t, 100)
+	if err != nil {
+		return 0, fmt.Errorf("list trash: %w", err)
+	}
+	purged := 0
+	for _, v := range videos {
+		jobIDs, err := s.repo.DeleteWithJobs(ctx, v.VideoID, time.Now())
+		if errors.Is(err, repos.ErrNotFound) {
+			continue // restored or purged by another instance
+		}
+		if err != nil {
+			log.Printf("[api] trash purge: cannot delete video %d: %v", v.VideoID, err)
+			continue
+		}
+		s.removeObjects(ctx, v, jobIDs)
+		purged++
+	}
+	return purged, nil
+}
+
+// removeObjects deletes the original of v, the intermediate files of its
+// jobs and every output published under processed/{id}/. The video is gone
+// already, so failures are only logged: leftovers are never served again.
+func (s *VideoService) removeObjects(ctx context.Context, v models.Video, jobIDs []string) {
+	if s.store == nil {
+		return
+	}
+	uploads := s.store.GetUploadsBucket()
+	var errs []error
+	if v.OriginURL != "" {
+		if err := s.store.DeleteFile(ctx, uploads, v.OriginURL); err != nil && !storage.IsNotFound(err) {
+			errs = append(errs, err)
+		}
+	}
+	for _, jobID := range jobIDs {
+		// staged by the worker, see workKeyPrefix in cmd/worker
+		errs = append(errs, s.store.DeletePrefix(ctx, uploads, "work/"+jobID+"/"))
+	}
+	errs = append(errs, s.store.DeletePrefix(ctx, s.store.GetProcessedBucket(), fmt.Sprintf("processed/%d/", v.VideoID)))
+	if err := errors.Join(errs...); err != nil {
+		log.Printf("[api] delete video_id=%d: cannot remove stored objects: %v", v.VideoID, err)
+	}
+}
@@ -2,23 +2,20 @@ package main
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
-	"io"
 	"log"
 	"os"
 	"os/exec"
-	"path/filepath"
+	"os/signal"
+	"strconv"
+	"syscall"
 	"time"
 
 	"ISIS4426-Entrega1/app/async"
-	"ISIS4426-Entrega1/app/models"
 	"ISIS4426-Entrega1/app/repos"
 	"ISIS4426-Entrega1/app/services"
-	"ISIS4426-Entrega1/internal/s3client"
-
-	"github.com/aws/aws-sdk-go-v2/config"
-	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"ISIS4426-Entrega1/internal/media"
+	"ISIS4426-Entrega1/internal/storage"
 )
 
 func getenv(k, d string) string {
@@ -28,265 +25,150 @@ func getenv(k, d string) string {
 	return d
 }
 
-func run(cmd *exec.Cmd) error {
-	log.Printf("[worker] exec start cmd=%q", cmd.String())
-	clone := exec.Command(cmd.Path, cmd.Args[1:]...)
-	clone.Env = cmd.Env
-	clone.Dir = cmd.Dir
-
-	log.Printf("[worker] Running: %s", clone.String())
-	out, err := clone.CombinedOutput()
-	if err != nil {
-		return fmt.Errorf("command failed: %s: %w\noutput:\n%s", clone.String(), err, string(out))
+func getenvInt(k string, d int) int {
+	if v, err := strconv.Atoi(os.Getenv(k)); err == nil && v > 0 {
+		return v
 	}
-	return nil
+	return d
 }
 
-func processVideo(ctx context.Context, p async.VideoProcessingPayload, svc *services.VideoService, status *async.SQSEnqueuer, s3Client *s3client.S3Client) error {
-	_ = status.SetStatus(ctx, p.JobID, "processing:downloading", 24*time.Hour)
-
-	// Create temporary work dir
-	workDir := filepath.Join("/tmp", fmt.Sprintf("video_%d_%s", p.VideoID, p.JobID))
-	if err := os.MkdirAll(workDir, 0o755); err != nil {
-		_ = status.SetStatus(ctx, p.JobID, "failed:create_workdir", 24*time.Hour)
-		return fmt.Errorf("create workdir: %w", err)
-	}
-	defer os.RemoveAll(workDir)
-
-	originalFile := filepath.Join(workDir, "original.mp4")
-	reader, err := s3Client.DownloadFromUploads(ctx, p.InputPath)
-	if err != nil {
-		_ = status.SetStatus(ctx, p.JobID, "failed:download_original", 24*time.Hour)
-		return fmt.Errorf("download original: %w", err)
-	}
-	defer reader.Close()
-
-	outFile, err := os.Create(originalFile)
-	if err != nil {
-		_ = status.SetStatus(ctx, p.JobID, "failed:create_temp_file", 24*time.Hour)
-		return fmt.Errorf("create temp file: %w", err)
-	}
-	if _, err := io.Copy(outFile, reader); err != nil {
-		outFile.Close()
-		_ = status.SetStatus(ctx, p.JobID, "failed:save_temp_file", 24*time.Hour)
-		return fmt.Errorf("save temp file: %w", err)
-	}
-	outFile.Close()
-
-	_ = status.SetStatus(ctx, p.JobID, "processing:trim", 24*time.Hour)
-
-	mainTrim := filepath.Join(workDir, "video_trim.mp4")
-	scaledMain := filepath.Join(workDir, "video_720p.mp4")
-	intro := "/assets/intro.mp4"
-	outro := "/assets/outro.mp4"
-	intro720 := filepath.Join(workDir, "intro_720.mp4")
-	outro720 := filepath.Join(workDir, "outro_720.mp4")
-	final := filepath.Join(workDir, "final.mp4")
-	noaudio := filepath.Join(workDir, "final_noaudio.mp4")
-	thumb := filepath.Join(workDir, "thumb.jpg")
-
-	if err := run(trimTo30(originalFile, mainTrim)); err != nil {
-		_ = status.SetStatus(ctx, p.JobID, "failed:trim", 24*time.Hour)
-		return fmt.Errorf("trim: %w", err)
-	}
-	if err := run(extractThumbnail(originalFile, thumb)); err != nil {
-		_ = status.SetStatus(ctx, p.JobID, "failed:thumb", 24*time.Hour)
-		return fmt.Errorf("thumb: %w", err)
-	}
-
-	_ = status.SetStatus(ctx, p.JobID, "processing:scale", 24*time.Hour)
-	if err := run(to720p16x9(mainTrim, scaledMain)); err != nil {
-		_ = status.SetStatus(ctx, p.JobID, "failed:scale_main", 24*time.Hour)
-		return fmt.Errorf("scale main: %w", err)
-	}
-	if err := run(to720p16x9(intro, intro720)); err != nil {
-		_ = status.SetStatus(ctx, p.JobID, "failed:scale_intro", 24*time.Hour)
-		return fmt.Errorf("scale intro: %w", err)
-	}
-	if err := run(to720p16x9(outro, outro720)); err != nil {
-		_ = status.SetStatus(ctx, p.JobID, "failed:scale_outro", 24*time.Hour)
-		return fmt.Errorf("scale outro: %w", err)
-	}
-
-	_ = status.SetStatus(ctx, p.JobID, "processing:concat", 24*time.Hour)
-	if err := run(concatIntroMainOutro(intro720, scaledMain, outro720, final)); err != nil {
-		_ = status.SetStatus(ctx, p.JobID, "failed:concat", 24*time.Hour)
-		return fmt.Errorf("concat: %w", err)
+func getenvDuration(k string, d time.Duration) time.Duration {
+	if v, err := time.ParseDuration(os.Getenv(k)); err == nil && v > 0 {
+		return v
 	}
+	return d
+}
 
-	cmdNoAudio := exec.Command("ffmpeg", "-y", "-i", final, "-an", "-c:v", "copy", noaudio)
-	if err := run(cmdNoAudio); err != nil {
-		_ = status.SetStatus(ctx, p.JobID, "failed:mute", 24*time.Hour)
-		return fmt.Errorf("mute: %w", err)
-	}
+// run executes cmd bound to ctx, so ffmpeg is killed when the job is cancelled
+func run(ctx context.Context, cmd *exec.Cmd) error {
+	_, err := output(ctx, cmd)
+	return err
+}
 
-	_ = status.SetStatus(ctx, p.JobID, "processing:uploading", 24*time.Hour)
-	processedKey := fmt.Sprintf("processed/%d_final_noaudio.mp4", p.VideoID)
-	processedFile, err := os.Open(noaudio)
-	if err != nil {
-		_ = status.SetStatus(ctx, p.JobID, "failed:open_processed", 24*time.Hour)
-		return fmt.Errorf("open processed: %w", err)
-	}
-	defer processedFile.Close()
-	if err := s3Client.UploadToProcessed(ctx, processedKey, processedFile); err != nil {
-		_ = status.SetStatus(ctx, p.JobID, "failed:upload_processed", 24*time.Hour)
-		return fmt.Errorf("upload processed: %w", err)
-	}
+// output is run for commands whose output is needed, such as measurements
+// ffmpeg prints on stderr. It returns the combined output.
+func output(ctx context.Context, cmd *exec.Cmd) ([]byte, error) {
+	log.Printf("[worker] exec start cmd=%q", cmd.String())
+	clone := exec.CommandContext(ctx, cmd.Path, cmd.Args[1:]...)
+	clone.Env = cmd.Env
+	clone.Dir = cmd.Dir
 
-	thumbKey := fmt.Sprintf("processed/%d_thumb.jpg", p.VideoID)
-	thumbFile, err := os.Open(thumb)
+	log.Printf("[worker] Running: %s", clone.String())
+	out, err := clone.CombinedOutput()
 	if err != nil {
-		_ = status.SetStatus(ctx, p.JobID, "failed:open_thumb", 24*time.Hour)
-		return fmt.Errorf("open thumb: %w", err)
-	}
-	defer thumbFile.Close()
-	if err := s3Client.UploadToProcessed(ctx, thumbKey, thumbFile); err != nil {
-		_ = status.SetStatus(ctx, p.JobID, "failed:upload_thumb", 24*time.Hour)
-		return fmt.Errorf("upload thumb: %w", err)
-	}
-
-	if err := svc.UpdateStatus(ctx, p.VideoID, models.StatusProcessing); err != nil {
-		_ = status.SetStatus(ctx, p.JobID, "failed:update_status_processing", 24*time.Hour)
-		return fmt.Errorf("update status processing: %w", err)
-	}
-
-	processedURL := s3Client.GetProcessedFileURL(processedKey)
-	thumbURL := s3Client.GetProcessedFileURL(thumbKey)
-
-	if err := svc.UpdateProcessedURL(ctx, p.VideoID, processedURL); err != nil {
-		_ = status.SetStatus(ctx, p.JobID, "failed:update_processed_url", 24*time.Hour)
-		return fmt.Errorf("update processed url: %w", err)
-	}
-	if err := svc.UpdateThumbURL(ctx, p.VideoID, thumbURL); err != nil {
-		_ = status.SetStatus(ctx, p.JobID, "failed:update_thumb_url", 24*time.Hour)
-		return fmt.Errorf("update thumb url: %w", err)
-	}
-	if err := svc.UpdateStatus(ctx, p.VideoID, models.StatusProcessed); err != nil {
-		_ = status.SetStatus(ctx, p.JobID, "failed:update_status_processed", 24*time.Hour)
-		return fmt.Errorf("update status processed: %w", err)
+		err = fmt.Errorf("command failed: %s: %w\noutput:\n%s", clone.String(), err, string(out))
+		if invalidInput(out) {
+			return nil, permanent(err)
+		}
+		return nil, err
 	}
-
-	_ = status.SetStatus(ctx, p.JobID, "done", 24*time.Hour)
-	log.Printf("Video %d processed successfully (job %s)", p.VideoID, p.JobID)
-	return nil
+	return out, nil
 }
 
 func main() {
-	queueURL := getenv("SQS_QUEUE_URL", "")
-	if queueURL == "" {
-		log.Fatal("SQS_QUEUE_URL is required!")
-	}
-	region := getenv("AWS_REGION", "")
-	if region == "" {
-		log.Fatal("AWS_REGION is required!")
-	}
 	dsn := getenv("DB_DSN", "")
 	if dsn == "" {
 		log.Fatal("DB_DSN is required!")
 	}
 
+	// SIGTERM/SIGINT stop receiving and start draining in-flight jobs
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+
 	db := repos.MustOpenPostgres(dsn)
 	defer db.Close()
 
 	repo := repos.NewVideoRepoPG(db)
-	svc := services.NewVideoService(repo)
 
-	// Initialize SQS client for worker
-	statusStore, err := async.NewSQSEnqueuer(context.Background(), queueURL, db)
+	// Initialize job queue for worker (SQS or PostgreSQL, see QUEUE_BACKEND)
+	queue, err := async.NewQueueFromEnv(context.Background(), db)
 	if err != nil {
-		log.Fatalf("Cannot initialize SQS enqueuer: %v", err)
+		log.Fatalf("Cannot initialize job queue: %v", err)
 	}
+	statusStore := async.NewEnqueuer(queue, db)
 	defer statusStore.Close()
-	log.Printf("[worker] SQS enqueuer initialized with url: %s", queueURL)
+	log.Printf("[worker] job queue initialized backend=%s", getenv("QUEUE_BACKEND", "sqs"))
 
-	go func(e *async.SQSEnqueuer) {
+	checkpoints := async.NewCheckpoints(db)
+
+	go func(e *async.Enqueuer) {
 		t := time.NewTicker(6 * time.Hour)
 		defer t.Stop()
-		for range t.C {
-			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-			if err := e.CleanupExpiredStatuses(ctx); err != nil {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C:
+			}
+			cctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			if err := e.CleanupExpiredStatuses(cctx); err != nil {
 				log.Printf("job_status cleanup error: %v", err)
 			}
+			if err := checkpoints.Cleanup(cctx, 7*24*time.Hour); err != nil {
+				log.Printf("job_checkpoints cleanup error: %v", err)
+			}
 			cancel()
 		}
 	}(statusStore)
 
-	// Initialize S3 client for worker
-	s3Client, err := s3client.NewFromSSM(
-		context.Background(),
-		"/anb/s3/uploads-bucket",
-		"/anb/s3/processed-bucket",
-	)
+	// Initialize storage for worker (S3 or local filesystem, see STORAGE_BACKEND)
+	store, err := storage.NewFromEnv(context.Background())
 	if err != nil {
-		log.Fatal("Failed to initialize S3 client:", err)
+		log.Fatal("Failed to initialize storage:", err)
 	}
-	log.Printf("[worker] startup s3_uploads_bucket=%s s3_processed_bucket=%s", s3Client.GetUploadsBucket(), s3Client.GetProcessedBucket())
+	svc := services.NewVideoService(repo, store)
+	log.Printf("[worker] startup uploads_bucket=%s processed_bucket=%s", store.GetUploadsBucket(), store.GetProcessedBucket())
 
-	cfg, err := config.LoadDefaultConfig(context.Background(), config.WithRegion(region))
+	dlq, err := async.NewDeadLetterQueueFromEnv(context.Background(), db)
 	if err != nil {
-		log.Fatalf("Cannot load AWS config: %v", err)
+		log.Fatalf("Cannot initialize dead-letter queue: %v", err)
 	}
-	sqsClient := sqs.NewFromConfig(cfg)
 
-	log.Printf("Worker started. SQS queue=%s region=%s", queueURL, region)
+	profiles, err := media.ProfilesFromEnv()
+	if err != nil {
+		log.Fatalf("Cannot load processing profiles: %v", err)
+	}
 
-	for {
-		ctx, cancel := context.WithTimeout(context.Background(), 35*time.Second)
-		resp, err := sqsClient.ReceiveMessage(ctx, &sqs.ReceiveMessageInput{
-			QueueUrl:            &queueURL,
-			MaxNumberOfMessages: 5,
-			WaitTimeSeconds:     20,
-			MessageAttributeNames: []string{
-				"All",
-			},
-		})
-		cancel()
-		if err != nil {
-			log.Printf("Recieved error: %v", err)
-			time.Sleep(5 * time.Second)
-			continue
-		}
-		if len(resp.Messages) == 0 {
-			continue
-		}
+	if f := getenv("WORKER_PREVIEW_FORMAT", media.PreviewMP4); f != media.PreviewMP4 && f != media.PreviewWebM {
+		log.Fatalf("WORKER_PREVIEW_FORMAT must be %s or %s, got %q", media.PreviewMP4, media.PreviewWebM, f)
+	}
 
-		for _, msg := range resp.Messages {
-			jobTypeAttr, ok := msg.MessageAttributes["JobType"]
-			if !ok || jobTypeAttr.StringValue == nil || *jobTypeAttr.StringValue != async.TypeProcessVideo {
-				// Ignore unrelated messages
-				continue
-			}
-			if msg.Body == nil {
-				continue
-			}
+	visibility := getenvDuration("WORKER_VISIBILITY_TIMEOUT", 5*time.Minute)
+	if err := checkVisibility(visibility); err != nil {
+		log.Fatalf("WORKER_VISIBILITY_TIMEOUT %v", err)
+	}
 
-			var payload async.VideoProcessingPayload
-			if err := json.Unmarshal([]byte(*msg.Body), &payload); err != nil {
-				log.Printf("Unmarshal payload error: %v", err)
-				continue
-			}
+	w := &worker{
+		queue:  queue,
+		dlq:    dlq,
+		svc:    svc,
+		users:  repos.NewUserRepoPG(db),
+		status: statusStore,
+		store:  store,
 
-			procCtx, procCancel := context.WithTimeout(context.Background(), 30*time.Minute)
-			err := processVideo(procCtx, payload, svc, statusStore, s3Client)
-			procCancel()
-			if err != nil {
-				log.Printf("Video processing Failed. Job %s failed: %v", payload.JobID, err)
-				continue
-			}
+		checkpoints: checkpoints,
+		rules:       media.RulesFromEnv(),
+		profiles:    profiles,
+		hls:         getenv("WORKER_HLS_ENABLED", "false") == "true",
 
-			if _, err := sqsClient.DeleteMessage(context.Background(), &sqs.DeleteMessageInput{
-				QueueUrl:      &queueURL,
-				ReceiptHandle: msg.ReceiptHandle,
-			}); err != nil {
-				log.Printf("Delete message failed (job %s): %v", payload.JobID, err)
-			}
-		}
-	}
-}
+		previewFormat: getenv("WORKER_PREVIEW_FORMAT", media.PreviewMP4),
+		previewGIF:    getenv("WORKER_PREVIEW_GIF", "false") == "true",
 
-func deref(v *string) string {
-	if v == nil {
-		return ""
+		policy: retryPolicy{
+			maxAttempts: getenvInt("WORKER_MAX_ATTEMPTS", 5),
+			baseDelay:   getenvDuration("WORKER_RETRY_BASE_DELAY", 30*time.Second),
+			maxDelay:    getenvDuration("WORKER_RETRY_MAX_DELAY", 15*time.Minute),
+		},
+		concurrency:  getenvInt("WORKER_CONCURRENCY", 2),
+		prefetch:     getenvInt("WORKER_PREFETCH", 2),
+		visibility:   visibility,
+		jobTimeout:   getenvDuration("WORKER_JOB_TIMEOUT", 30*time.Minute),
+		drainTimeout: getenvDuration("WORKER_DRAIN_TIMEOUT", 2*time.Minute),
+		workRoot:     getenv("WORKER_TMP_DIR", os.TempDir()),
 	}
-	return *v
+
+	log.Printf("Worker started. queue_backend=%s concurrency=%d prefetch=%d max_attempts=%d dead_letter=%t profiles=%v",
+		getenv("QUEUE_BACKEND", "sqs"), w.concurrency, w.prefetch, w.policy.maxAttempts, dlq != nil, profiles.Names())
+	w.run(ctx)
+	log.Printf("Worker stopped")
 }
@@ -0,0 +1,940 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"ISIS4426-Entrega1/app/async"
+	"ISIS4426-Entrega1/app/models"
+	"ISIS4426-Entrega1/app/repos"
+	"ISIS4426-Entrega1/app/services"
+	"ISIS4426-Entrega1/internal/media"
+	"ISIS4426-Entrega1/internal/storage"
+)
+
+// Pipeline stages, in execution order. A stage is checkpointed once it
+// completes, so a retried job resumes at the first incomplete one.
+const (
+	stageDownload  = "download"
+	stageProbe     = "probe"
+	stageTrim      = "trim"
+	stageThumbnail = "thumbnail"
+	stageScale     = "scale"
+	stageOverlay   = "overlay"
+	stageConcat    = "concat"
+	stageAudio     = "audio"
+	stageSprite    = "sprite"
+	stagePreview   = "preview"
+	stageHLS       = "hls"
+	stageUpload    = "upload"
+	stageFinalize  = "finalize"
+)
+
+// Artifacts produced by the stages. File artifacts are named after their file
+// in the work dir and map to the storage key of their copy.
+const (
+	fileOriginal    = "original.mp4"
+	fileTrim        = "video_trim.mp4"
+	fileSprite      = "sprite.jpg"
+	fileSpriteVTT   = "sprite.vtt"
+	filePreviewGIF  = "preview.gif"
+	fileMainScaled  = "main_scaled.mp4"
+	fileIntroScaled = "intro_scaled.mp4"
+	fileOutroScaled = "outro_scaled.mp4"
+	fileMainBranded = "main_branded.mp4"
+	fileLowerThird  = "lower_third.txt"
+	fileFinal       = "final.mp4"
+	fileOutput      = "video.mp4" // final video after the audio policy
+
+	artifactDuration       = "duration"
+	artifactDurationSuffix = ".duration" // probed length of a scaled clip
+	artifactFinalDuration  = "final_duration"
+	artifactProcessedKey   = "processed_key"
+	artifactThumbAt        = "thumb_at"   // offset of the chosen thumbnail frame, in seconds
+	artifactThumbKeyPrefix = "thumb_key_" // + size name
+	artifactSpriteKey      = "sprite_key"
+	artifactSpriteVTTKey   = "sprite_vtt_key"
+	artifactPreviewFile    = "preview_file" // name of the preview clip, after the configured format
+	artifactPreviewKey     = "preview_key"
+	artifactPreviewGIFKey  = "preview_gif_key"
+	artifactHLSKey         = "hls_key"
+)
+
+// workKeyPrefix is where intermediate files are staged in the uploads bucket,
+// under work/{jobID}/, so any worker can resume the job.
+const workKeyPrefix = "work/"
+
+// statusStore tracks job status for GET /api/jobs/{id}
+type statusStore interface {
+	SetStatus(ctx context.Context, jobID string, status string, ttl time.Duration) error
+	GetStatus(ctx context.Context, jobID string) (string, error)
+	RecordFailure(ctx context.Context, jobID string) (int, error)
+}
+
+// userStore reads the player data shown in the overlay
+type userStore interface {
+	GetByID(ctx context.Context, id int) (*models.User, error)
+}
+
+// checkpointStore persists completed stages and their artifacts per job
+type checkpointStore interface {
+	Load(ctx context.Context, jobID string) (map[string]map[string]string, error)
+	Save(ctx context.Context, jobID, stage string, artifacts map[string]string) error
+}
+
+type stage struct {
+	name string
+	run  func(ctx context.Context, j *job) (map[string]string, error)
+}
+
+// job is one run of the pipeline. artifacts holds the outputs of every
+// completed stage, including those restored from checkpoints.
+type job struct {
+	async.VideoProcessingPayload
+	profile   media.Profile
+	dir       string
+	artifacts map[string]string
+}
+
+func (w *worker) stages() []stage {
+	stages := []stage{
+		{stageDownload, w.download},
+		{stageProbe, w.probe},
+		{stageTrim, w.trim},
+		{stageThumbnail, w.thumbnail},
+		{stageScale, w.scale},
+		{stageOverlay, w.overlay},
+		{stageConcat, w.concat},
+		{stageAudio, w.audio},
+		{stageSprite, w.sprite},
+		{stagePreview, w.preview},
+	}
+	if w.hls {
+		stages = append(stages, stage{stageHLS, w.packageHLS})
+	}
+	return append(stages,
+		stage{stageUpload, w.upload},
+		stage{stageFinalize, w.finalize},
+	)
+}
+
+// processVideo runs the pipeline for p, skipping the stages already
+// checkpointed. A job that already finished is acknowledged without running
+// anything, so duplicate deliveries never redo ffmpeg or rewrite outputs.
+func (w *worker) processVideo(ctx context.Context, p async.VideoProcessingPayload) error {
+	done, err := w.checkpoints.Load(ctx, p.JobID)
+	if err != nil {
+		return fmt.Errorf("load checkpoints: %w", err)
+	}
+	if _, ok := done[stageFinalize]; ok || w.jobDone(ctx, p.JobID) {
+		log.Printf("Job %s already done, skipping (video %d)", p.JobID, p.VideoID)
+		_ = w.status.SetStatus(ctx, p.JobID, "done", 24*time.Hour)
+		return nil
+	}
+	if w.jobCancelled(ctx, p.JobID) {
+		log.Printf("Job %s cancelled, video %d was deleted", p.JobID, p.VideoID)
+		return nil
+	}
+
+	profile, err := w.profiles.Get(p.Profile)
+	if err != nil {
+		_ = w.status.SetStatus(ctx, p.JobID, "failed:profile", 24*time.Hour)
+		return permanent(err)
+	}
+
+	// Each attempt gets its own work dir: a run that lost its lease may still
+	// be cleaning up on this host while the new owner of the message works
+	err = os.MkdirAll(w.workRoot, 0o755)
+	var workDir string
+	if err == nil {
+		workDir, err = os.MkdirTemp(w.workRoot, fmt.Sprintf("%s%d_%s_", workDirPrefix, p.VideoID, p.JobID))
+	}
+	if err != nil {
+		_ = w.status.SetStatus(ctx, p.JobID, "failed:create_workdir", 24*time.Hour)
+		return fmt.Errorf("create workdir: %w", err)
+	}
+	defer os.RemoveAll(workDir)
+
+	j := &job{VideoProcessingPayload: p, profile: profile, dir: workDir, artifacts: map[string]string{}}
+	for _, artifacts := range done {
+		for k, v := range artifacts {
+			j.artifacts[k] = v
+		}
+	}
+	if len(done) > 0 {
+		log.Printf("Job %s resuming, %d stages already done", p.JobID, len(done))
+	}
+
+	// a reprocessed video stays processed, and public, until finalize
+	// swaps in the new outputs
+	if !p.Reprocess {
+		if err := w.svc.UpdateStatus(ctx, p.VideoID, models.StatusProcessing); err != nil {
+			_ = w.status.SetStatus(ctx, p.JobID, "failed:update_status_processing", 24*time.Hour)
+			return fmt.Errorf("update status processing: %w", err)
+		}
+	}
+	if err := w.runStages(ctx, j, w.stages(), done); err != nil {
+		return err
+	}
+
+	w.removeStaged(ctx, p.JobID)
+	_ = w.status.SetStatus(ctx, p.JobID, "done", 24*time.Hour)
+	log.Printf("Video %d processed successfully (job %s)", p.VideoID, p.JobID)
+	return nil
+}
+
+// runStages runs every stage not in done and checkpoints it
+func (w *worker) runStages(ctx context.Context, j *job, stages []stage, done map[string]map[string]string) error {
+	for _, s := range stages {
+		if _, ok := done[s.name]; ok {
+			continue
+		}
+		_ = w.status.SetStatus(ctx, j.JobID, "processing:"+s.name, 24*time.Hour)
+		out, err := s.run(ctx, j)
+		if err != nil {
+			_ = w.status.SetStatus(ctx, j.JobID, "failed:"+s.name, 24*time.Hour)
+			return fmt.Errorf("%s: %w", s.name, err)
+		}
+		for k, v := range out {
+			j.artifacts[k] = v
+		}
+		if err := w.checkpoints.Save(ctx, j.JobID, s.name, out); err != nil {
+			return fmt.Errorf("checkpoint %s: %w", s.name, err)
+		}
+	}
+	return nil
+}
+
+// jobDone reports whether the job status already says done
+func (w *worker) jobDone(ctx context.Context, jobID string) bool {
+	st, err := w.status.GetStatus(ctx, jobID)
+	return err == nil && st == "done"
+}
+
+// jobCancelled reports whether the video of the job was deleted while the job
+// was pending
+func (w *worker) jobCancelled(ctx context.Context, jobID string) bool {
+	st, err := w.status.GetStatus(ctx, jobID)
+	return err == nil && st == "cancelled"
+}
+
+// errObjectMissing marks a download whose key is not in the uploads bucket,
+// as opposed to a failure writing the local copy
+var errObjectMissing = errors.New("object not found")
+
+// local returns the path of a file artifact in the work dir, downloading it
+// first when the stage that produced it ran in an earlier attempt.
+func (w *worker) local(ctx context.Context, j *job, name string) (string, error) {
+	path := filepath.Join(j.dir, name)
+	if _, err := os.Stat(path); err == nil {
+		return path, nil
+	}
+	key, ok := j.artifacts[name]
+	if !ok {
+		return "", permanent(fmt.Errorf("artifact %s missing", name))
+	}
+	reader, err := w.store.DownloadFromUploads(ctx, key)
+	if storage.IsNotFound(err) {
+		return "", fmt.Errorf("download %s: %w: %w", key, errObjectMissing, err)
+	}
+	if err != nil {
+		return "", fmt.Errorf("download %s: %w", key, err)
+	}
+	defer reader.Close()
+
+	tmp, err := os.CreateTemp(j.dir, name+".*.part")
+	if err != nil {
+		return "", fmt.Errorf("create temp file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, reader); err != nil {
+		tmp.Close()
+		return "", fmt.Errorf("save %s: %w", name, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return "", fmt.Errorf("save %s: %w", name, err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return "", fmt.Errorf("save %s: %w", name, err)
+	}
+	return path, nil
+}
+
+// stash copies file artifacts from the work dir to work/{jobID}/ in the
+// uploads bucket and returns their keys.
+func (w *worker) stash(ctx context.Context, j *job, names ...string) (map[string]string, error) {
+	out := make(map[string]string, len(names))
+	for _, name := range names {
+		key := workKeyPrefix + j.JobID + "/" + name
+		f, err := os.Open(filepath.Join(j.dir, name))
+		if err != nil {
+			return nil, fmt.Errorf("open %s: %w", name, err)
+		}
+		err = w.store.UploadToUploads(ctx, key, f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("stage %s: %w", name, err)
+		}
+		out[name] = key
+	}
+	return out, nil
+}
+
+// removeStaged deletes the intermediate files staged for jobID. Failures are
+// only logged: leftovers under work/ are harmless.
+func (w *worker) removeStaged(ctx context.Context, jobID string) {
+	done, err := w.checkpoints.Load(ctx, jobID)
+	if err != nil {
+		log.Printf("[worker] cannot load checkpoints of job %s: %v", jobID, err)
+		return
+	}
+	prefix := workKeyPrefix + jobID + "/"
+	for _, artifacts := range done {
+		for _, key := range artifacts {
+			if !strings.HasPrefix(key, prefix) {
+				continue
+			}
+			if err := w.store.DeleteFile(ctx, w.store.GetUploadsBucket(), key); err != nil && !errors.Is(err, os.ErrNotExist) {
+				log.Printf("[worker] cannot remove staged file %s: %v", key, err)
+			}
+		}
+	}
+}
+
+// download fetches the original and records its content hash, which direct
+// uploads reach the worker without. Content the user already uploaded as
+// another video fails the job permanently.
+func (w *worker) download(ctx context.Context, j *job) (map[string]string, error) {
+	// the original stays in the uploads bucket; nothing to stage
+	j.artifacts[fileOriginal] = j.InputPath
+	in, err := w.local(ctx, j, fileOriginal)
+	if errors.Is(err, errObjectMissing) {
+		// no retry brings back an original that is not in the bucket
+		return nil, permanent(fmt.Errorf("download original: %w", err))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("download original: %w", err)
+	}
+	sum, err := fileSHA256(in)
+	if err != nil {
+		return nil, err
+	}
+	err = w.svc.RecordContent(ctx, j.UserID, j.VideoID, sum)
+	var dup *services.DuplicateError
+	if errors.As(err, &dup) {
+		return nil, permanent(fmt.Errorf("duplicate of video %d", dup.Video.VideoID))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("record content hash: %w", err)
+	}
+	return map[string]string{fileOriginal: j.InputPath}, nil
+}
+
+// fileSHA256 returns the hex SHA-256 of the file at path
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", fmt.Errorf("hash %s: %w", path, err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// probe validates the upload against the acceptance rules and records its
+// metadata on the video. A rejected file fails the job permanently.
+func (w *worker) probe(ctx context.Context, j *job) (map[string]string, error) {
+	in, err := w.local(ctx, j, fileOriginal)
+	if err != nil {
+		return nil, err
+	}
+	info, err := media.Probe(ctx, in)
+	if err == nil {
+		err = w.rules.Validate(info)
+	}
+	var verr *media.ValidationError
+	if errors.As(err, &verr) {
+		return nil, permanent(err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = w.svc.UpdateMediaInfo(ctx, j.VideoID, models.MediaInfo{
+		DurationSec: info.Duration,
+		Width:       info.Width,
+		Height:      info.Height,
+		FPS:         info.FPS,
+		VideoCodec:  info.VideoCodec,
+		AudioCodec:  info.AudioCodec,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("update media info: %w", err)
+	}
+	return map[string]string{artifactDuration: strconv.FormatFloat(info.Duration, 'f', 3, 64)}, nil
+}
+
+func (w *worker) trim(ctx context.Context, j *job) (map[string]string, error) {
+	in, err := w.local(ctx, j, fileOriginal)
+	if err != nil {
+		return nil, err
+	}
+	if err := run(ctx, j.profile.Trim(in, filepath.Join(j.dir, fileTrim)).Exec()); err != nil {
+		return nil, err
+	}
+	return w.stash(ctx, j, fileTrim)
+}
+
+// thumbnail publishes the thumbnails of the main clip (bumpers excluded) in
+// every ThumbSize. Unless the profile fixes the offset, several frames are
+// sampled and the sharpest, best exposed one is used.
+func (w *worker) thumbnail(ctx context.Context, j *job) (map[string]string, error) {
+	in, err := w.local(ctx, j, fileTrim)
+	if err != nil {
+		return nil, err
+	}
+	at := j.profile.ThumbnailAt
+	if at == 0 {
+		if at, err = w.pickFrame(ctx, j, in); err != nil {
+			return nil, err
+		}
+	}
+
+	var names []string
+	for _, size := range media.ThumbSizes {
+		name := thumbFile(size.Name)
+		if err := run(ctx, media.Frame(in, at, size.Width, filepath.Join(j.dir, name)).Exec()); err != nil {
+			return nil, fmt.Errorf("thumbnail %s: %w", size.Name, err)
+		}
+		names = append(names, name)
+	}
+	out, err := w.stash(ctx, j, names...)
+	if err != nil {
+		return nil, err
+	}
+	out[artifactThumbAt] = strconv.FormatFloat(at.Seconds(), 'f', 3, 64)
+	return out, nil
+}
+
+// thumbCandidates is how many frames are sampled to pick the thumbnail
+const thumbCandidates = 8
+
+// pickFrame samples frames across the clip and returns the offset of the
+// best scored one. Candidates that cannot be extracted (past the real end of
+// a badly muxed file) are skipped.
+func (w *worker) pickFrame(ctx context.Context, j *job, in string) (time.Duration, error) {
+	d, _ := strconv.ParseFloat(j.artifacts[artifactDuration], 64)
+	length := min(media.Seconds(d), j.profile.MaxDuration)
+
+	times := media.CandidateTimes(length, thumbCandidates)
+	var scores []media.FrameScore
+	var offsets []time.Duration
+	for i, at := range times {
+		cand := filepath.Join(j.dir, fmt.Sprintf("candidate_%02d.jpg", i))
+		if err := run(ctx, media.CandidateFrame(in, at, cand).Exec()); err != nil {
+			if ctx.Err() != nil {
+				return 0, err
+			}
+			continue
+		}
+		score, err := media.ScoreFile(cand)
+		os.Remove(cand)
+		if err != nil {
+			continue
+		}
+		scores = append(scores, score)
+		offsets = append(offsets, at)
+	}
+	best := media.BestFrame(scores)
+	if best < 0 {
+		return 0, errors.New("no candidate frame could be extracted")
+	}
+	return offsets[best], nil
+}
+
+func thumbFile(size string) string {
+	return "thumb_" + size + ".jpg"
+}
+
+// clips are the scaled files concatenated into the final video, in order.
+// Intro and outro are left out when the profile has none.
+func (j *job) clips() []string {
+	var clips []string
+	if j.profile.Intro != "" {
+		clips = append(clips, fileIntroScaled)
+	}
+	if j.profile.Overlay.Enabled() {
+		clips = append(clips, fileMainBranded)
+	} else {
+		clips = append(clips, fileMainScaled)
+	}
+	if j.profile.Outro != "" {
+		clips = append(clips, fileOutroScaled)
+	}
+	return clips
+}
+
+// scale normalizes every clip to the profile resolution and frame rate. The
+// main clip is capped at MaxDuration and the bumpers are shortened to fit
+// the profile BumperBudget. Each scaled clip is probed so concat can verify
+// the joined result.
+func (w *worker) scale(ctx context.Context, j *job) (map[string]string, error) {
+	src, err := w.local(ctx, j, fileTrim)
+	if err != nil {
+		return nil, err
+	}
+	info, err := media.Probe(ctx, src)
+	if err != nil {
+		return nil, fmt.Errorf("probe %s: %w", fileTrim, err)
+	}
+	inputs := map[string]media.Clip{
+		fileMainScaled: {Path: src, Limit: j.profile.MaxDuration, HasAudio: info.AudioCodec != ""},
+	}
+	if err := w.fitBumpers(ctx, j, inputs); err != nil {
+		return nil, err
+	}
+
+	out := map[string]string{}
+	for _, clip := range j.clips() {
+		scaled := filepath.Join(j.dir, clip)
+		if err := run(ctx, j.profile.Scale(inputs[clip], scaled).Exec()); err != nil {
+			return nil, fmt.Errorf("%s: %w", clip, err)
+		}
+		info, err := media.Probe(ctx, scaled)
+		if err != nil {
+			return nil, fmt.Errorf("probe %s: %w", clip, err)
+		}
+		out[clip+artifactDurationSuffix] = strconv.FormatFloat(info.Duration, 'f', 3, 64)
+	}
+	staged, err := w.stash(ctx, j, j.clips()...)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range staged {
+		out[k] = v
+	}
+	return out, nil
+}
+
+// fitBumpers resolves and probes the intro and outro of the profile and sets
+// how much of each to keep so both fit in the bumper budget. An unreadable
+// bumper is a configuration error that no retry fixes.
+func (w *worker) fitBumpers(ctx context.Context, j *job, inputs map[string]media.Clip) error {
+	lengths := map[string]time.Duration{}
+	for clip, ref := range map[string]string{fileIntroScaled: j.profile.Intro, fileOutroScaled: j.profile.Outro} {
+		if ref == "" {
+			continue
+		}
+		in, err := w.asset(ctx, j, ref)
+		if err != nil {
+			return fmt.Errorf("bumper %s: %w", ref, err)
+		}
+		info, err := media.Probe(ctx, in)
+		var verr *media.ValidationError
+		if errors.As(err, &verr) || (err == nil && !info.HasVideo()) {
+			return permanent(fmt.Errorf("bumper %s is not a readable video: %v", ref, err))
+		}
+		if err != nil {
+			return fmt.Errorf("probe bumper %s: %w", ref, err)
+		}
+		inputs[clip] = media.Clip{Path: in, HasAudio: info.AudioCodec != ""}
+		lengths[clip] = media.Seconds(info.Duration)
+	}
+
+	intro, outro := media.FitBumpers(lengths[fileIntroScaled], lengths[fileOutroScaled], j.profile.BumperBudget)
+	if intro < lengths[fileIntroScaled] || outro < lengths[fileOutroScaled] {
+		log.Printf("Job %s: bumpers %s + %s exceed the %s budget, trimmed to %s + %s", j.JobID,
+			lengths[fileIntroScaled], lengths[fileOutroScaled], j.profile.BumperBudget, intro, outro)
+	}
+	for clip, limit := range map[string]time.Duration{fileIntroScaled: intro, fileOutroScaled: outro} {
+		if c, ok := inputs[clip]; ok {
+			c.Limit = limit
+			inputs[clip] = c
+		}
+	}
+	return nil
+}
+
+// overlay burns the profile branding into the main clip: the logo and the
+// lower third with the player name and city. Bumpers are left untouched.
+// Profiles without overlay skip it.
+func (w *worker) overlay(ctx context.Context, j *job) (map[string]string, error) {
+	o := j.profile.Overlay
+	if !o.Enabled() {
+		return nil, nil
+	}
+	in, err := w.local(ctx, j, fileMainScaled)
+	if err != nil {
+		return nil, err
+	}
+	var logo, textFile string
+	if o.Image != "" {
+		if logo, err = w.asset(ctx, j, o.Image); err != nil {
+			return nil, fmt.Errorf("overlay image %s: %w", o.Image, err)
+		}
+	}
+	if o.Text != "" {
+		if textFile, err = w.lowerThird(ctx, j); err != nil {
+			return nil, err
+		}
+	}
+
+	branded := filepath.Join(j.dir, fileMainBranded)
+	cmd := j.profile.Remux(in, branded)
+	if logo != "" || textFile != "" {
+		cmd = j.profile.Brand(in, logo, textFile, branded)
+	}
+	if err := run(ctx, cmd.Exec()); err != nil {
+		return nil, err
+	}
+	out, err := w.stash(ctx, j, fileMainBranded)
+	if err != nil {
+		return nil, err
+	}
+	// burning in does not change the length of the clip
+	out[fileMainBranded+artifactDurationSuffix] = j.artifacts[fileMainScaled+artifactDurationSuffix]
+	return out, nil
+}
+
+// lowerThird renders the overlay text for the uploader into a file. A player
+// that no longer exists, or an empty result, leaves the video without it.
+func (w *worker) lowerThird(ctx context.Context, j *job) (string, error) {
+	u, err := w.users.GetByID(ctx, j.UserID)
+	if errors.Is(err, repos.ErrUserNotFound) {
+		log.Printf("Job %s: user %d not found, skipping lower third", j.JobID, j.UserID)
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("get user %d: %w", j.UserID, err)
+	}
+	text, err := j.profile.Overlay.RenderText(media.OverlayData{
+		Name:      strings.TrimSpace(u.FirstName + " " + u.LastName),
+		FirstName: u.FirstName,
+		LastName:  u.LastName,
+		City:      u.City,
+		Country:   u.Country,
+	})
+	if err != nil {
+		return "", permanent(fmt.Errorf("overlay text: %w", err))
+	}
+	if text == "" {
+		return "", nil
+	}
+	path := filepath.Join(j.dir, fileLowerThird)
+	if err := os.WriteFile(path, []byte(text), 0o644); err != nil {
+		return "", fmt.Errorf("write %s: %w", fileLowerThird, err)
+	}
+	return path, nil
+}
+
+// asset resolves an intro/outro reference: an absolute path on the worker,
+// or a key in the uploads bucket, fetched into the work dir. The local name
+// comes from a hash of the whole key, so assets with the same file name in
+// different folders do not reuse each other's file.
+func (w *worker) asset(ctx context.Context, j *job, ref string) (string, error) {
+	if filepath.IsAbs(ref) {
+		return ref, nil
+	}
+	sum := sha256.Sum256([]byte(ref))
+	name := "asset_" + hex.EncodeToString(sum[:8]) + path.Ext(ref)
+	j.artifacts[name] = ref
+	return w.local(ctx, j, name)
+}
+
+// concat joins the scaled clips and verifies the result lasts what the clips
+// add up to, within the MaxDuration + BumperBudget window.
+func (w *worker) concat(ctx context.Context, j *job) (map[string]string, error) {
+	var parts []string
+	var expected time.Duration
+	for _, clip := range j.clips() {
+		clipPath, err := w.local(ctx, j, clip)
+		if err != nil {
+			return nil, err
+		}
+		parts = append(parts, clipPath)
+		d, err := strconv.ParseFloat(j.artifacts[clip+artifactDurationSuffix], 64)
+		if err != nil {
+			return nil, permanent(fmt.Errorf("duration of %s missing from checkpoint", clip))
+		}
+		expected += media.Seconds(d)
+	}
+
+	final := filepath.Join(j.dir, fileFinal)
+	if err := run(ctx, j.profile.Concat(parts, final).Exec()); err != nil {
+		return nil, err
+	}
+	info, err := media.Probe(ctx, final)
+	if err != nil {
+		return nil, fmt.Errorf("probe final: %w", err)
+	}
+	limit := j.profile.MaxDuration + j.profile.BumperBudget
+	if err := media.CheckDuration(media.Seconds(info.Duration), expected, limit); err != nil {
+		return nil, err
+	}
+
+	out, err := w.stash(ctx, j, fileFinal)
+	if err != nil {
+		return nil, err
+	}
+	out[artifactFinalDuration] = strconv.FormatFloat(info.Duration, 'f', 3, 64)
+	return out, nil
+}
+
+// audio applies the profile audio policy to the joined video: strip drops
+// the audio, keep leaves the joined segment audio as is, normalize brings it
+// to the profile loudness (silent tracks are left alone, loudnorm cannot
+// measure them) and replace lays the profile AudioTrack under the video.
+func (w *worker) audio(ctx context.Context, j *job) (map[string]string, error) {
+	in, err := w.local(ctx, j, fileFinal)
+	if err != nil {
+		return nil, err
+	}
+	out := filepath.Join(j.dir, fileOutput)
+
+	var cmd media.Command
+	switch p := j.profile; p.AudioPolicy {
+	case media.AudioKeep:
+		cmd = p.Remux(in, out)
+	case media.AudioNormalize:
+		scan, err := output(ctx, p.LoudnessScan(in).Exec())
+		if err != nil {
+			return nil, fmt.Errorf("loudness scan: %w", err)
+		}
+		m, err := media.ParseLoudness(scan)
+		if err != nil {
+			return nil, err
+		}
+		if m.Silent() {
+			log.Printf("Job %s: audio is silent, skipping loudness normalization", j.JobID)
+			cmd = p.Remux(in, out)
+		} else {
+			cmd = p.Normalize(in, out, m)
+		}
+	case media.AudioReplace:
+		track, err := w.asset(ctx, j, p.AudioTrack)
+		if err != nil {
+			return nil, fmt.Errorf("audio track %s: %w", p.AudioTrack, err)
+		}
+		cmd = p.ReplaceAudio(in, track, out)
+	default:
+		cmd = p.Mute(in, out)
+	}
+	if err := run(ctx, cmd.Exec()); err != nil {
+		return nil, err
+	}
+	return w.stash(ctx, j, fileOutput)
+}
+
+// sprite renders the seek-preview sprite sheet of the published video and
+// its WebVTT thumbnail track. The track references the sheet by file name,
+// since both are published side by side.
+func (w *worker) sprite(ctx context.Context, j *job) (map[string]string, error) {
+	in, err := w.local(ctx, j, fileOutput)
+	if err != nil {
+		return nil, err
+	}
+	d, err := strconv.ParseFloat(j.artifacts[artifactFinalDuration], 64)
+	if err != nil {
+		return nil, permanent(errors.New("final duration missing from checkpoint"))
+	}
+	sp := j.profile.NewSprite(media.Seconds(d))
+	if err := run(ctx, sp.Command(in, filepath.Join(j.dir, fileSprite)).Exec()); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(filepath.Join(j.dir, fileSpriteVTT), []byte(sp.VTT(fileSprite)), 0o644); err != nil {
+		return nil, fmt.Errorf("write %s: %w", fileSpriteVTT, err)
+	}
+	return w.stash(ctx, j, fileSprite, fileSpriteVTT)
+}
+
+// preview renders the short muted gallery clip (and the GIF, when enabled)
+// around the highlight: the frame chosen as thumbnail, shifted by the intro
+// since it was picked on the main clip.
+func (w *worker) preview(ctx context.Context, j *job) (map[string]string, error) {
+	in, err := w.local(ctx, j, fileOutput)
+	if err != nil {
+		return nil, err
+	}
+	total, err := strconv.ParseFloat(j.artifacts[artifactFinalDuration], 64)
+	if err != nil {
+		return nil, permanent(errors.New("final duration missing from checkpoint"))
+	}
+	highlight, _ := strconv.ParseFloat(j.artifacts[artifactThumbAt], 64)
+	if intro, err := strconv.ParseFloat(j.artifacts[fileIntroScaled+artifactDurationSuffix], 64); err == nil {
+		highlight += intro
+	}
+	start := media.PreviewStart(media.Seconds(total), media.Seconds(highlight), media.PreviewLength)
+
+	name := "preview." + w.previewFormat
+	cmd, err := media.Preview(in, start, w.previewFormat, filepath.Join(j.dir, name))
+	if err != nil {
+		return nil, permanent(err)
+	}
+	if err := run(ctx, cmd.Exec()); err != nil {
+		return nil, err
+	}
+	names := []string{name}
+	if w.previewGIF {
+		if err := run(ctx, media.PreviewGIF(in, start, filepath.Join(j.dir, filePreviewGIF)).Exec()); err != nil {
+			return nil, fmt.Errorf("gif: %w", err)
+		}
+		names = append(names, filePreviewGIF)
+	}
+	out, err := w.stash(ctx, j, names...)
+	if err != nil {
+		return nil, err
+	}
+	out[artifactPreviewFile] = name
+	return out, nil
+}
+
+// upload publishes the outputs under a per-job prefix, so a retry rewrites
+// its own objects and never those of another job for the same video.
+func (w *worker) upload(ctx context.Context, j *job) (map[string]string, error) {
+	prefix := fmt.Sprintf("processed/%d/%s/", j.VideoID, j.JobID)
+	outputs := map[string]string{
+		artifactProcessedKey: fileOutput,
+		artifactSpriteKey:    fileSprite,
+		artifactSpriteVTTKey: fileSpriteVTT,
+	}
+	for _, size := range media.ThumbSizes {
+		outputs[artifactThumbKeyPrefix+size.Name] = thumbFile(size.Name)
+	}
+	if name := j.artifacts[artifactPreviewFile]; name != "" {
+		outputs[artifactPreviewKey] = name
+	}
+	if _, ok := j.artifacts[filePreviewGIF]; ok {
+		outputs[artifactPreviewGIFKey] = filePreviewGIF
+	}
+	out := map[string]string{}
+	for artifact, name := range outputs {
+		path, err := w.local(ctx, j, name)
+		if err != nil {
+			return nil, err
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("open %s: %w", name, err)
+		}
+		err = w.store.UploadToProcessed(ctx, prefix+name, f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("upload %s: %w", name, err)
+		}
+		out[artifact] = prefix + name
+	}
+	return out, nil
+}
+
+// packageHLS builds the HLS renditions of the final video and publishes them
+// under processed/{videoID}/{jobID}/hls/ (per job, like the MP4, so a
+// reprocessing job never rewrites playlists that are being served).
+func (w *worker) packageHLS(ctx context.Context, j *job) (map[string]string, error) {
+	in, err := w.local(ctx, j, fileOutput)
+	if err != nil {
+		return nil, err
+	}
+	outDir := filepath.Join(j.dir, "hls")
+	if err := os.RemoveAll(outDir); err != nil {
+		return nil, fmt.Errorf("clean hls dir: %w", err)
+	}
+	for _, r := range media.DefaultRenditions {
+		if err := os.MkdirAll(filepath.Join(outDir, r.Name), 0o755); err != nil {
+			return nil, fmt.Errorf("create hls dir: %w", err)
+		}
+	}
+	if err := run(ctx, media.HLS(in, outDir, media.DefaultRenditions, j.profile.AudioPolicy != media.AudioStrip).Exec()); err != nil {
+		return nil, err
+	}
+
+	prefix := fmt.Sprintf("processed/%d/%s/hls/", j.VideoID, j.JobID)
+	err = filepath.WalkDir(outDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(outDir, path)
+		if err != nil {
+			return err
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		if err := w.store.UploadToProcessed(ctx, prefix+filepath.ToSlash(rel), f); err != nil {
+			return fmt.Errorf("upload %s: %w", rel, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return map[string]string{artifactHLSKey: prefix + "master.m3u8"}, nil
+}
+
+// publicURL is the public URL of an optional output, empty when it was not produced
+func (w *worker) publicURL(key string) string {
+	if key == "" {
+		return ""
+	}
+	return w.store.GetProcessedFileURL(key)
+}
+
+func (w *worker) finalize(ctx context.Context, j *job) (map[string]string, error) {
+	thumbs := map[string]string{}
+	for _, size := range media.ThumbSizes {
+		thumbs[size.Name] = w.publicURL(j.artifacts[artifactThumbKeyPrefix+size.Name])
+	}
+	largest := media.ThumbSizes[len(media.ThumbSizes)-1].Name
+	err := w.svc.MarkProcessed(ctx, j.VideoID, models.ProcessedOutputs{
+		ProcessedURL:  w.store.GetProcessedFileURL(j.artifacts[artifactProcessedKey]),
+		ThumbURL:      thumbs[largest],
+		Thumbnails:    thumbs,
+		SpriteURL:     w.publicURL(j.artifacts[artifactSpriteKey]),
+		SpriteVTTURL:  w.publicURL(j.artifacts[artifactSpriteVTTKey]),
+		PreviewURL:    w.publicURL(j.artifacts[artifactPreviewKey]),
+		PreviewGIFURL: w.publicURL(j.artifacts[artifactPreviewGIFKey]),
+		HLSURL:        w.publicURL(j.artifacts[artifactHLSKey]),
+		AudioPolicy:   j.profile.AudioPolicy,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("mark processed: %w", err)
+	}
+	w.dropPreviousOutputs(ctx, j)
+	return nil, nil
+}
+
+// dropPreviousOutputs removes what earlier jobs of the video published under
+// processed/{videoID}/{jobID}/, once this job's outputs replaced them. A
+// reprocess or a replaced source would otherwise keep every old copy until
+// the video is purged. Failures are only logged: the purge still gets them.
+func (w *worker) dropPreviousOutputs(ctx context.Context, j *job) {
+	jobIDs, err := w.svc.JobIDs(ctx, j.VideoID)
+	if err != nil {
+		log.Printf("[worker] cannot list previous jobs video_id=%d: %v", j.VideoID, err)
+		return
+	}
+	for _, id := range jobIDs {
+		if id == j.JobID {
+			continue
+		}
+		prefix := fmt.Sprintf("processed/%d/%s/", j.VideoID, id)
+		if err := w.store.DeletePrefix(ctx, w.store.GetProcessedBucket(), prefix); err != nil {
+			log.Printf("[worker] cannot remove previous outputs %s: %v", prefix, err)
+		}
+	}
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"ISIS4426-Entrega1/app/async"
+	"ISIS4426-Entrega1/internal/storage"
+)
+
+type fakeCheckpoints struct {
+	done  map[string]map[string]string
+	saved []string
+}
+
+func (f *fakeCheckpoints) Load(ctx context.Context, jobID string) (map[string]map[string]string, error) {
+	return f.done, nil
+}
+
+func (f *fakeCheckpoints) Save(ctx context.Context, jobID, stage string, artifacts map[string]string) error {
+	f.saved = append(f.saved, stage)
+	return nil
+}
+
+type fakeStatus struct {
+	mu       sync.Mutex
+	current  string
+	statuses []string
+	failures int
+}
+
+func (f *fakeStatus) SetStatus(ctx context.Context, jobID string, status string, ttl time.Duration) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.statuses = append(f.statuses, status)
+	f.current = status
+	return nil
+}
+
+func (f *fakeStatus) RecordFailure(ctx context.Context, jobID string) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.failures++
+	return f.failures, nil
+}
+
+func (f *fakeStatus) GetStatus(ctx context.Context, jobID string) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.current == "" {
+		return "", errors.New("job not found or expired")
+	}
+	return f.current, nil
+}
+
+func TestRunStages_ResumesAtFirstIncompleteStage(t *testing.T) {
+	cp := &fakeCheckpoints{}
+	w := &worker{status: &fakeStatus{}, checkpoints: cp}
+
+	var ran []string
+	mk := func(name string) stage {
+		return stage{name, func(ctx context.Context, j *job) (map[string]string, error) {
+			ran = append(ran, name)
+			if name == "b" && j.artifacts["a.out"] != "work/j1/a.out" {
+				t.Errorf("artifact de la etapa a no restaurado: %v", j.artifacts)
+			}
+			return map[string]string{name + ".out": "work/j1/" + name + ".out"}, nil
+		}}
+	}
+	done := map[string]map[string]string{"a": {"a.out": "work/j1/a.out"}}
+	j := &job{VideoProcessingPayload: async.VideoProcessingPayload{JobID: "j1"}, artifacts: map[string]string{"a.out": "work/j1/a.out"}}
+
+	if err := w.runStages(context.Background(), j, []stage{mk("a"), mk("b"), mk("c")}, done); err != nil {
+		t.Fatalf("runStages: %v", err)
+	}
+	if want := []string{"b", "c"}; !reflect.DeepEqual(ran, want) {
+		t.Errorf("ran = %v; want %v", ran, want)
+	}
+	if want := []string{"b", "c"}; !reflect.DeepEqual(cp.saved, want) {
+		t.Errorf("checkpoints = %v; want %v", cp.saved, want)
+	}
+	if j.artifacts["c.out"] != "work/j1/c.out" {
+		t.Errorf("artifacts = %v", j.artifacts)
+	}
+}
+
+func TestRunStages_FailureIsNotCheckpointed(t *testing.T) {
+	cp := &fakeCheckpoints{}
+	st := &fakeStatus{}
+	w := &worker{status: st, checkpoints: cp}
+
+	boom := errors.New("ffmpeg boom")
+	stages := []stage{
+		{"trim", func(ctx context.Context, j *job) (map[string]string, error) { return nil, nil }},
+		{"scale", func(ctx context.Context, j *job) (map[string]string, error) { return nil, boom }},
+		{"concat", func(ctx context.Context, j *job) (map[string]string, error) {
+			t.Error("concat no debería ejecutarse")
+			return nil, nil
+		}},
+	}
+	j := &job{artifacts: map[string]string{}}
+	err := w.runStages(context.Background(), j, stages, nil)
+	if !errors.Is(err, boom) {
+		t.Fatalf("err = %v; want %v", err, boom)
+	}
+	if want := []string{"trim"}; !reflect.DeepEqual(cp.saved, want) {
+		t.Errorf("checkpoints = %v; want %v", cp.saved, want)
+	}
+	if st.current != "failed:scale" {
+		t.Errorf("status = %q; want failed:scale", st.current)
+	}
+}
+
+func TestProcessVideo_SkipsFinishedJob(t *testing.T) {
+	cases := map[string]struct {
+		done   map[string]map[string]string
+		status string
+	}{
+		"finalize checkpoint": {done: map[string]map[string]string{stageFinalize: {}}},
+		"status done":         {status: "done"},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			st := &fakeStatus{current: c.status}
+			// svc and store are nil: touching them would panic
+			w := &worker{status: st, checkpoints: &fakeCheckpoints{done: c.done}}
+			err := w.processVideo(context.Background(), async.VideoProcessingPayload{JobID: "j1", VideoID: 3})
+			if err != nil {
+				t.Fatalf("processVideo: %v", err)
+			}
+			if st.current != "done" {
+				t.Errorf("status = %q; want done", st.current)
+			}
+		})
+	}
+}
+
+func TestAsset_SameFileNameInDifferentFolders(t *testing.T) {
+	store, err := storage.NewLocal(t.TempDir(), "http://localhost", "k")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	for _, ref := range []string{"bumpers/intro/anb.mp4", "bumpers/outro/anb.mp4"} {
+		if err := store.UploadToUploads(ctx, ref, strings.NewReader(ref)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	w := &worker{store: store}
+	j := &job{dir: t.TempDir(), artifacts: map[string]string{}}
+
+	for _, ref := range []string{"bumpers/intro/anb.mp4", "bumpers/outro/anb.mp4"} {
+		p, err := w.asset(ctx, j, ref)
+		if err != nil {
+			t.Fatalf("asset(%q) error = %v", ref, err)
+		}
+		b, _ := os.ReadFile(p)
+		if string(b) != ref {
+			t.Errorf("asset(%q) = %q con contenido %q", ref, p, b)
+		}
+	}
+}
+
+func TestDownload_MissingOriginalIsPermanent(t *testing.T) {
+	store, err := storage.NewLocal(t.TempDir(), "http://localhost", "k")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := &worker{store: store}
+	j := &job{VideoProcessingPayload: async.VideoProcessingPayload{JobID: "j1", InputPath: "videos/7/x/clip.mp4"}, dir: t.TempDir(), artifacts: map[string]string{}}
+
+	if _, err := w.download(context.Background(), j); !isPermanent(err) {
+		t.Errorf("download sin original: err = %v; want permanente", err)
+	}
+	// a file missing from the work dir is a local failure, worth a retry
+	if _, err := w.stash(context.Background(), j, "thumb.jpg"); err == nil || isPermanent(err) {
+		t.Errorf("stash sin archivo local: err = %v; want error transitorio", err)
+	}
+}
@@ -0,0 +1,358 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"ISIS4426-Entrega1/app/async"
+	"ISIS4426-Entrega1/app/repos"
+	"ISIS4426-Entrega1/app/services"
+	"ISIS4426-Entrega1/internal/media"
+	"ISIS4426-Entrega1/internal/storage"
+)
+
+// workDirPrefix names the per-job directories created under workRoot
+const workDirPrefix = "video_"
+
+// minVisibility is the shortest visibility timeout the worker accepts: the
+// heartbeat extends every third of it, and SQS counts it in whole seconds.
+const minVisibility = 30 * time.Second
+
+// checkVisibility validates the visibility timeout of received messages
+func checkVisibility(d time.Duration) error {
+	if d < minVisibility || d%time.Second != 0 {
+		return fmt.Errorf("must be a whole number of seconds, at least %s; got %s", minVisibility, d)
+	}
+	return nil
+}
+
+// worker runs a pool of concurrency goroutines fed by a single receive loop.
+// At most concurrency+prefetch messages are held at any time, so messages
+// are not pinned (invisible) while no goroutine can process them.
+type worker struct {
+	queue  async.Queue
+	dlq    async.Queue
+	svc    *services.VideoService
+	users  userStore
+	status statusStore
+	store  storage.Storage
+	policy retryPolicy
+
+	checkpoints checkpointStore
+	rules       media.Rules
+	profiles    *media.Profiles
+	hls         bool // package HLS renditions after the MP4
+
+	previewFormat string // media.PreviewMP4 or media.PreviewWebM
+	previewGIF    bool   // also render the gallery preview as GIF
+
+	concurrency  int
+	prefetch     int
+	visibility   time.Duration
+	jobTimeout   time.Duration
+	drainTimeout time.Duration
+	workRoot     string
+}
+
+// run receives and processes jobs until ctx is cancelled, then drains: jobs
+// already running get drainTimeout to finish before they are cancelled and
+// their messages released; prefetched jobs are released right away.
+func (w *worker) run(ctx context.Context) {
+	w.cleanupWorkDirs()
+	defer w.cleanupWorkDirs()
+
+	// jobs keep running after ctx is cancelled, until the drain deadline
+	execCtx, cancelExec := context.WithCancel(context.Background())
+	defer cancelExec()
+
+	slots := make(chan struct{}, w.concurrency+w.prefetch)
+	jobs := make(chan async.Message, w.concurrency+w.prefetch)
+
+	var wg sync.WaitGroup
+	for i := 0; i < w.concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for msg := range jobs {
+				if ctx.Err() != nil {
+					w.release(msg)
+				} else {
+					w.handle(execCtx, msg)
+				}
+				<-slots
+			}
+		}()
+	}
+
+	for ctx.Err() == nil {
+		n := w.acquire(ctx, slots)
+		if n == 0 {
+			break
+		}
+		msgs, err := w.queue.Receive(ctx, n, w.visibility)
+		if err != nil && ctx.Err() == nil {
+			log.Printf("Recieved error: %v", err)
+			sleep(ctx, 5*time.Second)
+		}
+		for i := len(msgs); i < n; i++ {
+			<-slots
+		}
+		for _, msg := range msgs {
+			if msg.Attributes["JobType"] != async.TypeProcessVideo {
+				// Ignore unrelated messages
+				<-slots
+				continue
+			}
+			jobs <- msg
+		}
+	}
+	close(jobs)
+
+	log.Printf("[worker] shutting down, draining in-flight jobs (deadline %s)", w.drainTimeout)
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(w.drainTimeout):
+		log.Printf("[worker] drain deadline reached, cancelling in-flight jobs")
+		cancelExec()
+		<-done
+	}
+}
+
+// acquire blocks until at least one slot is free and then takes as many free
+// slots as a single receive can use. It returns 0 when ctx is cancelled.
+func (w *worker) acquire(ctx context.Context, slots chan struct{}) int {
+	select {
+	case slots <- struct{}{}:
+	case <-ctx.Done():
+		return 0
+	}
+	n := 1
+	for n < 10 {
+		select {
+		case slots <- struct{}{}:
+			n++
+		default:
+			return n
+		}
+	}
+	return n
+}
+
+// handle processes one job and settles its message: ack on success, nack
+// with backoff on retryable errors, dead-letter once attempts run out.
+// Jobs interrupted by shutdown are released without counting as a failure.
+func (w *worker) handle(ctx context.Context, msg async.Message) {
+	var payload async.VideoProcessingPayload
+	if err := json.Unmarshal(msg.Body, &payload); err != nil {
+		log.Printf("Unmarshal payload error: %v", err)
+		w.deadLetter(msg, permanent(err), msg.ReceiveCount)
+		return
+	}
+
+	leaseCtx, loseLease := context.WithCancelCause(ctx)
+	defer loseLease(nil)
+	procCtx, procCancel := context.WithTimeout(leaseCtx, w.jobTimeout)
+	stopHeartbeat := w.heartbeat(procCtx, msg, loseLease)
+	err := w.processVideo(procCtx, payload)
+	stopHeartbeat()
+	procCancel()
+	if errors.Is(context.Cause(leaseCtx), errLeaseLost) {
+		// another worker owns the message now; it settles the job
+		log.Printf("Job %s abandoned, lease lost: %v", payload.JobID, err)
+		return
+	}
+	if err == nil {
+		if err := w.queue.Ack(context.Background(), msg); err != nil {
+			log.Printf("Delete message failed (job %s): %v", payload.JobID, err)
+		}
+		return
+	}
+	if ctx.Err() != nil {
+		log.Printf("Job %s interrupted by shutdown: %v", payload.JobID, err)
+		_ = w.status.SetStatus(context.Background(), payload.JobID, "queued", 24*time.Hour)
+		w.release(msg)
+		return
+	}
+
+	if w.videoDeleted(payload.VideoID) {
+		log.Printf("Job %s dropped, video %d was deleted while processing: %v", payload.JobID, payload.VideoID, err)
+		w.dropDeleted(msg, payload)
+		return
+	}
+
+	attempt, ferr := w.status.RecordFailure(context.Background(), payload.JobID)
+	if ferr != nil {
+		// without a job status left, fall back to the deliveries of the message
+		log.Printf("Record failure error (job %s): %v", payload.JobID, ferr)
+		attempt = msg.ReceiveCount
+	}
+	if !isPermanent(err) && !w.policy.exhausted(attempt) {
+		delay := w.policy.backoff(attempt)
+		log.Printf("Video processing Failed. Job %s attempt %d/%d, retrying in %s: %v", payload.JobID, attempt, w.policy.maxAttempts, delay, err)
+		_ = w.status.SetStatus(context.Background(), payload.JobID, fmt.Sprintf("retrying:%d", attempt), 24*time.Hour)
+		if err := w.queue.Nack(context.Background(), msg, delay); err != nil {
+			log.Printf("Nack failed (job %s): %v", payload.JobID, err)
+		}
+		return
+	}
+
+	log.Printf("Video processing Failed. Job %s gave up after attempt %d (permanent=%t): %v", payload.JobID, attempt, isPermanent(err), err)
+	mctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	// a failed reprocessing keeps the outputs already published
+	if !payload.Reprocess {
+		if err := w.svc.MarkFailed(mctx, payload.VideoID, failureReason(err)); err != nil {
+			log.Printf("Mark video failed error (video %d): %v", payload.VideoID, err)
+		}
+	}
+	w.removeStaged(mctx, payload.JobID)
+	w.deadLetter(msg, err, attempt)
+}
+
+// videoDeleted reports whether the video of a failed job no longer exists
+func (w *worker) videoDeleted(videoID int) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	_, err := w.svc.GetByID(ctx, videoID)
+	return errors.Is(err, repos.ErrNotFound)
+}
+
+// dropDeleted settles the job of a deleted video: the outputs it may have
+// published after the deletion cleaned up processed/{videoID}/ are removed
+// and the message is acknowledged, not dead-lettered.
+func (w *worker) dropDeleted(msg async.Message, p async.VideoProcessingPayload) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	_ = w.status.SetStatus(ctx, p.JobID, "cancelled", 24*time.Hour)
+	w.removeStaged(ctx, p.JobID)
+	prefix := fmt.Sprintf("processed/%d/%s/", p.VideoID, p.JobID)
+	if err := w.store.DeletePrefix(ctx, w.store.GetProcessedBucket(), prefix); err != nil {
+		log.Printf("[worker] cannot remove outputs %s: %v", prefix, err)
+	}
+	if err := w.queue.Ack(ctx, msg); err != nil {
+		log.Printf("Delete message failed (job %s): %v", p.JobID, err)
+	}
+}
+
+var errLeaseLost = errors.New("message lease lost")
+
+// heartbeat extends the visibility of msg every visibility/3 while its job
+// runs, so long transcodes are never handed to a second worker. If the queue
+// reports that the receipt is stale, or no extension succeeded for a whole
+// visibility timeout, someone else may own the message: the job is cancelled
+// with errLeaseLost. The returned func stops the heartbeat.
+func (w *worker) heartbeat(ctx context.Context, msg async.Message, lose context.CancelCauseFunc) func() {
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		t := time.NewTicker(w.visibility / 3)
+		defer t.Stop()
+		last := time.Now()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C:
+			}
+			ectx, ecancel := context.WithTimeout(ctx, 10*time.Second)
+			err := w.queue.Extend(ectx, msg, w.visibility)
+			ecancel()
+			switch {
+			case err == nil:
+				last = time.Now()
+			case ctx.Err() != nil:
+			case errors.Is(err, async.ErrStaleReceipt), time.Since(last) >= w.visibility:
+				log.Printf("[worker] heartbeat: lease lost for message %s: %v", msg.ID, err)
+				lose(errLeaseLost)
+				return
+			default:
+				// transient; the next tick retries before visibility runs out
+				log.Printf("[worker] heartbeat: extend failed for message %s: %v", msg.ID, err)
+			}
+		}
+	}()
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+// release makes msg visible again immediately for another worker
+func (w *worker) release(msg async.Message) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := w.queue.Nack(ctx, msg, 0); err != nil && !errors.Is(err, async.ErrStaleReceipt) {
+		log.Printf("Release message failed (message %s): %v", msg.ID, err)
+	}
+}
+
+// deadLetter moves msg to the dead-letter queue (when configured) and removes
+// it from the main queue. attempts is recorded along with the cause.
+func (w *worker) deadLetter(msg async.Message, cause error, attempts int) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if w.dlq != nil {
+		attrs := make(map[string]string, len(msg.Attributes)+2)
+		for k, v := range msg.Attributes {
+			attrs[k] = v
+		}
+		attrs["FailureReason"] = failureReason(cause)
+		attrs["Attempts"] = strconv.Itoa(attempts)
+		if err := w.dlq.Enqueue(ctx, msg.Body, attrs); err != nil {
+			// keep the message in the main queue rather than losing it
+			log.Printf("Dead-letter enqueue failed (message %s): %v", msg.ID, err)
+			return
+		}
+	}
+	if err := w.queue.Ack(ctx, msg); err != nil {
+		log.Printf("Delete message failed (message %s): %v", msg.ID, err)
+	}
+}
+
+// cleanupWorkDirs removes job directories left behind by killed workers.
+// Only directories older than jobTimeout are removed, since other worker
+// processes may share workRoot.
+func (w *worker) cleanupWorkDirs() {
+	entries, err := os.ReadDir(w.workRoot)
+	if err != nil {
+		log.Printf("[worker] cleanup: cannot read %s: %v", w.workRoot, err)
+		return
+	}
+	for _, e := range entries {
+		if !e.IsDir() || !strings.HasPrefix(e.Name(), workDirPrefix) {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil || time.Since(info.ModTime()) < w.jobTimeout {
+			continue
+		}
+		dir := filepath.Join(w.workRoot, e.Name())
+		if err := os.RemoveAll(dir); err != nil {
+			log.Printf("[worker] cleanup: cannot remove %s: %v", dir, err)
+			continue
+		}
+		log.Printf("[worker] cleanup: removed stale work dir %s", dir)
+	}
+}
+
+func sleep(ctx context.Context, d time.Duration) {
+	select {
+	case <-ctx.Done():
+	case <-time.After(d):
+	}
+}
@@ -0,0 +1,439 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"ISIS4426-Entrega1/app/async"
+	"ISIS4426-Entrega1/app/models"
+	"ISIS4426-Entrega1/app/repos"
+	"ISIS4426-Entrega1/app/services"
+	"ISIS4426-Entrega1/internal/storage"
+)
+
+// fakeQueue delivers msgs and records how they are settled, and how many
+// were held (received, not yet settled) at most. It records Extend calls;
+// extendErr is returned from the n-th call on. Each call is signalled on
+// extended, when set.
+type fakeQueue struct {
+	mu        sync.Mutex
+	extends   int
+	failFrom  int
+	extendErr error
+	extended  chan struct{}
+
+	msgs     []async.Message
+	held     int
+	maxHeld  int
+	acked    []string
+	nacked   map[string]time.Duration
+	enqueued []map[string]string
+}
+
+func (q *fakeQueue) Enqueue(_ context.Context, _ []byte, attrs map[string]string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.enqueued = append(q.enqueued, attrs)
+	return nil
+}
+
+func (q *fakeQueue) Receive(ctx context.Context, limit int, _ time.Duration) ([]async.Message, error) {
+	q.mu.Lock()
+	n := min(limit, len(q.msgs))
+	out := q.msgs[:n:n]
+	q.msgs = q.msgs[n:]
+	q.held += n
+	q.maxHeld = max(q.maxHeld, q.held)
+	q.mu.Unlock()
+	if n == 0 {
+		sleep(ctx, 5*time.Millisecond)
+	}
+	return out, nil
+}
+
+func (q *fakeQueue) Ack(_ context.Context, m async.Message) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.held--
+	q.acked = append(q.acked, m.ID)
+	return nil
+}
+
+func (q *fakeQueue) Nack(_ context.Context, m async.Message, delay time.Duration) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.held--
+	if q.nacked == nil {
+		q.nacked = map[string]time.Duration{}
+	}
+	q.nacked[m.ID] = delay
+	return nil
+}
+
+func (q *fakeQueue) Ping(context.Context) error { return nil }
+
+func (q *fakeQueue) Extend(context.Context, async.Message, time.Duration) error {
+	q.mu.Lock()
+	q.extends++
+	var err error
+	if q.failFrom > 0 && q.extends >= q.failFrom {
+		err = q.extendErr
+	}
+	q.mu.Unlock()
+	if q.extended != nil {
+		select {
+		case q.extended <- struct{}{}:
+		default:
+		}
+	}
+	return err
+}
+
+func (q *fakeQueue) count() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.extends
+}
+
+// waitExtends blocks until q saw at least n Extend calls, failing the test
+// after a timeout generous enough for a loaded machine
+func waitExtends(t *testing.T, q *fakeQueue, n int) {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for q.count() < n {
+		select {
+		case <-q.extended:
+		case <-timeout:
+			t.Fatalf("se esperaban al menos %d extensiones, hubo %d", n, q.count())
+		}
+	}
+}
+
+func TestHeartbeat_ExtendsUntilStopped(t *testing.T) {
+	q := &fakeQueue{extended: make(chan struct{}, 16)}
+	w := &worker{queue: q, visibility: 30 * time.Millisecond}
+
+	ctx, lose := context.WithCancelCause(context.Background())
+	defer lose(nil)
+	stop := w.heartbeat(ctx, async.Message{ID: "1"}, lose)
+	waitExtends(t, q, 3)
+	stop()
+
+	// stop joined the heartbeat goroutine: nothing may extend from here on
+	n := q.count()
+	time.Sleep(w.visibility)
+	if q.count() != n {
+		t.Error("heartbeat siguió extendiendo después de stop")
+	}
+	if ctx.Err() != nil {
+		t.Errorf("el contexto no debía cancelarse: %v", context.Cause(ctx))
+	}
+}
+
+func TestHeartbeat_StaleReceiptCancelsJob(t *testing.T) {
+	q := &fakeQueue{failFrom: 2, extendErr: async.ErrStaleReceipt}
+	w := &worker{queue: q, visibility: 15 * time.Millisecond}
+
+	ctx, lose := context.WithCancelCause(context.Background())
+	defer lose(nil)
+	stop := w.heartbeat(ctx, async.Message{ID: "1"}, lose)
+	defer stop()
+
+	select {
+	case <-ctx.Done():
+	case <-time.After(time.Second):
+		t.Fatal("el trabajo no se canceló al perder el mensaje")
+	}
+	if !errors.Is(context.Cause(ctx), errLeaseLost) {
+		t.Errorf("cause = %v; want errLeaseLost", context.Cause(ctx))
+	}
+}
+
+func TestHeartbeat_FailingExtendsLoseTheLease(t *testing.T) {
+	q := &fakeQueue{failFrom: 1, extendErr: errors.New("throttled")}
+	w := &worker{queue: q, visibility: 15 * time.Millisecond}
+
+	ctx, lose := context.WithCancelCause(context.Background())
+	defer lose(nil)
+	stop := w.heartbeat(ctx, async.Message{ID: "1"}, lose)
+	defer stop()
+
+	select {
+	case <-ctx.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("el trabajo no se canceló al vencer la visibilidad")
+	}
+	if !errors.Is(context.Cause(ctx), errLeaseLost) {
+		t.Errorf("cause = %v; want errLeaseLost", context.Cause(ctx))
+	}
+	// transient errors are retried until the visibility runs out
+	if q.count() < 2 {
+		t.Errorf("se esperaban reintentos de extensión, hubo %d", q.count())
+	}
+}
+
+func TestCheckVisibility(t *testing.T) {
+	for _, d := range []time.Duration{30 * time.Second, 5 * time.Minute, 12 * time.Hour} {
+		if err := checkVisibility(d); err != nil {
+			t.Errorf("checkVisibility(%s) = %v", d, err)
+		}
+	}
+	for _, d := range []time.Duration{time.Nanosecond, 500 * time.Millisecond, 29 * time.Second, 90500 * time.Millisecond} {
+		if err := checkVisibility(d); err == nil {
+			t.Errorf("checkVisibility(%s) debería fallar", d)
+		}
+	}
+}
+
+// gatedCheckpoints holds every job in Load until open is closed, when the
+// job turns out to be finished already, or until the job is cancelled
+type gatedCheckpoints struct{ open chan struct{} }
+
+func (g *gatedCheckpoints) Load(ctx context.Context, jobID string) (map[string]map[string]string, error) {
+	select {
+	case <-g.open:
+		return map[string]map[string]string{stageFinalize: {}}, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (g *gatedCheckpoints) Save(context.Context, string, string, map[string]string) error { return nil }
+
+func jobMessages(n int) []async.Message {
+	msgs := make([]async.Message, n)
+	for i := range msgs {
+		id := strconv.Itoa(i + 1)
+		msgs[i] = async.Message{
+			ID:         id,
+			Body:       []byte(`{"job_id":"j` + id + `","video_id":` + id + `}`),
+			Attributes: map[string]string{"JobType": async.TypeProcessVideo},
+		}
+	}
+	return msgs
+}
+
+func newPoolWorker(t *testing.T, q *fakeQueue, concurrency, prefetch int) (*worker, *gatedCheckpoints, *fakeStatus) {
+	cp := &gatedCheckpoints{open: make(chan struct{})}
+	st := &fakeStatus{}
+	return &worker{
+		queue: q, status: st, checkpoints: cp,
+		concurrency: concurrency, prefetch: prefetch,
+		visibility: time.Minute, jobTimeout: time.Minute, drainTimeout: time.Minute,
+		workRoot: t.TempDir(),
+	}, cp, st
+}
+
+// waitFor polls cond until it holds, failing the test after a generous timeout
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timeout esperando: %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func (q *fakeQueue) settled() (held, maxHeld int, acked []string, nacked map[string]time.Duration) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	nacked = make(map[string]time.Duration, len(q.nacked))
+	for k, v := range q.nacked {
+		nacked[k] = v
+	}
+	return q.held, q.maxHeld, append([]string(nil), q.acked...), nacked
+}
+
+func TestRun_HoldsAtMostConcurrencyPlusPrefetch(t *testing.T) {
+	q := &fakeQueue{msgs: jobMessages(20)}
+	w, cp, _ := newPoolWorker(t, q, 2, 2)
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		w.run(ctx)
+		close(stopped)
+	}()
+
+	waitFor(t, "4 mensajes reservados", func() bool { held, _, _, _ := q.settled(); return held == 4 })
+	// with every slot taken, the loop must not receive more
+	time.Sleep(20 * time.Millisecond)
+	if held, _, _, _ := q.settled(); held != 4 {
+		t.Errorf("reservados = %d; want 4", held)
+	}
+
+	close(cp.open)
+	waitFor(t, "20 mensajes confirmados", func() bool { _, _, acked, _ := q.settled(); return len(acked) == 20 })
+	cancel()
+	<-stopped
+
+	if _, maxHeld, _, nacked := q.settled(); maxHeld > 4 || len(nacked) != 0 {
+		t.Errorf("máximo reservado = %d (want <= 4), nacks = %v", maxHeld, nacked)
+	}
+}
+
+func TestRun_ReleasesPrefetchedOnShutdown(t *testing.T) {
+	q := &fakeQueue{msgs: jobMessages(3)}
+	w, cp, _ := newPoolWorker(t, q, 1, 2)
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		w.run(ctx)
+		close(stopped)
+	}()
+
+	waitFor(t, "3 mensajes reservados", func() bool { held, _, _, _ := q.settled(); return held == 3 })
+	cancel()
+	// the job in progress finishes within the drain deadline
+	close(cp.open)
+	<-stopped
+
+	_, _, acked, nacked := q.settled()
+	if len(acked) != 1 || acked[0] != "1" {
+		t.Errorf("confirmados = %v; want [1]", acked)
+	}
+	want := map[string]time.Duration{"2": 0, "3": 0}
+	if !reflect.DeepEqual(nacked, want) {
+		t.Errorf("liberados = %v; want %v", nacked, want)
+	}
+}
+
+func TestRun_CancelsInFlightJobsAtDrainDeadline(t *testing.T) {
+	q := &fakeQueue{msgs: jobMessages(1)}
+	w, _, st := newPoolWorker(t, q, 1, 0)
+	w.drainTimeout = 20 * time.Millisecond
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		w.run(ctx)
+		close(stopped)
+	}()
+
+	waitFor(t, "1 mensaje reservado", func() bool { held, _, _, _ := q.settled(); return held == 1 })
+	cancel()
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("run no terminó tras el plazo de drenado")
+	}
+
+	held, _, acked, nacked := q.settled()
+	if held != 0 || len(acked) != 0 || !reflect.DeepEqual(nacked, map[string]time.Duration{"1": 0}) {
+		t.Errorf("held = %d, acks = %v, nacks = %v; want el mensaje 1 liberado", held, acked, nacked)
+	}
+	if st.current != "queued" || st.failures != 0 {
+		t.Errorf("estado = %q, fallos = %d; want queued sin fallos", st.current, st.failures)
+	}
+}
+
+// failingCheckpoints fails every job at its first step with err
+type failingCheckpoints struct{ err error }
+
+func (f failingCheckpoints) Load(context.Context, string) (map[string]map[string]string, error) {
+	return nil, f.err
+}
+
+func (f failingCheckpoints) Save(context.Context, string, string, map[string]string) error {
+	return nil
+}
+
+// fakeVideos implements the video repository calls made while settling a
+// job; any other call panics on the nil embedded interface
+type fakeVideos struct {
+	services.VideoRepo
+	deleted bool
+	failed  map[int]string
+}
+
+func (f *fakeVideos) GetByID(_ context.Context, id int) (*models.Video, error) {
+	if f.deleted {
+		return nil, repos.ErrNotFound
+	}
+	return &models.Video{VideoID: id}, nil
+}
+
+func (f *fakeVideos) MarkFailed(_ context.Context, id int, reason string, _ time.Time) error {
+	f.failed[id] = reason
+	return nil
+}
+
+func TestHandle_SettlesFailedJobs(t *testing.T) {
+	cases := []struct {
+		name      string
+		err       error
+		failures  int // recorded before this attempt
+		reprocess bool
+		deleted   bool
+
+		wantNack   time.Duration // -1: not nacked
+		wantDLQ    bool
+		wantFailed bool
+		wantAcked  bool
+		wantStatus string
+	}{
+		{name: "reintentable", err: errors.New("db down"), failures: 1,
+			wantNack: time.Minute, wantStatus: "retrying:2"},
+		{name: "intentos agotados", err: errors.New("db down"), failures: 2,
+			wantNack: -1, wantDLQ: true, wantFailed: true, wantAcked: true},
+		{name: "permanente", err: permanent(errors.New("bad payload")),
+			wantNack: -1, wantDLQ: true, wantFailed: true, wantAcked: true},
+		{name: "reprocesamiento agotado", err: errors.New("db down"), failures: 2, reprocess: true,
+			wantNack: -1, wantDLQ: true, wantAcked: true},
+		{name: "video eliminado", err: errors.New("db down"), deleted: true,
+			wantNack: -1, wantAcked: true, wantStatus: "cancelled"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			store, err := storage.NewLocal(t.TempDir(), "http://localhost", "k")
+			if err != nil {
+				t.Fatal(err)
+			}
+			q, dlq := &fakeQueue{}, &fakeQueue{}
+			videos := &fakeVideos{deleted: c.deleted, failed: map[int]string{}}
+			st := &fakeStatus{failures: c.failures}
+			w := &worker{
+				queue: q, dlq: dlq, status: st, store: store,
+				svc:         services.NewVideoService(videos, nil),
+				checkpoints: failingCheckpoints{err: c.err},
+				policy:      retryPolicy{maxAttempts: 3, baseDelay: 30 * time.Second, maxDelay: 5 * time.Minute},
+				visibility:  time.Minute, jobTimeout: time.Minute,
+			}
+			body := `{"job_id":"j1","video_id":9,"reprocess":` + strconv.FormatBool(c.reprocess) + `}`
+			msg := async.Message{ID: "m1", Body: []byte(body), ReceiveCount: 7,
+				Attributes: map[string]string{"JobType": async.TypeProcessVideo}}
+
+			w.handle(context.Background(), msg)
+
+			_, _, acked, nacked := q.settled()
+			if delay, ok := nacked["m1"]; ok != (c.wantNack >= 0) || (ok && delay != c.wantNack) {
+				t.Errorf("nacks = %v; want delay %s", nacked, c.wantNack)
+			}
+			if (len(acked) == 1) != c.wantAcked {
+				t.Errorf("acks = %v; want acked %t", acked, c.wantAcked)
+			}
+			if (len(dlq.enqueued) == 1) != c.wantDLQ {
+				t.Fatalf("dead-letter = %v; want %t", dlq.enqueued, c.wantDLQ)
+			}
+			if c.wantDLQ {
+				attrs := dlq.enqueued[0]
+				if attrs["Attempts"] != strconv.Itoa(c.failures+1) || !strings.Contains(attrs["FailureReason"], c.err.Error()) {
+					t.Errorf("atributos dead-letter = %v", attrs)
+				}
+			}
+			reason, failed := videos.failed[9]
+			if failed != c.wantFailed || (failed && !strings.Contains(reason, c.err.Error())) {
+				t.Errorf("MarkFailed = %q (%t); want %t", reason, failed, c.wantFailed)
+			}
+			if c.wantStatus != "" && st.current != c.wantStatus {
+				t.Errorf("estado = %q; want %q", st.current, c.wantStatus)
+			}
+		})
+	}
+}
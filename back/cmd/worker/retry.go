@@ -0,0 +1,79 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"ISIS4426-Entrega1/app/repos"
+)
+
+// retryPolicy decides how failed jobs are retried. Attempts are the failures
+// recorded on the job status, not the deliveries counted by the queue (SQS
+// ApproximateReceiveCount, jobs.receive_count), which also grow when a job is
+// released on shutdown or its lease is lost.
+type retryPolicy struct {
+	maxAttempts int
+	baseDelay   time.Duration
+	maxDelay    time.Duration
+}
+
+// backoff returns the delay before attempt+1: baseDelay doubled per attempt, capped at maxDelay
+func (p retryPolicy) backoff(attempt int) time.Duration {
+	d := p.baseDelay
+	for i := 1; i < attempt && d < p.maxDelay; i++ {
+		d *= 2
+	}
+	if d > p.maxDelay {
+		d = p.maxDelay
+	}
+	return d
+}
+
+// exhausted reports whether no more attempts are left after attempt
+func (p retryPolicy) exhausted(attempt int) bool {
+	return attempt >= p.maxAttempts
+}
+
+// permanentError marks a failure that retrying cannot fix
+type permanentError struct{ err error }
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+func permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+// isPermanent classifies err: explicit permanent errors, such as a missing
+// original (see worker.download), plus missing videos are never retried.
+func isPermanent(err error) bool {
+	var p *permanentError
+	if errors.As(err, &p) {
+		return true
+	}
+	return errors.Is(err, repos.ErrNotFound) || errors.Is(err, sql.ErrNoRows)
+}
+
+// failureReason is the short message stored on the video: the first line of
+// the error, without the ffmpeg output appended by run.
+func failureReason(err error) string {
+	msg, _, _ := strings.Cut(err.Error(), "\n")
+	const max = 500
+	if len(msg) > max {
+		msg = strings.ToValidUTF8(msg[:max], "")
+	}
+	return msg
+}
+
+// invalidInput reports whether ffmpeg output says the input itself is
+// unreadable, which no retry will fix.
+func invalidInput(output []byte) bool {
+	out := string(output)
+	return strings.Contains(out, "Invalid data found when processing input") ||
+		strings.Contains(out, "moov atom not found")
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"ISIS4426-Entrega1/app/repos"
+)
+
+func TestRetryPolicy_Backoff(t *testing.T) {
+	p := retryPolicy{maxAttempts: 5, baseDelay: 30 * time.Second, maxDelay: 5 * time.Minute}
+
+	cases := map[int]time.Duration{
+		0: 30 * time.Second,
+		1: 30 * time.Second,
+		2: time.Minute,
+		3: 2 * time.Minute,
+		4: 4 * time.Minute,
+		5: 5 * time.Minute, // capped
+		9: 5 * time.Minute,
+	}
+	for attempt, want := range cases {
+		if got := p.backoff(attempt); got != want {
+			t.Errorf("backoff(%d) = %s; want %s", attempt, got, want)
+		}
+	}
+	if p.exhausted(4) || !p.exhausted(5) {
+		t.Error("exhausted debería ser true a partir de maxAttempts")
+	}
+}
+
+func TestIsPermanent(t *testing.T) {
+	cases := []struct {
+		err  error
+		want bool
+	}{
+		{errors.New("network timeout"), false},
+		{permanent(errors.New("bad payload")), true},
+		{fmt.Errorf("update status: %w", repos.ErrNotFound), true},
+		{permanent(fmt.Errorf("download original: %w", errObjectMissing)), true},
+		{fmt.Errorf("open thumb.jpg: %w", os.ErrNotExist), false},
+	}
+	for _, c := range cases {
+		if got := isPermanent(c.err); got != c.want {
+			t.Errorf("isPermanent(%v) = %t; want %t", c.err, got, c.want)
+		}
+	}
+}
+
+func TestFailureReason_FirstLineTruncated(t *testing.T) {
+	err := errors.New("trim: command failed\noutput:\nffmpeg noise")
+	if got := failureReason(err); got != "trim: command failed" {
+		t.Errorf("failureReason = %q", got)
+	}
+	long := errors.New(strings.Repeat("é", 400))
+	if got := failureReason(long); len(got) > 500 || !strings.HasPrefix(got, "é") {
+		t.Errorf("failureReason no truncó correctamente: len=%d", len(got))
+	}
+}
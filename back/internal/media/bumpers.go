@@ -0,0 +1,43 @@
+package media
+
+import (
+	"fmt"
+	"time"
+)
+
+// joinSlack is the drift tolerated between the joined video and the sum of
+// its clips (frame rounding at each boundary).
+const joinSlack = 500 * time.Millisecond
+
+// FitBumpers returns how much of the intro and outro to keep so that together
+// they last at most budget. When they do not fit, both are shortened in
+// proportion to their length; a zero duration means the bumper is absent.
+func FitBumpers(intro, outro, budget time.Duration) (time.Duration, time.Duration) {
+	total := intro + outro
+	if total <= budget {
+		return intro, outro
+	}
+	keepIntro := time.Duration(float64(budget) * float64(intro) / float64(total)).Truncate(time.Millisecond)
+	keepOutro := (budget - keepIntro).Truncate(time.Millisecond)
+	if outro == 0 {
+		keepOutro = 0
+	}
+	return keepIntro, keepOutro
+}
+
+// CheckDuration verifies a joined video: it must last what its clips add up
+// to, and no more than limit.
+func CheckDuration(actual, expected, limit time.Duration) error {
+	if diff := actual - expected; diff > joinSlack || diff < -joinSlack {
+		return fmt.Errorf("joined video lasts %s, clips add up to %s", actual, expected)
+	}
+	if actual > limit+joinSlack {
+		return fmt.Errorf("joined video lasts %s, over the %s limit", actual, limit)
+	}
+	return nil
+}
+
+// Seconds converts a probed duration in seconds to a time.Duration
+func Seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
@@ -0,0 +1,44 @@
+package media
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFitBumpers(t *testing.T) {
+	s := time.Second
+	cases := []struct {
+		intro, outro, budget time.Duration
+		wantIntro, wantOutro time.Duration
+	}{
+		{2 * s, 3 * s, 5 * s, 2 * s, 3 * s}, // cabe justo
+		{1 * s, 2 * s, 5 * s, 1 * s, 2 * s}, // sobra presupuesto
+		{4 * s, 4 * s, 5 * s, 2500 * time.Millisecond, 2500 * time.Millisecond},
+		{6 * s, 2 * s, 5 * s, 3750 * time.Millisecond, 1250 * time.Millisecond},
+		{8 * s, 0, 5 * s, 5 * s, 0}, // sin outro
+		{3 * s, 3 * s, 0, 0, 0},     // sin presupuesto
+	}
+	for _, c := range cases {
+		gotIntro, gotOutro := FitBumpers(c.intro, c.outro, c.budget)
+		if gotIntro != c.wantIntro || gotOutro != c.wantOutro {
+			t.Errorf("FitBumpers(%s, %s, %s) = %s, %s; want %s, %s",
+				c.intro, c.outro, c.budget, gotIntro, gotOutro, c.wantIntro, c.wantOutro)
+		}
+		if gotIntro+gotOutro > c.budget {
+			t.Errorf("FitBumpers(%s, %s, %s) excede el presupuesto", c.intro, c.outro, c.budget)
+		}
+	}
+}
+
+func TestCheckDuration(t *testing.T) {
+	s := time.Second
+	if err := CheckDuration(35*s+100*time.Millisecond, 35*s, 35*s); err != nil {
+		t.Errorf("dentro de la tolerancia: %v", err)
+	}
+	if err := CheckDuration(30*s, 35*s, 35*s); err == nil {
+		t.Error("debería fallar si falta un segmento")
+	}
+	if err := CheckDuration(40*s, 40*s, 35*s); err == nil {
+		t.Error("debería fallar si supera el límite")
+	}
+}
@@ -0,0 +1,332 @@
+package media
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Command is a typed ffmpeg invocation. Args renders it in a fixed order, so
+// builders can be tested against expected argument lists.
+type Command struct {
+	Inputs []Input
+	Filter string   // -filter_complex graph
+	Maps   []string // -map selectors
+	Output []string // output options
+	Target string   // output file or pattern
+}
+
+// Input is one -i source with the options that must precede it
+type Input struct {
+	Options []string
+	Path    string
+}
+
+// Args returns the ffmpeg arguments, without the program name
+func (c Command) Args() []string {
+	args := []string{"-y"}
+	for _, in := range c.Inputs {
+		args = append(args, in.Options...)
+		args = append(args, "-i", in.Path)
+	}
+	if c.Filter != "" {
+		args = append(args, "-filter_complex", c.Filter)
+	}
+	for _, m := range c.Maps {
+		args = append(args, "-map", m)
+	}
+	args = append(args, c.Output...)
+	return append(args, c.Target)
+}
+
+// Exec returns the command ready to run
+func (c Command) Exec() *exec.Cmd {
+	return exec.Command("ffmpeg", c.Args()...)
+}
+
+// seconds formats d for ffmpeg time options ("30", "2.5")
+func seconds(d time.Duration) string {
+	return strconv.FormatFloat(d.Seconds(), 'f', -1, 64)
+}
+
+// Trim keeps the first MaxDuration of in, copying streams
+func (p Profile) Trim(in, out string) Command {
+	return Command{
+		Inputs: []Input{{Path: in}},
+		Output: []string{"-t", seconds(p.MaxDuration), "-c", "copy"},
+		Target: out,
+	}
+}
+
+// Clip is an input to Scale
+type Clip struct {
+	Path     string
+	Limit    time.Duration // keep at most this much; 0 keeps everything
+	HasAudio bool
+}
+
+// Scale fits the clip into Width x Height without distortion (letterboxed) at
+// the profile frame rate. Every clip goes through Scale, so all segments share
+// resolution, SAR and fps. When the policy joins audio, every segment gets a
+// 48kHz stereo track, silent for clips that have none.
+func (p Profile) Scale(c Clip, out string) Command {
+	vf := fmt.Sprintf("scale=w=%d:h=%d:force_original_aspect_ratio=decrease,pad=%d:%d:(ow-iw)/2:(oh-ih)/2,setsar=1",
+		p.Width, p.Height, p.Width, p.Height)
+	if p.FPS > 0 {
+		vf += fmt.Sprintf(",fps=%d", p.FPS)
+	}
+	cmd := Command{Inputs: []Input{{Path: c.Path}}, Target: out}
+	if p.SegmentAudio() {
+		if c.HasAudio {
+			cmd.Maps = []string{"0:v:0", "0:a:0"}
+		} else {
+			cmd.Inputs = append(cmd.Inputs, Input{Options: []string{"-f", "lavfi"}, Path: silence})
+			cmd.Maps = []string{"0:v:0", "1:a"}
+		}
+	}
+	if c.Limit > 0 {
+		cmd.Output = append(cmd.Output, "-t", seconds(c.Limit))
+	}
+	cmd.Output = append(cmd.Output, "-vf", vf)
+	cmd.Output = append(cmd.Output, p.videoArgs()...)
+	cmd.Output = append(cmd.Output, p.audioArgs()...)
+	if p.SegmentAudio() && !c.HasAudio {
+		cmd.Output = append(cmd.Output, "-shortest")
+	}
+	return cmd
+}
+
+// silence is the lavfi source used for clips without audio
+const silence = "anullsrc=channel_layout=stereo:sample_rate=48000"
+
+func (p Profile) videoArgs() []string {
+	args := []string{"-c:v", p.VideoCodec}
+	if p.Preset != "" {
+		args = append(args, "-preset", p.Preset)
+	}
+	switch {
+	case p.VideoBitrate != "":
+		args = append(args, "-b:v", p.VideoBitrate)
+	case p.CRF > 0:
+		args = append(args, "-crf", strconv.Itoa(p.CRF))
+	}
+	return append(args, "-pix_fmt", "yuv420p")
+}
+
+// audioArgs are the audio output options of segments: dropped unless the
+// policy joins the segment audio.
+func (p Profile) audioArgs() []string {
+	if !p.SegmentAudio() {
+		return []string{"-an"}
+	}
+	return p.audioEncodeArgs()
+}
+
+func (p Profile) audioEncodeArgs() []string {
+	args := []string{"-c:a", p.AudioCodec}
+	if p.AudioBitrate != "" {
+		args = append(args, "-b:a", p.AudioBitrate)
+	}
+	return append(args, "-ar", "48000", "-ac", "2")
+}
+
+// Concat joins clips with the concat filter and re-encodes the result, so
+// segments with different timebases or encoder settings still join cleanly.
+// Timestamps are reset per clip; audio is joined when the policy keeps it.
+func (p Profile) Concat(clips []string, out string) Command {
+	audio := p.SegmentAudio()
+	var filter, joined strings.Builder
+	inputs := make([]Input, len(clips))
+	for i, c := range clips {
+		inputs[i] = Input{Path: c}
+		fmt.Fprintf(&filter, "[%d:v]settb=AVTB,setpts=PTS-STARTPTS[v%d];", i, i)
+		fmt.Fprintf(&joined, "[v%d]", i)
+		if audio {
+			fmt.Fprintf(&filter, "[%d:a]asetpts=PTS-STARTPTS[a%d];", i, i)
+			fmt.Fprintf(&joined, "[a%d]", i)
+		}
+	}
+	maps := []string{"[v]"}
+	if audio {
+		fmt.Fprintf(&filter, "%sconcat=n=%d:v=1:a=1[v][a]", joined.String(), len(clips))
+		maps = append(maps, "[a]")
+	} else {
+		fmt.Fprintf(&filter, "%sconcat=n=%d:v=1:a=0[v]", joined.String(), len(clips))
+	}
+	opts := p.videoArgs()
+	opts = append(opts, p.audioArgs()...)
+	return Command{
+		Inputs: inputs,
+		Filter: filter.String(),
+		Maps:   maps,
+		Output: append(opts, "-movflags", "+faststart"),
+		Target: out,
+	}
+}
+
+// Mute drops every audio stream and copies the video
+func (p Profile) Mute(in, out string) Command {
+	return Command{
+		Inputs: []Input{{Path: in}},
+		Output: []string{"-an", "-c:v", "copy"},
+		Target: out,
+	}
+}
+
+// Remux copies every stream unchanged
+func (p Profile) Remux(in, out string) Command {
+	return Command{
+		Inputs: []Input{{Path: in}},
+		Output: []string{"-c", "copy", "-movflags", "+faststart"},
+		Target: out,
+	}
+}
+
+// loudnormTarget is the EBU R128 target of the profile: integrated loudness,
+// true peak and loudness range.
+func (p Profile) loudnormTarget() string {
+	return fmt.Sprintf("I=%s:TP=-1.5:LRA=11", strconv.FormatFloat(p.Loudness, 'f', -1, 64))
+}
+
+// LoudnessScan is the first loudnorm pass: it measures in and prints the
+// result as JSON on stderr (see ParseLoudness).
+func (p Profile) LoudnessScan(in string) Command {
+	return Command{
+		Inputs: []Input{{Path: in}},
+		Output: []string{"-vn", "-af", "loudnorm=" + p.loudnormTarget() + ":print_format=json", "-f", "null"},
+		Target: "-",
+	}
+}
+
+// Normalize is the second loudnorm pass: a linear gain computed from m
+// brings the audio to the profile loudness. The video is copied.
+func (p Profile) Normalize(in, out string, m Loudness) Command {
+	af := fmt.Sprintf("loudnorm=%s:measured_I=%s:measured_TP=%s:measured_LRA=%s:measured_thresh=%s:offset=%s:linear=true",
+		p.loudnormTarget(), m.InputI, m.InputTP, m.InputLRA, m.InputThresh, m.TargetOffset)
+	opts := []string{"-af", af, "-c:v", "copy"}
+	opts = append(opts, p.audioEncodeArgs()...)
+	return Command{
+		Inputs: []Input{{Path: in}},
+		Maps:   []string{"0:v:0", "0:a:0"},
+		Output: append(opts, "-movflags", "+faststart"),
+		Target: out,
+	}
+}
+
+// ReplaceAudio drops the audio of in and lays track under the video, looping
+// it when it is shorter.
+func (p Profile) ReplaceAudio(in, track, out string) Command {
+	opts := []string{"-c:v", "copy"}
+	opts = append(opts, p.audioEncodeArgs()...)
+	return Command{
+		Inputs: []Input{{Path: in}, {Options: []string{"-stream_loop", "-1"}, Path: track}},
+		Maps:   []string{"0:v:0", "1:a:0"},
+		Output: append(opts, "-shortest", "-movflags", "+faststart"),
+		Target: out,
+	}
+}
+
+// Loudness is the measurement printed by the first loudnorm pass. Values are
+// kept as printed, since they are passed back to ffmpeg verbatim.
+type Loudness struct {
+	InputI       string `json:"input_i"`
+	InputTP      string `json:"input_tp"`
+	InputLRA     string `json:"input_lra"`
+	InputThresh  string `json:"input_thresh"`
+	TargetOffset string `json:"target_offset"`
+}
+
+// Silent reports whether the measured audio is silence, which loudnorm
+// cannot normalize (integrated loudness -inf).
+func (l Loudness) Silent() bool {
+	i, err := strconv.ParseFloat(l.InputI, 64)
+	return err != nil || math.IsInf(i, -1) || i < -70
+}
+
+// ParseLoudness extracts the loudnorm JSON block from ffmpeg output
+func ParseLoudness(output []byte) (Loudness, error) {
+	var l Loudness
+	start := bytes.LastIndexByte(output, '{')
+	end := bytes.LastIndexByte(output, '}')
+	if start < 0 || end < start {
+		return l, errors.New("loudnorm measurement not found in ffmpeg output")
+	}
+	if err := json.Unmarshal(output[start:end+1], &l); err != nil {
+		return l, fmt.Errorf("decode loudnorm measurement: %w", err)
+	}
+	if l.InputI == "" {
+		return l, errors.New("loudnorm measurement is incomplete")
+	}
+	return l, nil
+}
+
+// Rendition is one HLS variant, scaled to Height keeping the aspect ratio
+type Rendition struct {
+	Name    string
+	Height  int
+	Bitrate string
+}
+
+// DefaultRenditions are the HLS variants served to the public gallery
+var DefaultRenditions = []Rendition{
+	{"360p", 360, "800k"},
+	{"480p", 480, "1400k"},
+	{"720p", 720, "2800k"},
+}
+
+// HLS encodes every rendition in a single pass and writes outDir/master.m3u8
+// plus outDir/{name}/index.m3u8 and its segments. Keyframes every 48 frames
+// keep the 4s segments aligned across variants. With audio, every variant
+// carries its own AAC copy of the first audio track.
+func HLS(in, outDir string, renditions []Rendition, audio bool) Command {
+	var filter strings.Builder
+	fmt.Fprintf(&filter, "[0:v]split=%d", len(renditions))
+	for i := range renditions {
+		fmt.Fprintf(&filter, "[s%d]", i)
+	}
+	var maps, opts, streamMap []string
+	for i, r := range renditions {
+		fmt.Fprintf(&filter, ";[s%d]scale=w=-2:h=%d[v%d]", i, r.Height, i)
+		maps = append(maps, fmt.Sprintf("[v%d]", i))
+		opts = append(opts,
+			fmt.Sprintf("-c:v:%d", i), "libx264",
+			fmt.Sprintf("-b:v:%d", i), r.Bitrate,
+			fmt.Sprintf("-maxrate:v:%d", i), r.Bitrate,
+			fmt.Sprintf("-bufsize:v:%d", i), r.Bitrate,
+		)
+		if audio {
+			streamMap = append(streamMap, fmt.Sprintf("v:%d,a:%d,name:%s", i, i, r.Name))
+		} else {
+			streamMap = append(streamMap, fmt.Sprintf("v:%d,name:%s", i, r.Name))
+		}
+	}
+	if audio {
+		for range renditions {
+			maps = append(maps, "0:a:0")
+		}
+		opts = append(opts, "-c:a", "aac", "-b:a", "128k", "-ac", "2")
+	} else {
+		opts = append(opts, "-an")
+	}
+	opts = append(opts,
+		"-preset", "veryfast", "-g", "48", "-keyint_min", "48", "-sc_threshold", "0",
+		"-f", "hls", "-hls_time", "4", "-hls_playlist_type", "vod",
+		"-hls_segment_filename", filepath.Join(outDir, "%v", "seg_%03d.ts"),
+		"-master_pl_name", "master.m3u8",
+		"-var_stream_map", strings.Join(streamMap, " "),
+	)
+	return Command{
+		Inputs: []Input{{Path: in}},
+		Filter: filter.String(),
+		Maps:   maps,
+		Output: opts,
+		Target: filepath.Join(outDir, "%v", "index.m3u8"),
+	}
+}
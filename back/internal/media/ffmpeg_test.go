@@ -0,0 +1,182 @@
+package media
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDefaultProfile_Commands(t *testing.T) {
+	p := DefaultProfile()
+
+	cases := []struct {
+		name string
+		cmd  Command
+		want []string
+	}{
+		{"trim", p.Trim("in.mp4", "trim.mp4"),
+			[]string{"-y", "-i", "in.mp4", "-t", "30", "-c", "copy", "trim.mp4"}},
+		{"scale", p.Scale(Clip{Path: "trim.mp4", Limit: 30 * time.Second}, "720.mp4"),
+			[]string{"-y", "-i", "trim.mp4", "-t", "30",
+				"-vf", "scale=w=1280:h=720:force_original_aspect_ratio=decrease,pad=1280:720:(ow-iw)/2:(oh-ih)/2,setsar=1,fps=30",
+				"-c:v", "libx264", "-preset", "veryfast", "-crf", "23", "-pix_fmt", "yuv420p", "-an", "720.mp4"}},
+		{"concat", p.Concat([]string{"intro.mp4", "main.mp4", "outro.mp4"}, "final.mp4"),
+			[]string{"-y", "-i", "intro.mp4", "-i", "main.mp4", "-i", "outro.mp4",
+				"-filter_complex", "[0:v]settb=AVTB,setpts=PTS-STARTPTS[v0];[1:v]settb=AVTB,setpts=PTS-STARTPTS[v1];" +
+					"[2:v]settb=AVTB,setpts=PTS-STARTPTS[v2];[v0][v1][v2]concat=n=3:v=1:a=0[v]",
+				"-map", "[v]",
+				"-c:v", "libx264", "-preset", "veryfast", "-crf", "23", "-pix_fmt", "yuv420p", "-an",
+				"-movflags", "+faststart", "final.mp4"}},
+		{"mute", p.Mute("final.mp4", "noaudio.mp4"),
+			[]string{"-y", "-i", "final.mp4", "-an", "-c:v", "copy", "noaudio.mp4"}},
+	}
+	for _, c := range cases {
+		if got := c.cmd.Args(); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s:\n got  %q\n want %q", c.name, got, c.want)
+		}
+	}
+}
+
+func TestProfile_ScaleWithBitrateAndAudio(t *testing.T) {
+	p := DefaultProfile()
+	p.Width, p.Height = 1920, 1080
+	p.VideoBitrate = "5M"
+	p.AudioPolicy = AudioKeep
+	p.Preset = ""
+	p.FPS = 0
+
+	got := p.Scale(Clip{Path: "a.mp4", HasAudio: true}, "b.mp4").Args()
+	want := []string{"-y", "-i", "a.mp4", "-map", "0:v:0", "-map", "0:a:0",
+		"-vf", "scale=w=1920:h=1080:force_original_aspect_ratio=decrease,pad=1920:1080:(ow-iw)/2:(oh-ih)/2,setsar=1",
+		"-c:v", "libx264", "-b:v", "5M", "-pix_fmt", "yuv420p", "-c:a", "aac", "-b:a", "128k", "-ar", "48000", "-ac", "2", "b.mp4"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("\n got  %q\n want %q", got, want)
+	}
+}
+
+func TestProfile_ScaleAddsSilenceToMutedClips(t *testing.T) {
+	p := DefaultProfile()
+	p.AudioPolicy = AudioNormalize
+
+	args := strings.Join(p.Scale(Clip{Path: "intro.mp4"}, "out.mp4").Args(), " ")
+	for _, want := range []string{
+		"-i intro.mp4 -f lavfi -i anullsrc=channel_layout=stereo:sample_rate=48000",
+		"-map 0:v:0 -map 1:a",
+		"-shortest out.mp4",
+	} {
+		if !strings.Contains(args, want) {
+			t.Errorf("args sin %q:\n%s", want, args)
+		}
+	}
+}
+
+func TestProfile_ConcatWithAudio(t *testing.T) {
+	p := DefaultProfile()
+	p.AudioPolicy = "keep"
+
+	cmd := p.Concat([]string{"a.mp4", "b.mp4"}, "out.mp4")
+	wantFilter := "[0:v]settb=AVTB,setpts=PTS-STARTPTS[v0];[0:a]asetpts=PTS-STARTPTS[a0];" +
+		"[1:v]settb=AVTB,setpts=PTS-STARTPTS[v1];[1:a]asetpts=PTS-STARTPTS[a1];" +
+		"[v0][a0][v1][a1]concat=n=2:v=1:a=1[v][a]"
+	if cmd.Filter != wantFilter {
+		t.Errorf("filter:\n got  %s\n want %s", cmd.Filter, wantFilter)
+	}
+	if !reflect.DeepEqual(cmd.Maps, []string{"[v]", "[a]"}) {
+		t.Errorf("maps = %q", cmd.Maps)
+	}
+}
+
+func TestHLS_Args(t *testing.T) {
+	args := strings.Join(HLS("/w/final.mp4", "/w/hls", DefaultRenditions, false).Args(), " ")
+
+	for _, want := range []string{
+		"-filter_complex [0:v]split=3[s0][s1][s2];[s0]scale=w=-2:h=360[v0];[s1]scale=w=-2:h=480[v1];[s2]scale=w=-2:h=720[v2]",
+		"-map [v0] -map [v1] -map [v2]",
+		"-c:v:2 libx264 -b:v:2 2800k",
+		"-var_stream_map v:0,name:360p v:1,name:480p v:2,name:720p",
+		"-master_pl_name master.m3u8",
+		"-hls_segment_filename /w/hls/%v/seg_%03d.ts",
+	} {
+		if !strings.Contains(args, want) {
+			t.Errorf("args sin %q:\n%s", want, args)
+		}
+	}
+	if !strings.HasSuffix(args, " /w/hls/%v/index.m3u8") {
+		t.Errorf("salida incorrecta:\n%s", args)
+	}
+}
+
+func TestHLS_WithAudio(t *testing.T) {
+	args := strings.Join(HLS("/w/final.mp4", "/w/hls", DefaultRenditions[:2], true).Args(), " ")
+	for _, want := range []string{
+		"-map [v0] -map [v1] -map 0:a:0 -map 0:a:0",
+		"-c:a aac -b:a 128k -ac 2",
+		"-var_stream_map v:0,a:0,name:360p v:1,a:1,name:480p",
+	} {
+		if !strings.Contains(args, want) {
+			t.Errorf("args sin %q:\n%s", want, args)
+		}
+	}
+	if strings.Contains(args, "-an") {
+		t.Errorf("no debería descartar el audio:\n%s", args)
+	}
+}
+
+func TestProfile_AudioCommands(t *testing.T) {
+	p := DefaultProfile()
+	m := Loudness{InputI: "-30.5", InputTP: "-8.1", InputLRA: "4.2", InputThresh: "-41.0", TargetOffset: "0.3"}
+
+	cases := []struct {
+		name string
+		cmd  Command
+		want []string
+	}{
+		{"scan", p.LoudnessScan("in.mp4"),
+			[]string{"-y", "-i", "in.mp4", "-vn", "-af", "loudnorm=I=-23:TP=-1.5:LRA=11:print_format=json", "-f", "null", "-"}},
+		{"normalize", p.Normalize("in.mp4", "out.mp4", m),
+			[]string{"-y", "-i", "in.mp4", "-map", "0:v:0", "-map", "0:a:0",
+				"-af", "loudnorm=I=-23:TP=-1.5:LRA=11:measured_I=-30.5:measured_TP=-8.1:measured_LRA=4.2:measured_thresh=-41.0:offset=0.3:linear=true",
+				"-c:v", "copy", "-c:a", "aac", "-b:a", "128k", "-ar", "48000", "-ac", "2", "-movflags", "+faststart", "out.mp4"}},
+		{"replace", p.ReplaceAudio("in.mp4", "track.m4a", "out.mp4"),
+			[]string{"-y", "-i", "in.mp4", "-stream_loop", "-1", "-i", "track.m4a", "-map", "0:v:0", "-map", "1:a:0",
+				"-c:v", "copy", "-c:a", "aac", "-b:a", "128k", "-ar", "48000", "-ac", "2", "-shortest", "-movflags", "+faststart", "out.mp4"}},
+		{"remux", p.Remux("in.mp4", "out.mp4"),
+			[]string{"-y", "-i", "in.mp4", "-c", "copy", "-movflags", "+faststart", "out.mp4"}},
+	}
+	for _, c := range cases {
+		if got := c.cmd.Args(); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s:\n got  %q\n want %q", c.name, got, c.want)
+		}
+	}
+}
+
+func TestParseLoudness(t *testing.T) {
+	out := []byte(`[Parsed_loudnorm_0 @ 0x55d] 
+{
+	"input_i" : "-27.61",
+	"input_tp" : "-4.47",
+	"input_lra" : "18.06",
+	"input_thresh" : "-39.20",
+	"output_i" : "-23.00",
+	"normalization_type" : "dynamic",
+	"target_offset" : "0.02"
+}
+`)
+	m, err := ParseLoudness(out)
+	if err != nil {
+		t.Fatalf("ParseLoudness: %v", err)
+	}
+	want := Loudness{InputI: "-27.61", InputTP: "-4.47", InputLRA: "18.06", InputThresh: "-39.20", TargetOffset: "0.02"}
+	if m != want || m.Silent() {
+		t.Errorf("got %+v", m)
+	}
+
+	m, err = ParseLoudness([]byte(`{"input_i" : "-inf", "input_tp" : "-inf", "input_lra" : "0.00", "input_thresh" : "-70.00", "target_offset" : "inf"}`))
+	if err != nil || !m.Silent() {
+		t.Errorf("silencio no detectado: %+v, %v", m, err)
+	}
+	if _, err := ParseLoudness([]byte("Stream mapping: ...")); err == nil {
+		t.Error("esperaba error sin bloque JSON")
+	}
+}
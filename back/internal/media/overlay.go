@@ -0,0 +1,157 @@
+package media
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Overlay positions
+const (
+	TopLeft     = "top-left"
+	TopRight    = "top-right"
+	BottomLeft  = "bottom-left"
+	BottomRight = "bottom-right"
+)
+
+// DefaultFont is used by the lower third when the overlay sets no font
+const DefaultFont = "/usr/share/fonts/dejavu/DejaVuSans-Bold.ttf"
+
+// Overlay is the branding burned into the main clip of a profile: a logo
+// and/or a lower third rendered from Text with the player data.
+type Overlay struct {
+	Image        string  // logo asset, resolved like Profile.Intro; empty for none
+	Position     string  // logo corner
+	Opacity      float64 // logo opacity, 0 < Opacity <= 1
+	Width        int     // logo width in pixels; the height keeps its aspect ratio
+	Margin       int     // logo distance to the frame edges, in pixels
+	Text         string  // text/template over OverlayData, e.g. "{{.Name}} · {{.City}}"; empty for none
+	Font         string
+	TextDuration time.Duration // how long the lower third stays; 0 keeps it for the whole clip
+}
+
+// OverlayData is what the lower third template can use
+type OverlayData struct {
+	Name      string // first and last name
+	FirstName string
+	LastName  string
+	City      string
+	Country   string
+}
+
+// Enabled reports whether there is anything to burn in
+func (o Overlay) Enabled() bool {
+	return o.Image != "" || o.Text != ""
+}
+
+// withDefaults fills the omitted settings: a 160px logo at 80% opacity in the
+// top right corner, 24px from the edges.
+func (o Overlay) withDefaults() Overlay {
+	if o.Position == "" {
+		o.Position = TopRight
+	}
+	if o.Opacity == 0 {
+		o.Opacity = 0.8
+	}
+	if o.Width == 0 {
+		o.Width = 160
+	}
+	if o.Margin == 0 {
+		o.Margin = 24
+	}
+	if o.Font == "" {
+		o.Font = DefaultFont
+	}
+	return o
+}
+
+func (o Overlay) validate() error {
+	switch o.Position {
+	case TopLeft, TopRight, BottomLeft, BottomRight:
+	default:
+		return fmt.Errorf("overlay: unknown position %q", o.Position)
+	}
+	switch {
+	case o.Opacity <= 0 || o.Opacity > 1:
+		return errors.New("overlay: opacity must be in (0, 1]")
+	case o.Width <= 0 || o.Margin < 0:
+		return errors.New("overlay: width must be positive and margin cannot be negative")
+	case o.TextDuration < 0:
+		return errors.New("overlay: text_duration cannot be negative")
+	}
+	if _, err := template.New("text").Option("missingkey=error").Parse(o.Text); err != nil {
+		return fmt.Errorf("overlay: text: %w", err)
+	}
+	return nil
+}
+
+// RenderText executes the lower third template for d
+func (o Overlay) RenderText(d OverlayData) (string, error) {
+	t, err := template.New("text").Option("missingkey=error").Parse(o.Text)
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	if err := t.Execute(&b, d); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(b.String()), nil
+}
+
+// logoXY is the overlay filter position of the logo
+func (o Overlay) logoXY() string {
+	x, y := strconv.Itoa(o.Margin), strconv.Itoa(o.Margin)
+	if o.Position == TopRight || o.Position == BottomRight {
+		x = fmt.Sprintf("W-w-%d", o.Margin)
+	}
+	if o.Position == BottomLeft || o.Position == BottomRight {
+		y = fmt.Sprintf("H-h-%d", o.Margin)
+	}
+	return x + ":" + y
+}
+
+// Brand burns the profile overlay into in: logo is the logo file ("" for
+// none) and textFile holds the rendered lower third ("" for none). The text
+// is read from a file so player names never need filtergraph escaping.
+func (p Profile) Brand(in, logo, textFile, out string) Command {
+	o := p.Overlay
+	inputs := []Input{{Path: in}}
+	var graph []string
+	last := "[0:v]"
+	if logo != "" {
+		inputs = append(inputs, Input{Path: logo})
+		graph = append(graph,
+			fmt.Sprintf("[1:v]scale=w=%d:h=-1,format=rgba,colorchannelmixer=aa=%s[logo]",
+				o.Width, strconv.FormatFloat(o.Opacity, 'f', -1, 64)),
+			fmt.Sprintf("%s[logo]overlay=%s[branded]", last, o.logoXY()))
+		last = "[branded]"
+	}
+	if textFile != "" {
+		text := fmt.Sprintf("%sdrawtext=fontfile='%s':textfile='%s':fontcolor=white:fontsize=h/22"+
+			":box=1:boxcolor=black@0.55:boxborderw=14:x=w*0.04:y=h-th-h*0.08", last, o.Font, textFile)
+		if o.TextDuration > 0 {
+			text += fmt.Sprintf(":enable='lt(t,%s)'", seconds(o.TextDuration))
+		}
+		graph = append(graph, text+"[lower]")
+		last = "[lower]"
+	}
+
+	opts := p.videoArgs()
+	maps := []string{last}
+	if p.SegmentAudio() {
+		maps = append(maps, "0:a?")
+		opts = append(opts, "-c:a", "copy")
+	} else {
+		opts = append(opts, "-an")
+	}
+	return Command{
+		Inputs: inputs,
+		Filter: strings.Join(graph, ";"),
+		Maps:   maps,
+		Output: opts,
+		Target: out,
+	}
+}
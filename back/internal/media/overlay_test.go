@@ -0,0 +1,73 @@
+package media
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseProfiles_Overlay(t *testing.T) {
+	data := []byte(`{"profiles":[{"name":"liga","overlay":{"image":"/assets/anb.png","position":"bottom-left",
+		"text":"{{.Name}} · {{.City}}","text_duration":"5s"}}]}`)
+	ps, err := ParseProfiles(data)
+	if err != nil {
+		t.Fatalf("ParseProfiles: %v", err)
+	}
+	p, _ := ps.Get("liga")
+	o := p.Overlay
+	if !o.Enabled() || o.Position != BottomLeft || o.Opacity != 0.8 || o.Width != 160 || o.Font != DefaultFont || o.TextDuration != 5*time.Second {
+		t.Errorf("overlay = %+v", o)
+	}
+	if d, _ := ps.Get(""); d.Overlay.Enabled() {
+		t.Error("el perfil default no debería tener overlay")
+	}
+
+	for name, bad := range map[string]string{
+		"posición":  `{"profiles":[{"name":"x","overlay":{"image":"a.png","position":"center"}}]}`,
+		"opacidad":  `{"profiles":[{"name":"x","overlay":{"image":"a.png","opacity":1.5}}]}`,
+		"plantilla": `{"profiles":[{"name":"x","overlay":{"text":"{{.Name"}}]}`,
+	} {
+		if _, err := ParseProfiles([]byte(bad)); err == nil {
+			t.Errorf("%s: se esperaba error", name)
+		}
+	}
+}
+
+func TestOverlay_RenderText(t *testing.T) {
+	o := Overlay{Text: "{{.Name}} · {{.City}}"}
+	got, err := o.RenderText(OverlayData{Name: "Ana Gómez", City: "Bogotá"})
+	if err != nil || got != "Ana Gómez · Bogotá" {
+		t.Errorf("RenderText = %q, %v", got, err)
+	}
+	if _, err := (Overlay{Text: "{{.Team}}"}).RenderText(OverlayData{}); err == nil {
+		t.Error("esperaba error para un campo inexistente")
+	}
+}
+
+func TestProfile_Brand(t *testing.T) {
+	p := DefaultProfile()
+	p.Overlay = Overlay{Image: "logo.png", Position: TopRight, Opacity: 0.5, Width: 120, Margin: 20,
+		Text: "x", Font: "/f.ttf", TextDuration: 4 * time.Second}
+
+	cmd := p.Brand("main.mp4", "/w/logo.png", "/w/lower.txt", "branded.mp4")
+	want := "[1:v]scale=w=120:h=-1,format=rgba,colorchannelmixer=aa=0.5[logo];" +
+		"[0:v][logo]overlay=W-w-20:20[branded];" +
+		"[branded]drawtext=fontfile='/f.ttf':textfile='/w/lower.txt':fontcolor=white:fontsize=h/22" +
+		":box=1:boxcolor=black@0.55:boxborderw=14:x=w*0.04:y=h-th-h*0.08:enable='lt(t,4)'[lower]"
+	if cmd.Filter != want {
+		t.Errorf("filter:\n got  %s\n want %s", cmd.Filter, want)
+	}
+	args := strings.Join(cmd.Args(), " ")
+	if !strings.Contains(args, "-i main.mp4 -i /w/logo.png") || !strings.Contains(args, "-map [lower] -c:v libx264") || !strings.HasSuffix(args, "-an branded.mp4") {
+		t.Errorf("args = %s", args)
+	}
+
+	textOnly := p.Brand("main.mp4", "", "/w/lower.txt", "b.mp4")
+	if len(textOnly.Inputs) != 1 || !strings.HasPrefix(textOnly.Filter, "[0:v]drawtext=") {
+		t.Errorf("solo texto: %+v", textOnly)
+	}
+	p.AudioPolicy = AudioKeep
+	if args := strings.Join(p.Brand("main.mp4", "/w/logo.png", "", "b.mp4").Args(), " "); !strings.Contains(args, "-map [branded] -map 0:a? ") || !strings.Contains(args, "-c:a copy") {
+		t.Errorf("con audio: %s", args)
+	}
+}
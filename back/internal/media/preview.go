@@ -0,0 +1,68 @@
+package media
+
+import (
+	"fmt"
+	"time"
+)
+
+// Preview formats. The clip format is what gallery cards autoplay; the GIF is
+// an optional fallback for clients that cannot autoplay video.
+const (
+	PreviewMP4  = "mp4"
+	PreviewWebM = "webm"
+)
+
+// Preview clip defaults: 3 seconds, muted, 480px wide at 15fps, so cards load
+// quickly when the gallery shows many at once.
+const (
+	PreviewLength = 3 * time.Second
+	previewWidth  = 480
+	previewFPS    = 15
+	gifWidth      = 320
+	gifFPS        = 10
+)
+
+// PreviewStart places a length long window centered on highlight, shifted to
+// stay inside a total long video.
+func PreviewStart(total, highlight, length time.Duration) time.Duration {
+	start := highlight - length/2
+	if start+length > total {
+		start = total - length
+	}
+	return max(start, 0).Truncate(time.Millisecond)
+}
+
+// Preview renders a muted clip of in starting at start, in format (PreviewMP4
+// or PreviewWebM).
+func Preview(in string, start time.Duration, format, out string) (Command, error) {
+	opts := []string{
+		"-t", seconds(PreviewLength),
+		"-an",
+		"-vf", fmt.Sprintf("fps=%d,scale=w=%d:h=-2", previewFPS, previewWidth),
+	}
+	switch format {
+	case PreviewMP4:
+		opts = append(opts, "-c:v", "libx264", "-preset", "veryfast", "-crf", "28", "-pix_fmt", "yuv420p", "-movflags", "+faststart")
+	case PreviewWebM:
+		opts = append(opts, "-c:v", "libvpx-vp9", "-b:v", "0", "-crf", "40", "-deadline", "good", "-row-mt", "1")
+	default:
+		return Command{}, fmt.Errorf("unknown preview format %q", format)
+	}
+	return Command{
+		Inputs: []Input{{Options: []string{"-ss", seconds(start)}, Path: in}},
+		Output: opts,
+		Target: out,
+	}, nil
+}
+
+// PreviewGIF renders the same window as a looping GIF, with a palette
+// computed from the clip itself.
+func PreviewGIF(in string, start time.Duration, out string) Command {
+	return Command{
+		Inputs: []Input{{Options: []string{"-ss", seconds(start)}, Path: in}},
+		Filter: fmt.Sprintf("[0:v]fps=%d,scale=w=%d:h=-2:flags=lanczos,split[a][b];[a]palettegen[p];[b][p]paletteuse",
+			gifFPS, gifWidth),
+		Output: []string{"-t", seconds(PreviewLength), "-an", "-loop", "0"},
+		Target: out,
+	}
+}
@@ -0,0 +1,50 @@
+package media
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPreviewStart(t *testing.T) {
+	s := time.Second
+	cases := []struct {
+		total, highlight, want time.Duration
+	}{
+		{35 * s, 12 * s, 10500 * time.Millisecond}, // centered on the highlight
+		{35 * s, 0, 0},           // clamped at the start
+		{35 * s, 34 * s, 32 * s}, // clamped at the end
+		{2 * s, s, 0},            // shorter than the preview
+	}
+	for _, c := range cases {
+		if got := PreviewStart(c.total, c.highlight, PreviewLength); got != c.want {
+			t.Errorf("PreviewStart(%s, %s) = %s; want %s", c.total, c.highlight, got, c.want)
+		}
+	}
+}
+
+func TestPreview_Args(t *testing.T) {
+	cmd, err := Preview("v.mp4", 10500*time.Millisecond, PreviewMP4, "preview.mp4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"-y", "-ss", "10.5", "-i", "v.mp4", "-t", "3", "-an", "-vf", "fps=15,scale=w=480:h=-2",
+		"-c:v", "libx264", "-preset", "veryfast", "-crf", "28", "-pix_fmt", "yuv420p", "-movflags", "+faststart", "preview.mp4"}
+	if got := cmd.Args(); !reflect.DeepEqual(got, want) {
+		t.Errorf("\n got  %q\n want %q", got, want)
+	}
+
+	webm, err := Preview("v.mp4", 0, PreviewWebM, "preview.webm")
+	if err != nil || !strings.Contains(strings.Join(webm.Args(), " "), "-c:v libvpx-vp9") {
+		t.Errorf("webm = %q, %v", webm.Args(), err)
+	}
+	if _, err := Preview("v.mp4", 0, "avi", "p.avi"); err == nil {
+		t.Error("esperaba error para un formato desconocido")
+	}
+
+	gif := strings.Join(PreviewGIF("v.mp4", 2*time.Second, "preview.gif").Args(), " ")
+	if !strings.Contains(gif, "palettegen") || !strings.HasSuffix(gif, "-t 3 -an -loop 0 preview.gif") {
+		t.Errorf("gif = %s", gif)
+	}
+}
@@ -0,0 +1,122 @@
+package media
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// Info is the subset of the ffprobe output used to validate and process a video
+type Info struct {
+	Container  string // ffprobe format_name, e.g. "mov,mp4,m4a,3gp,3g2,mj2"
+	Duration   float64
+	Width      int
+	Height     int
+	FPS        float64
+	VideoCodec string // empty when there is no video stream
+	AudioCodec string // empty when there is no audio stream
+}
+
+// HasVideo reports whether the file has a real video stream (cover art excluded)
+func (i *Info) HasVideo() bool { return i.VideoCodec != "" }
+
+// ShortSide is the smaller dimension, so portrait and landscape videos of
+// the same quality compare equally.
+func (i *Info) ShortSide() int {
+	if i.Width < i.Height {
+		return i.Width
+	}
+	return i.Height
+}
+
+// ffprobeOutput mirrors `ffprobe -print_format json -show_format -show_streams`
+type ffprobeOutput struct {
+	Streams []struct {
+		CodecType    string `json:"codec_type"`
+		CodecName    string `json:"codec_name"`
+		Width        int    `json:"width"`
+		Height       int    `json:"height"`
+		AvgFrameRate string `json:"avg_frame_rate"`
+		RFrameRate   string `json:"r_frame_rate"`
+		Duration     string `json:"duration"`
+		Disposition  struct {
+			AttachedPic int `json:"attached_pic"`
+		} `json:"disposition"`
+	} `json:"streams"`
+	Format struct {
+		FormatName string `json:"format_name"`
+		Duration   string `json:"duration"`
+	} `json:"format"`
+}
+
+// Probe runs ffprobe on path (a file or URL). Files ffprobe cannot read are
+// reported as a *ValidationError with CodeUnreadable.
+func Probe(ctx context.Context, path string) (*Info, error) {
+	cmd := exec.CommandContext(ctx, "ffprobe", "-v", "error",
+		"-print_format", "json", "-show_format", "-show_streams", path)
+	out, err := cmd.Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && ctx.Err() == nil {
+			return nil, &ValidationError{
+				Code:    CodeUnreadable,
+				Message: "el archivo no es un video legible",
+				Detail:  strings.TrimSpace(string(exitErr.Stderr)),
+			}
+		}
+		return nil, fmt.Errorf("ffprobe: %w", err)
+	}
+	return ParseProbe(out)
+}
+
+// ParseProbe builds an Info from ffprobe JSON output
+func ParseProbe(data []byte) (*Info, error) {
+	var raw ffprobeOutput
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("decode ffprobe output: %w", err)
+	}
+
+	info := &Info{Container: raw.Format.FormatName}
+	info.Duration, _ = strconv.ParseFloat(raw.Format.Duration, 64)
+	for _, s := range raw.Streams {
+		switch s.CodecType {
+		case "video":
+			if info.VideoCodec != "" || s.Disposition.AttachedPic == 1 {
+				continue
+			}
+			info.VideoCodec = s.CodecName
+			info.Width, info.Height = s.Width, s.Height
+			info.FPS = parseRate(s.AvgFrameRate)
+			if info.FPS == 0 {
+				info.FPS = parseRate(s.RFrameRate)
+			}
+			if info.Duration == 0 {
+				info.Duration, _ = strconv.ParseFloat(s.Duration, 64)
+			}
+		case "audio":
+			if info.AudioCodec == "" {
+				info.AudioCodec = s.CodecName
+			}
+		}
+	}
+	return info, nil
+}
+
+// parseRate parses ffprobe rationals such as "30000/1001"; "0/0" gives 0
+func parseRate(s string) float64 {
+	num, den, ok := strings.Cut(s, "/")
+	if !ok {
+		f, _ := strconv.ParseFloat(s, 64)
+		return f
+	}
+	n, err1 := strconv.ParseFloat(num, 64)
+	d, err2 := strconv.ParseFloat(den, 64)
+	if err1 != nil || err2 != nil || d == 0 {
+		return 0
+	}
+	return n / d
+}
@@ -0,0 +1,58 @@
+package media
+
+import (
+	"math"
+	"testing"
+)
+
+const sampleProbe = `{
+  "streams": [
+    {"codec_type": "video", "codec_name": "h264", "width": 1920, "height": 1080,
+     "avg_frame_rate": "30000/1001", "r_frame_rate": "30000/1001", "duration": "42.100000"},
+    {"codec_type": "audio", "codec_name": "aac"},
+    {"codec_type": "video", "codec_name": "mjpeg", "width": 320, "height": 320,
+     "avg_frame_rate": "0/0", "disposition": {"attached_pic": 1}}
+  ],
+  "format": {"format_name": "mov,mp4,m4a,3gp,3g2,mj2", "duration": "42.123000"}
+}`
+
+func TestParseProbe(t *testing.T) {
+	info, err := ParseProbe([]byte(sampleProbe))
+	if err != nil {
+		t.Fatalf("ParseProbe: %v", err)
+	}
+	if info.VideoCodec != "h264" || info.AudioCodec != "aac" {
+		t.Errorf("codecs = %q/%q", info.VideoCodec, info.AudioCodec)
+	}
+	if info.Width != 1920 || info.Height != 1080 {
+		t.Errorf("resolución = %dx%d", info.Width, info.Height)
+	}
+	if math.Abs(info.FPS-29.97) > 0.01 {
+		t.Errorf("fps = %v; want ~29.97", info.FPS)
+	}
+	if info.Duration != 42.123 {
+		t.Errorf("duración = %v; want 42.123 (la del contenedor)", info.Duration)
+	}
+}
+
+func TestParseProbe_CoverArtIsNotVideo(t *testing.T) {
+	data := `{"streams":[{"codec_type":"audio","codec_name":"mp3"},
+	  {"codec_type":"video","codec_name":"png","width":500,"height":500,"disposition":{"attached_pic":1}}],
+	  "format":{"format_name":"mp3","duration":"30.0"}}`
+	info, err := ParseProbe([]byte(data))
+	if err != nil {
+		t.Fatalf("ParseProbe: %v", err)
+	}
+	if info.HasVideo() {
+		t.Error("una carátula no debería contar como pista de video")
+	}
+}
+
+func TestParseRate(t *testing.T) {
+	cases := map[string]float64{"25/1": 25, "0/0": 0, "60": 60, "": 0}
+	for in, want := range cases {
+		if got := parseRate(in); got != want {
+			t.Errorf("parseRate(%q) = %v; want %v", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,277 @@
+package media
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+)
+
+// DefaultProfileName is used when a job does not name a profile
+const DefaultProfileName = "default"
+
+// Audio policies
+const (
+	AudioStrip     = "strip"     // drop every audio track
+	AudioKeep      = "keep"      // keep the audio of every segment as is
+	AudioNormalize = "normalize" // keep it, normalized to Loudness (EBU R128, two-pass loudnorm)
+	AudioReplace   = "replace"   // replace it with the AudioTrack background track
+)
+
+var ErrUnknownProfile = errors.New("unknown processing profile")
+
+// Profile describes how an upload is turned into the published video
+type Profile struct {
+	Name         string
+	MaxDuration  time.Duration // the upload is trimmed to this length
+	Width        int
+	Height       int
+	VideoCodec   string // ffmpeg encoder, e.g. libx264
+	Preset       string
+	CRF          int    // used when VideoBitrate is empty
+	VideoBitrate string // e.g. "2500k"
+	AudioCodec   string
+	AudioBitrate string
+	FPS          int    // output frame rate; every segment is normalized to it
+	Intro        string // asset: absolute path on the worker, or key in the uploads bucket; empty for none
+	Outro        string
+	BumperBudget time.Duration // intro + outro together never exceed it
+	AudioPolicy  string
+	Loudness     float64       // integrated loudness target in LUFS, for AudioNormalize
+	AudioTrack   string        // asset for AudioReplace, resolved like Intro
+	ThumbnailAt  time.Duration // fixed thumbnail offset; 0 picks the best of several sampled frames
+	Overlay      Overlay       // branding burned into the main clip
+}
+
+// SegmentAudio reports whether segments keep their audio through scale and concat
+func (p Profile) SegmentAudio() bool {
+	return p.AudioPolicy == AudioKeep || p.AudioPolicy == AudioNormalize
+}
+
+// DefaultProfile reproduces the original pipeline: 30s, 720p 16:9 at 30fps,
+// the bundled intro/outro within 5 seconds and no audio; the thumbnail is
+// picked among sampled frames. Profiles that keep audio normalize to -23 LUFS (EBU R128).
+func DefaultProfile() Profile {
+	return Profile{
+		Name:         DefaultProfileName,
+		MaxDuration:  30 * time.Second,
+		Width:        1280,
+		Height:       720,
+		VideoCodec:   "libx264",
+		Preset:       "veryfast",
+		CRF:          23,
+		AudioCodec:   "aac",
+		AudioBitrate: "128k",
+		FPS:          30,
+		Intro:        "/assets/intro.mp4",
+		Outro:        "/assets/outro.mp4",
+		BumperBudget: 5 * time.Second,
+		AudioPolicy:  AudioStrip,
+		Loudness:     -23,
+	}
+}
+
+// Validate rejects profiles ffmpeg could not run
+func (p Profile) Validate() error {
+	switch {
+	case p.Name == "":
+		return errors.New("profile name is required")
+	case p.MaxDuration <= 0:
+		return fmt.Errorf("profile %s: max_duration must be positive", p.Name)
+	case p.Width <= 0 || p.Height <= 0 || p.Width%2 != 0 || p.Height%2 != 0:
+		return fmt.Errorf("profile %s: width and height must be positive and even", p.Name)
+	case p.VideoCodec == "":
+		return fmt.Errorf("profile %s: video_codec is required", p.Name)
+	case p.ThumbnailAt < 0:
+		return fmt.Errorf("profile %s: thumbnail_at cannot be negative", p.Name)
+	case p.FPS < 0:
+		return fmt.Errorf("profile %s: fps cannot be negative", p.Name)
+	case p.BumperBudget < 0:
+		return fmt.Errorf("profile %s: bumper_budget cannot be negative", p.Name)
+	case p.BumperBudget == 0 && (p.Intro != "" || p.Outro != ""):
+		return fmt.Errorf("profile %s: intro/outro need a positive bumper_budget", p.Name)
+	}
+	if p.Overlay.Enabled() {
+		if err := p.Overlay.validate(); err != nil {
+			return fmt.Errorf("profile %s: %w", p.Name, err)
+		}
+	}
+	switch p.AudioPolicy {
+	case AudioStrip:
+		return nil
+	case AudioKeep:
+	case AudioNormalize:
+		if p.Loudness < -70 || p.Loudness > -5 {
+			return fmt.Errorf("profile %s: loudness must be between -70 and -5 LUFS", p.Name)
+		}
+	case AudioReplace:
+		if p.AudioTrack == "" {
+			return fmt.Errorf("profile %s: audio_policy replace needs an audio_track", p.Name)
+		}
+	default:
+		return fmt.Errorf("profile %s: unknown audio_policy %q", p.Name, p.AudioPolicy)
+	}
+	if p.AudioCodec == "" {
+		return fmt.Errorf("profile %s: audio_codec is required to keep audio", p.Name)
+	}
+	return nil
+}
+
+// profileJSON is the file format of a profile; omitted fields keep the
+// default profile values.
+type profileJSON struct {
+	Name         string   `json:"name"`
+	MaxDuration  *string  `json:"max_duration"`
+	Width        *int     `json:"width"`
+	Height       *int     `json:"height"`
+	VideoCodec   *string  `json:"video_codec"`
+	Preset       *string  `json:"preset"`
+	CRF          *int     `json:"crf"`
+	VideoBitrate *string  `json:"video_bitrate"`
+	AudioCodec   *string  `json:"audio_codec"`
+	AudioBitrate *string  `json:"audio_bitrate"`
+	FPS          *int     `json:"fps"`
+	Intro        *string  `json:"intro"`
+	Outro        *string  `json:"outro"`
+	BumperBudget *string  `json:"bumper_budget"`
+	AudioPolicy  *string  `json:"audio_policy"`
+	Loudness     *float64 `json:"loudness"`
+	AudioTrack   *string  `json:"audio_track"`
+	ThumbnailAt  *string  `json:"thumbnail_at"`
+	Overlay      *struct {
+		Image        string  `json:"image"`
+		Position     string  `json:"position"`
+		Opacity      float64 `json:"opacity"`
+		Width        int     `json:"width"`
+		Margin       int     `json:"margin"`
+		Text         string  `json:"text"`
+		Font         string  `json:"font"`
+		TextDuration string  `json:"text_duration"`
+	} `json:"overlay"`
+}
+
+func (j profileJSON) profile() (Profile, error) {
+	p := DefaultProfile()
+	p.Name = j.Name
+	var err error
+	if j.MaxDuration != nil {
+		if p.MaxDuration, err = time.ParseDuration(*j.MaxDuration); err != nil {
+			return p, fmt.Errorf("profile %s: max_duration: %w", j.Name, err)
+		}
+	}
+	if j.BumperBudget != nil {
+		if p.BumperBudget, err = time.ParseDuration(*j.BumperBudget); err != nil {
+			return p, fmt.Errorf("profile %s: bumper_budget: %w", j.Name, err)
+		}
+	}
+	if j.ThumbnailAt != nil {
+		if p.ThumbnailAt, err = time.ParseDuration(*j.ThumbnailAt); err != nil {
+			return p, fmt.Errorf("profile %s: thumbnail_at: %w", j.Name, err)
+		}
+	}
+	setInt(&p.Width, j.Width)
+	setInt(&p.Height, j.Height)
+	setInt(&p.CRF, j.CRF)
+	setInt(&p.FPS, j.FPS)
+	setString(&p.VideoCodec, j.VideoCodec)
+	setString(&p.Preset, j.Preset)
+	setString(&p.VideoBitrate, j.VideoBitrate)
+	setString(&p.AudioCodec, j.AudioCodec)
+	setString(&p.AudioBitrate, j.AudioBitrate)
+	setString(&p.Intro, j.Intro)
+	setString(&p.Outro, j.Outro)
+	setString(&p.AudioPolicy, j.AudioPolicy)
+	setString(&p.AudioTrack, j.AudioTrack)
+	if j.Loudness != nil {
+		p.Loudness = *j.Loudness
+	}
+	if o := j.Overlay; o != nil {
+		p.Overlay = Overlay{Image: o.Image, Position: o.Position, Opacity: o.Opacity, Width: o.Width,
+			Margin: o.Margin, Text: o.Text, Font: o.Font}.withDefaults()
+		if o.TextDuration != "" {
+			if p.Overlay.TextDuration, err = time.ParseDuration(o.TextDuration); err != nil {
+				return p, fmt.Errorf("profile %s: overlay text_duration: %w", j.Name, err)
+			}
+		}
+	}
+	return p, p.Validate()
+}
+
+func setInt(dst *int, v *int) {
+	if v != nil {
+		*dst = *v
+	}
+}
+
+func setString(dst *string, v *string) {
+	if v != nil {
+		*dst = *v
+	}
+}
+
+// Profiles is the set of profiles jobs can select by name
+type Profiles struct {
+	byName map[string]Profile
+}
+
+// DefaultProfiles holds only the built-in default profile
+func DefaultProfiles() *Profiles {
+	return &Profiles{byName: map[string]Profile{DefaultProfileName: DefaultProfile()}}
+}
+
+// ParseProfiles reads {"profiles": [...]} on top of the built-in default,
+// which a file entry named "default" replaces.
+func ParseProfiles(data []byte) (*Profiles, error) {
+	var file struct {
+		Profiles []profileJSON `json:"profiles"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("decode profiles: %w", err)
+	}
+	ps := DefaultProfiles()
+	for _, j := range file.Profiles {
+		p, err := j.profile()
+		if err != nil {
+			return nil, err
+		}
+		ps.byName[p.Name] = p
+	}
+	return ps, nil
+}
+
+// ProfilesFromEnv loads PROFILES_FILE, or the built-in default when unset
+func ProfilesFromEnv() (*Profiles, error) {
+	path := getenv("PROFILES_FILE", "")
+	if path == "" {
+		return DefaultProfiles(), nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read profiles: %w", err)
+	}
+	return ParseProfiles(data)
+}
+
+// Get returns the named profile; an empty name selects the default
+func (ps *Profiles) Get(name string) (Profile, error) {
+	if name == "" {
+		name = DefaultProfileName
+	}
+	p, ok := ps.byName[name]
+	if !ok {
+		return Profile{}, fmt.Errorf("%w: %q", ErrUnknownProfile, name)
+	}
+	return p, nil
+}
+
+// Names lists the available profiles, sorted
+func (ps *Profiles) Names() []string {
+	names := make([]string, 0, len(ps.byName))
+	for n := range ps.byName {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,63 @@
+package media
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseProfiles(t *testing.T) {
+	data := []byte(`{"profiles": [
+		{"name": "vertical", "width": 720, "height": 1280, "max_duration": "45s", "thumbnail_at": "1.5s", "intro": ""},
+		{"name": "default", "crf": 20}
+	]}`)
+	ps, err := ParseProfiles(data)
+	if err != nil {
+		t.Fatalf("ParseProfiles: %v", err)
+	}
+	if want := []string{"default", "vertical"}; !reflect.DeepEqual(ps.Names(), want) {
+		t.Errorf("Names = %v; want %v", ps.Names(), want)
+	}
+
+	v, err := ps.Get("vertical")
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if v.Width != 720 || v.Height != 1280 || v.MaxDuration != 45*time.Second || v.ThumbnailAt != 1500*time.Millisecond {
+		t.Errorf("vertical = %+v", v)
+	}
+	if v.Intro != "" || v.Outro != DefaultProfile().Outro {
+		t.Errorf("intro/outro = %q/%q; los campos omitidos deben heredar el default", v.Intro, v.Outro)
+	}
+
+	d, _ := ps.Get("")
+	if d.Name != DefaultProfileName || d.CRF != 20 {
+		t.Errorf("default = %+v; el archivo debe poder reemplazarlo", d)
+	}
+}
+
+func TestParseProfiles_Invalid(t *testing.T) {
+	cases := map[string]string{
+		"sin nombre":        `{"profiles":[{"width":640}]}`,
+		"alto impar":        `{"profiles":[{"name":"x","height":721}]}`,
+		"duración":          `{"profiles":[{"name":"x","max_duration":"treinta"}]}`,
+		"política":          `{"profiles":[{"name":"x","audio_policy":"karaoke"}]}`,
+		"replace sin pista": `{"profiles":[{"name":"x","audio_policy":"replace"}]}`,
+		"sin códec":         `{"profiles":[{"name":"x","audio_policy":"keep","audio_codec":""}]}`,
+		"loudness":          `{"profiles":[{"name":"x","audio_policy":"normalize","loudness":3}]}`,
+		"json mal formado":  `{"profiles":`,
+	}
+	for name, data := range cases {
+		if _, err := ParseProfiles([]byte(data)); err == nil {
+			t.Errorf("%s: se esperaba error", name)
+		}
+	}
+}
+
+func TestProfiles_GetUnknown(t *testing.T) {
+	_, err := DefaultProfiles().Get("cine")
+	if !errors.Is(err, ErrUnknownProfile) {
+		t.Errorf("err = %v; want ErrUnknownProfile", err)
+	}
+}
@@ -0,0 +1,215 @@
+package media
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/jpeg" // candidate frames are JPEG
+	"math"
+	"os"
+	"strings"
+	"time"
+)
+
+// ThumbSize is one published thumbnail width; the height keeps the aspect ratio
+type ThumbSize struct {
+	Name  string
+	Width int
+}
+
+// ThumbSizes are the thumbnails published per video. The largest one is the
+// main thumbnail (thumb_url).
+var ThumbSizes = []ThumbSize{
+	{"small", 320},
+	{"medium", 640},
+	{"large", 1280},
+}
+
+// candidateWidth is the width candidate frames are scored at
+const candidateWidth = 320
+
+// Frame grabs the frame at offset at, scaled down to at most width pixels
+// wide (never upscaled). A width of 0 keeps the original size.
+func Frame(in string, at time.Duration, width int, out string) Command {
+	opts := []string{"-frames:v", "1"}
+	if width > 0 {
+		opts = append(opts, "-vf", fmt.Sprintf("scale=w='min(%d,iw)':h=-2", width))
+	}
+	return Command{
+		Inputs: []Input{{Options: []string{"-ss", seconds(at)}, Path: in}},
+		Output: append(opts, "-q:v", "2"),
+		Target: out,
+	}
+}
+
+// CandidateFrame grabs a small frame to be scored by ScoreImage
+func CandidateFrame(in string, at time.Duration, out string) Command {
+	return Frame(in, at, candidateWidth, out)
+}
+
+// CandidateTimes spreads n sample offsets over a video of length d, skipping
+// the first and last 10%, where fades and camera starts usually are.
+func CandidateTimes(d time.Duration, n int) []time.Duration {
+	if d <= 0 || n <= 0 {
+		return []time.Duration{0}
+	}
+	start, span := d/10, d*8/10
+	times := make([]time.Duration, n)
+	for i := range times {
+		times[i] = (start + span*time.Duration(i)/time.Duration(max(n-1, 1))).Truncate(time.Millisecond)
+	}
+	return times
+}
+
+// FrameScore rates a candidate frame. Brightness is the mean luma in [0,1];
+// Sharpness is the variance of its Laplacian, high for detailed, in-focus
+// frames and near 0 for blurry or flat (black, single color) ones.
+type FrameScore struct {
+	Brightness float64
+	Sharpness  float64
+}
+
+// Score combines both measures: the sharpest frame wins, but frames that are
+// too dark or washed out only win over frames that are equally bad.
+func (s FrameScore) Score() float64 {
+	exposure := 1 - math.Abs(s.Brightness-0.5)
+	if s.Brightness < 0.12 || s.Brightness > 0.92 {
+		exposure *= 0.1
+	}
+	return s.Sharpness * exposure
+}
+
+// ScoreImage measures img
+func ScoreImage(img image.Image) FrameScore {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w < 3 || h < 3 {
+		return FrameScore{}
+	}
+	luma := make([]float64, w*h)
+	var sum float64
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			l := float64(color.GrayModel.Convert(img.At(b.Min.X+x, b.Min.Y+y)).(color.Gray).Y)
+			luma[y*w+x] = l
+			sum += l
+		}
+	}
+
+	var lsum, lsq float64
+	n := float64((w - 2) * (h - 2))
+	for y := 1; y < h-1; y++ {
+		for x := 1; x < w-1; x++ {
+			i := y*w + x
+			lap := luma[i-1] + luma[i+1] + luma[i-w] + luma[i+w] - 4*luma[i]
+			lsum += lap
+			lsq += lap * lap
+		}
+	}
+	mean := lsum / n
+	return FrameScore{
+		Brightness: sum / float64(w*h) / 255,
+		Sharpness:  lsq/n - mean*mean,
+	}
+}
+
+// ScoreFile decodes and measures the image at path
+func ScoreFile(path string) (FrameScore, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return FrameScore{}, err
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return FrameScore{}, fmt.Errorf("decode %s: %w", path, err)
+	}
+	return ScoreImage(img), nil
+}
+
+// BestFrame returns the index of the highest scoring frame; the first one
+// wins ties, and -1 means scores is empty.
+func BestFrame(scores []FrameScore) int {
+	best := -1
+	for i, s := range scores {
+		if best < 0 || s.Score() > scores[best].Score() {
+			best = i
+		}
+	}
+	return best
+}
+
+// Sprite is a seek-preview sprite sheet: one tile every Interval, laid out in
+// rows of Columns, plus the WebVTT track that maps each cue to its tile.
+type Sprite struct {
+	Interval   time.Duration
+	Columns    int
+	TileWidth  int
+	TileHeight int
+	Duration   time.Duration
+}
+
+// Sprite defaults: a 160px wide tile per second, 10 per row. Longer videos
+// get a longer interval so the sheet never exceeds maxSpriteTiles.
+const (
+	spriteTileWidth = 160
+	spriteColumns   = 10
+	maxSpriteTiles  = 100
+)
+
+// NewSprite lays out the sprite of a d long video with the profile aspect ratio
+func (p Profile) NewSprite(d time.Duration) Sprite {
+	interval := time.Second
+	for d > interval*maxSpriteTiles {
+		interval *= 2
+	}
+	h := spriteTileWidth * p.Height / p.Width
+	return Sprite{
+		Interval:   interval,
+		Columns:    spriteColumns,
+		TileWidth:  spriteTileWidth,
+		TileHeight: h + h%2,
+		Duration:   d,
+	}
+}
+
+// Tiles is the number of tiles needed to cover Duration
+func (s Sprite) Tiles() int {
+	n := int((s.Duration + s.Interval - 1) / s.Interval)
+	return max(n, 1)
+}
+
+func (s Sprite) rows() int {
+	return (s.Tiles() + s.Columns - 1) / s.Columns
+}
+
+// Command renders the sprite sheet of in to out
+func (s Sprite) Command(in, out string) Command {
+	vf := fmt.Sprintf("fps=1/%s,scale=%d:%d,tile=%dx%d",
+		seconds(s.Interval), s.TileWidth, s.TileHeight, s.Columns, s.rows())
+	return Command{
+		Inputs: []Input{{Path: in}},
+		Output: []string{"-vf", vf, "-frames:v", "1", "-q:v", "5"},
+		Target: out,
+	}
+}
+
+// VTT is the WebVTT thumbnail track of the sprite. image is the sprite URL as
+// seen from the track, usually just its file name.
+func (s Sprite) VTT(image string) string {
+	var b strings.Builder
+	b.WriteString("WEBVTT\n")
+	for i := 0; i < s.Tiles(); i++ {
+		start := s.Interval * time.Duration(i)
+		end := min(start+s.Interval, s.Duration)
+		x, y := i%s.Columns*s.TileWidth, i/s.Columns*s.TileHeight
+		fmt.Fprintf(&b, "\n%s --> %s\n%s#xywh=%d,%d,%d,%d\n",
+			vttTime(start), vttTime(end), image, x, y, s.TileWidth, s.TileHeight)
+	}
+	return b.String()
+}
+
+func vttTime(d time.Duration) string {
+	ms := d.Milliseconds()
+	return fmt.Sprintf("%02d:%02d:%02d.%03d", ms/3600000, ms/60000%60, ms/1000%60, ms%1000)
+}
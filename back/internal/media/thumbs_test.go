@@ -0,0 +1,89 @@
+package media
+
+import (
+	"image"
+	"image/color"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCandidateTimes(t *testing.T) {
+	got := CandidateTimes(30*time.Second, 5)
+	want := []time.Duration{3 * time.Second, 9 * time.Second, 15 * time.Second, 21 * time.Second, 27 * time.Second}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v; want %v", got, want)
+	}
+	if got := CandidateTimes(0, 5); !reflect.DeepEqual(got, []time.Duration{0}) {
+		t.Errorf("duración desconocida: %v", got)
+	}
+}
+
+func fill(w, h int, at func(x, y int) uint8) image.Image {
+	img := image.NewGray(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.SetGray(x, y, color.Gray{Y: at(x, y)})
+		}
+	}
+	return img
+}
+
+func TestBestFrame_SkipsBlackAndFlatFrames(t *testing.T) {
+	black := ScoreImage(fill(32, 32, func(int, int) uint8 { return 4 }))
+	flat := ScoreImage(fill(32, 32, func(int, int) uint8 { return 128 }))
+	detailed := ScoreImage(fill(32, 32, func(x, y int) uint8 {
+		if (x/4+y/4)%2 == 0 {
+			return 60
+		}
+		return 190
+	}))
+	darkDetailed := ScoreImage(fill(32, 32, func(x, y int) uint8 { return uint8((x + y) % 2 * 40) }))
+
+	if black.Sharpness != 0 || black.Brightness > 0.05 {
+		t.Errorf("black = %+v", black)
+	}
+	if got := BestFrame([]FrameScore{black, flat, darkDetailed, detailed}); got != 3 {
+		t.Errorf("BestFrame = %d; want 3 (%+v)", got, []FrameScore{black, flat, darkDetailed, detailed})
+	}
+	if BestFrame(nil) != -1 {
+		t.Error("sin candidatos debería ser -1")
+	}
+}
+
+func TestFrame_Args(t *testing.T) {
+	got := Frame("in.mp4", 2500*time.Millisecond, 640, "t.jpg").Args()
+	want := []string{"-y", "-ss", "2.5", "-i", "in.mp4", "-frames:v", "1", "-vf", "scale=w='min(640,iw)':h=-2", "-q:v", "2", "t.jpg"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("\n got  %q\n want %q", got, want)
+	}
+}
+
+func TestSprite_LayoutAndVTT(t *testing.T) {
+	s := DefaultProfile().NewSprite(12500 * time.Millisecond)
+	if s.Tiles() != 13 || s.TileHeight != 90 {
+		t.Fatalf("sprite = %+v, tiles %d", s, s.Tiles())
+	}
+	if got := strings.Join(s.Command("v.mp4", "sprite.jpg").Args(), " "); !strings.Contains(got, "-vf fps=1/1,scale=160:90,tile=10x2 -frames:v 1") {
+		t.Errorf("args = %s", got)
+	}
+
+	vtt := s.VTT("sprite.jpg")
+	if !strings.HasPrefix(vtt, "WEBVTT\n\n00:00:00.000 --> 00:00:01.000\nsprite.jpg#xywh=0,0,160,90\n") {
+		t.Errorf("inicio incorrecto:\n%s", vtt)
+	}
+	// tile 11 is the second one of the second row; the last cue ends with the video
+	for _, want := range []string{
+		"00:00:11.000 --> 00:00:12.000\nsprite.jpg#xywh=160,90,160,90\n",
+		"00:00:12.000 --> 00:00:12.500\nsprite.jpg#xywh=320,90,160,90\n",
+	} {
+		if !strings.Contains(vtt, want) {
+			t.Errorf("vtt sin %q:\n%s", want, vtt)
+		}
+	}
+
+	if long := DefaultProfile().NewSprite(10 * time.Minute); long.Interval != 8*time.Second || long.Tiles() > maxSpriteTiles {
+		t.Errorf("video largo: intervalo %s, %d tiles", long.Interval, long.Tiles())
+	}
+}
@@ -0,0 +1,119 @@
+package media
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Validation error codes, returned to API clients and stored as failure reasons
+const (
+	CodeUnreadable = "unreadable_file"
+	CodeNoVideo    = "no_video_stream"
+	CodeContainer  = "unsupported_container"
+	CodeCodec      = "unsupported_codec"
+	CodeDuration   = "invalid_duration"
+	CodeResolution = "resolution_too_low"
+	CodeFileSize   = "invalid_file_size"
+)
+
+// ValidationError means the file itself is unacceptable; retrying cannot fix it
+type ValidationError struct {
+	Code    string
+	Message string // user-facing, in Spanish
+	Detail  string // diagnostic output, not shown to users
+}
+
+func (e *ValidationError) Error() string {
+	return e.Code + ": " + e.Message
+}
+
+// durationSlack tolerates container rounding (a "60s" recording is often 60.03s)
+const durationSlack = 500 * time.Millisecond
+
+// Rules are the acceptance criteria for uploaded videos
+type Rules struct {
+	MinDuration  time.Duration
+	MaxDuration  time.Duration
+	MinShortSide int      // 1080 means 1080p or higher, in either orientation
+	Containers   []string // accepted ffprobe format names
+	VideoCodecs  []string
+	AudioCodecs  []string // empty accepts any audio codec
+}
+
+// DefaultRules: 20–60 seconds, 1080p or higher, common web containers and codecs
+func DefaultRules() Rules {
+	return Rules{
+		MinDuration:  20 * time.Second,
+		MaxDuration:  60 * time.Second,
+		MinShortSide: 1080,
+		Containers:   []string{"mov", "mp4", "matroska", "webm"},
+		VideoCodecs:  []string{"h264", "hevc", "vp8", "vp9", "av1", "mpeg4"},
+		AudioCodecs:  []string{"aac", "mp3", "opus", "vorbis", "ac3", "eac3", "alac", "pcm_s16le", "pcm_s24le"},
+	}
+}
+
+func getenv(k, d string) string {
+	if v := os.Getenv(k); v != "" {
+		return v
+	}
+	return d
+}
+
+// RulesFromEnv starts from DefaultRules and applies VIDEO_MIN_DURATION,
+// VIDEO_MAX_DURATION and VIDEO_MIN_RESOLUTION.
+func RulesFromEnv() Rules {
+	r := DefaultRules()
+	if d, err := time.ParseDuration(getenv("VIDEO_MIN_DURATION", "")); err == nil {
+		r.MinDuration = d
+	}
+	if d, err := time.ParseDuration(getenv("VIDEO_MAX_DURATION", "")); err == nil {
+		r.MaxDuration = d
+	}
+	if n, err := strconv.Atoi(getenv("VIDEO_MIN_RESOLUTION", "")); err == nil {
+		r.MinShortSide = n
+	}
+	return r
+}
+
+// Validate checks info against the rules and returns a *ValidationError for
+// the first violation found.
+func (r Rules) Validate(info *Info) error {
+	if !info.HasVideo() {
+		return &ValidationError{Code: CodeNoVideo, Message: "el archivo no contiene una pista de video"}
+	}
+	if len(r.Containers) > 0 && !anyOf(strings.Split(info.Container, ","), r.Containers) {
+		return &ValidationError{Code: CodeContainer,
+			Message: fmt.Sprintf("formato de archivo no soportado (%s)", info.Container)}
+	}
+	if len(r.VideoCodecs) > 0 && !slices.Contains(r.VideoCodecs, info.VideoCodec) {
+		return &ValidationError{Code: CodeCodec,
+			Message: fmt.Sprintf("códec de video no soportado (%s)", info.VideoCodec)}
+	}
+	if info.AudioCodec != "" && len(r.AudioCodecs) > 0 && !slices.Contains(r.AudioCodecs, info.AudioCodec) {
+		return &ValidationError{Code: CodeCodec,
+			Message: fmt.Sprintf("códec de audio no soportado (%s)", info.AudioCodec)}
+	}
+	d := time.Duration(info.Duration * float64(time.Second))
+	if (r.MinDuration > 0 && d < r.MinDuration-durationSlack) || (r.MaxDuration > 0 && d > r.MaxDuration+durationSlack) {
+		return &ValidationError{Code: CodeDuration,
+			Message: fmt.Sprintf("la duración debe estar entre %s y %s (el video dura %.1fs)", r.MinDuration, r.MaxDuration, info.Duration)}
+	}
+	if r.MinShortSide > 0 && info.ShortSide() < r.MinShortSide {
+		return &ValidationError{Code: CodeResolution,
+			Message: fmt.Sprintf("la resolución mínima es %dp (el video es %dx%d)", r.MinShortSide, info.Width, info.Height)}
+	}
+	return nil
+}
+
+func anyOf(have, accepted []string) bool {
+	for _, h := range have {
+		if slices.Contains(accepted, h) {
+			return true
+		}
+	}
+	return false
+}
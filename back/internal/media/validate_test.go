@@ -0,0 +1,62 @@
+package media
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestRules_Validate(t *testing.T) {
+	valid := Info{Container: "mov,mp4,m4a,3gp,3g2,mj2", Duration: 45, Width: 1920, Height: 1080,
+		FPS: 30, VideoCodec: "h264", AudioCodec: "aac"}
+
+	cases := []struct {
+		name   string
+		modify func(i *Info)
+		code   string
+	}{
+		{"válido", func(i *Info) {}, ""},
+		{"vertical 1080x1920", func(i *Info) { i.Width, i.Height = 1080, 1920 }, ""},
+		{"60s con redondeo", func(i *Info) { i.Duration = 60.03 }, ""},
+		{"sin audio", func(i *Info) { i.AudioCodec = "" }, ""},
+		{"sin video", func(i *Info) { i.VideoCodec = "" }, CodeNoVideo},
+		{"contenedor", func(i *Info) { i.Container = "avi" }, CodeContainer},
+		{"códec de video", func(i *Info) { i.VideoCodec = "prores" }, CodeCodec},
+		{"códec de audio", func(i *Info) { i.AudioCodec = "wmav2" }, CodeCodec},
+		{"muy corto", func(i *Info) { i.Duration = 12 }, CodeDuration},
+		{"muy largo", func(i *Info) { i.Duration = 75 }, CodeDuration},
+		{"720p", func(i *Info) { i.Width, i.Height = 1280, 720 }, CodeResolution},
+	}
+	rules := DefaultRules()
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			info := valid
+			c.modify(&info)
+			err := rules.Validate(&info)
+			if c.code == "" {
+				if err != nil {
+					t.Fatalf("Validate = %v; want nil", err)
+				}
+				return
+			}
+			var verr *ValidationError
+			if !errors.As(err, &verr) {
+				t.Fatalf("Validate = %v; want *ValidationError", err)
+			}
+			if verr.Code != c.code {
+				t.Errorf("code = %q; want %q", verr.Code, c.code)
+			}
+		})
+	}
+}
+
+func TestRulesFromEnv(t *testing.T) {
+	t.Setenv("VIDEO_MIN_DURATION", "5s")
+	t.Setenv("VIDEO_MIN_RESOLUTION", "720")
+	r := RulesFromEnv()
+	if r.MinDuration.Seconds() != 5 || r.MinShortSide != 720 {
+		t.Errorf("rules = %+v", r)
+	}
+	if r.MaxDuration != DefaultRules().MaxDuration {
+		t.Errorf("MaxDuration debería mantener el valor por defecto")
+	}
+}
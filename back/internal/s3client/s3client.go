@@ -2,15 +2,45 @@ package s3client
 
 import (
 	"context"
+	"fmt"
 	"io"
+	"mime"
+	"path"
+	"strings"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 	"github.com/aws/aws-sdk-go-v2/service/ssm"
 )
 
+// contentTypes covers the media types served to players, which the standard
+// mime table may not know (HLS playlists and segments in particular).
+var contentTypes = map[string]string{
+	".m3u8": "application/vnd.apple.mpegurl",
+	".ts":   "video/mp2t",
+	".mp4":  "video/mp4",
+	".webm": "video/webm",
+	".vtt":  "text/vtt",
+	".jpg":  "image/jpeg",
+	".gif":  "image/gif",
+}
+
+// ContentType returns the media type stored with key, based on its extension
+func ContentType(key string) string {
+	ext := strings.ToLower(path.Ext(key))
+	if ct, ok := contentTypes[ext]; ok {
+		return ct
+	}
+	if ct := mime.TypeByExtension(ext); ct != "" {
+		return ct
+	}
+	return "application/octet-stream"
+}
+
 type S3Client struct {
 	client          *s3.Client
 	ssmClient       *ssm.Client
@@ -85,9 +115,26 @@ func (s *S3Client) DownloadFile(ctx context.Context, key string, bucket string)
 
 func (s *S3Client) UploadFile(ctx context.Context, key string, bucket string, body io.Reader) error {
 	_, err := s.client.PutObject(ctx, &s3.PutObjectInput{
-		Bucket: aws.String(bucket),
-		Key:    aws.String(key),
-		Body:   body,
+		Bucket:      aws.String(bucket),
+		Key:         aws.String(key),
+		Body:        body,
+		ContentType: aws.String(ContentType(key)),
+	})
+	return err
+}
+
+// UploadStream uploads body, of unknown length, with the SDK upload manager:
+// a multipart upload of 5MB parts, so memory stays flat for any file size.
+func (s *S3Client) UploadStream(ctx context.Context, key string, bucket string, body io.Reader) error {
+	uploader := manager.NewUploader(s.client, func(u *manager.Uploader) {
+		u.PartSize = manager.MinUploadPartSize
+		u.Concurrency = 2
+	})
+	_, err := uploader.Upload(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(bucket),
+		Key:         aws.String(key),
+		Body:        body,
+		ContentType: aws.String(ContentType(key)),
 	})
 	return err
 }
@@ -155,6 +202,40 @@ func (s *S3Client) DeleteFile(ctx context.Context, bucket, key string) error {
 	return err
 }
 
+// DeletePrefix deletes every object whose key starts with prefix
+func (s *S3Client) DeletePrefix(ctx context.Context, bucket, prefix string) error {
+	pages := s3.NewListObjectsV2Paginator(s.client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(bucket),
+		Prefix: aws.String(prefix),
+	})
+	for pages.HasMorePages() {
+		page, err := pages.NextPage(ctx)
+		if err != nil {
+			return err
+		}
+		if len(page.Contents) == 0 {
+			continue
+		}
+		objects := make([]types.ObjectIdentifier, len(page.Contents))
+		for i, o := range page.Contents {
+			objects[i] = types.ObjectIdentifier{Key: o.Key}
+		}
+		// a page holds at most 1000 keys, the DeleteObjects limit
+		out, err := s.client.DeleteObjects(ctx, &s3.DeleteObjectsInput{
+			Bucket: aws.String(bucket),
+			Delete: &types.Delete{Objects: objects, Quiet: aws.Bool(true)},
+		})
+		if err != nil {
+			return err
+		}
+		if len(out.Errors) > 0 {
+			e := out.Errors[0]
+			return fmt.Errorf("delete %s: %s", aws.ToString(e.Key), aws.ToString(e.Message))
+		}
+	}
+	return nil
+}
+
 // FileExists checks if a file exists in S3
 func (s *S3Client) FileExists(ctx context.Context, bucket, key string) (bool, error) {
 	_, err := s.client.HeadObject(ctx, &s3.HeadObjectInput{
@@ -168,6 +249,79 @@ func (s *S3Client) FileExists(ctx context.Context, bucket, key string) (bool, er
 	return true, nil
 }
 
+// ObjectSize returns the size in bytes of an object, without downloading it
+func (s *S3Client) ObjectSize(ctx context.Context, bucket, key string) (int64, error) {
+	out, err := s.client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return 0, err
+	}
+	return aws.ToInt64(out.ContentLength), nil
+}
+
+// Part identifies an uploaded part of a multipart upload
+type Part struct {
+	Number int32  `json:"number"`
+	ETag   string `json:"etag"`
+}
+
+// CreateMultipartUpload starts a multipart upload of key and returns its id
+func (s *S3Client) CreateMultipartUpload(ctx context.Context, bucket, key string) (string, error) {
+	out, err := s.client.CreateMultipartUpload(ctx, &s3.CreateMultipartUploadInput{
+		Bucket:      aws.String(bucket),
+		Key:         aws.String(key),
+		ContentType: aws.String(ContentType(key)),
+	})
+	if err != nil {
+		return "", err
+	}
+	return aws.ToString(out.UploadId), nil
+}
+
+// UploadPart uploads part number of a multipart upload. Every part but the
+// last must be at least 5MB; re-uploading a number replaces that part.
+func (s *S3Client) UploadPart(ctx context.Context, bucket, key, uploadID string, number int32, body io.ReadSeeker, size int64) (Part, error) {
+	out, err := s.client.UploadPart(ctx, &s3.UploadPartInput{
+		Bucket:        aws.String(bucket),
+		Key:           aws.String(key),
+		UploadId:      aws.String(uploadID),
+		PartNumber:    aws.Int32(number),
+		Body:          body,
+		ContentLength: aws.Int64(size),
+	})
+	if err != nil {
+		return Part{}, err
+	}
+	return Part{Number: number, ETag: aws.ToString(out.ETag)}, nil
+}
+
+// CompleteMultipartUpload assembles parts, in order, into the object
+func (s *S3Client) CompleteMultipartUpload(ctx context.Context, bucket, key, uploadID string, parts []Part) error {
+	completed := make([]types.CompletedPart, len(parts))
+	for i, p := range parts {
+		completed[i] = types.CompletedPart{PartNumber: aws.Int32(p.Number), ETag: aws.String(p.ETag)}
+	}
+	_, err := s.client.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(bucket),
+		Key:             aws.String(key),
+		UploadId:        aws.String(uploadID),
+		MultipartUpload: &types.CompletedMultipartUpload{Parts: completed},
+	})
+	return err
+}
+
+// AbortMultipartUpload discards a multipart upload and its parts
+func (s *S3Client) AbortMultipartUpload(ctx context.Context, bucket, key, uploadID string) error {
+	_, err := s.client.AbortMultipartUpload(ctx, &s3.AbortMultipartUploadInput{
+		Bucket:   aws.String(bucket),
+		Key:      aws.String(key),
+		UploadId: aws.String(uploadID),
+	})
+	return err
+}
+
 // GetUploadsBucket returns the uploads bucket name
 func (s *S3Client) GetUploadsBucket() string {
 	return s.uploadsBucket
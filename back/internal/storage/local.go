@@ -0,0 +1,340 @@
+package storage
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"ISIS4426-Entrega1/internal/s3client"
+)
+
+const (
+	LocalUploadsBucket   = "uploads"
+	LocalProcessedBucket = "processed"
+)
+
+var ErrInvalidKey = errors.New("invalid storage key")
+
+// Local is a filesystem-backed Storage for development and CI. Each bucket is
+// a directory under root; files are served back by ServeHTTP, which must be
+// mounted by the API at the same path as publicURL.
+type Local struct {
+	root       string
+	publicURL  string
+	signingKey []byte
+}
+
+var _ Storage = (*Local)(nil)
+
+func NewLocal(root, publicURL, signingKey string) (*Local, error) {
+	for _, b := range []string{LocalUploadsBucket, LocalProcessedBucket} {
+		if err := os.MkdirAll(filepath.Join(root, b), 0o755); err != nil {
+			return nil, fmt.Errorf("create bucket dir %s: %w", b, err)
+		}
+	}
+	return &Local{
+		root:       root,
+		publicURL:  strings.TrimRight(publicURL, "/"),
+		signingKey: []byte(signingKey),
+	}, nil
+}
+
+// path resolves bucket/key to a file under root, rejecting anything that
+// would escape the bucket directory.
+func (l *Local) path(bucket, key string) (string, error) {
+	if bucket != LocalUploadsBucket && bucket != LocalProcessedBucket {
+		return "", fmt.Errorf("%w: unknown bucket %q", ErrInvalidKey, bucket)
+	}
+	clean := path.Clean("/" + key)
+	if key == "" || clean == "/" || clean != "/"+key {
+		return "", fmt.Errorf("%w: %q", ErrInvalidKey, key)
+	}
+	return filepath.Join(l.root, bucket, filepath.FromSlash(clean)), nil
+}
+
+func (l *Local) UploadFile(ctx context.Context, key string, bucket string, body io.Reader) error {
+	dst, err := l.path(bucket, key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return err
+	}
+	// Write to a temp file first so readers never see a partial object
+	tmp, err := os.CreateTemp(filepath.Dir(dst), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, body); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), dst)
+}
+
+// UploadStream is UploadFile: the body already goes straight to disk
+func (l *Local) UploadStream(ctx context.Context, key string, bucket string, body io.Reader) error {
+	return l.UploadFile(ctx, key, bucket, body)
+}
+
+func (l *Local) UploadToUploads(ctx context.Context, key string, body io.Reader) error {
+	return l.UploadFile(ctx, key, LocalUploadsBucket, body)
+}
+
+func (l *Local) UploadToProcessed(ctx context.Context, key string, body io.Reader) error {
+	return l.UploadFile(ctx, key, LocalProcessedBucket, body)
+}
+
+func (l *Local) DownloadFile(ctx context.Context, key string, bucket string) (io.ReadCloser, error) {
+	p, err := l.path(bucket, key)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(p)
+}
+
+func (l *Local) DownloadFromUploads(ctx context.Context, key string) (io.ReadCloser, error) {
+	return l.DownloadFile(ctx, key, LocalUploadsBucket)
+}
+
+func (l *Local) DownloadFromProcessed(ctx context.Context, key string) (io.ReadCloser, error) {
+	return l.DownloadFile(ctx, key, LocalProcessedBucket)
+}
+
+func (l *Local) DeleteFile(ctx context.Context, bucket, key string) error {
+	p, err := l.path(bucket, key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(p); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (l *Local) DeletePrefix(ctx context.Context, bucket, prefix string) error {
+	dir, ok := strings.CutSuffix(prefix, "/")
+	if !ok {
+		return fmt.Errorf("%w: prefix %q must end in /", ErrInvalidKey, prefix)
+	}
+	p, err := l.path(bucket, dir)
+	if err != nil {
+		return err
+	}
+	return os.RemoveAll(p)
+}
+
+func (l *Local) FileExists(ctx context.Context, bucket, key string) (bool, error) {
+	p, err := l.path(bucket, key)
+	if err != nil {
+		return false, err
+	}
+	if _, err := os.Stat(p); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+func (l *Local) ObjectSize(ctx context.Context, bucket, key string) (int64, error) {
+	p, err := l.path(bucket, key)
+	if err != nil {
+		return 0, err
+	}
+	info, err := os.Stat(p)
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+// multipartDir holds the parts of pending multipart uploads, outside of
+// the bucket directories
+const multipartDir = ".multipart"
+
+func (l *Local) uploadDir(uploadID string) (string, error) {
+	if _, err := hex.DecodeString(uploadID); err != nil || uploadID == "" {
+		return "", fmt.Errorf("%w: upload id %q", ErrInvalidKey, uploadID)
+	}
+	return filepath.Join(l.root, multipartDir, uploadID), nil
+}
+
+func partFile(dir string, number int32) string {
+	return filepath.Join(dir, fmt.Sprintf("part-%05d", number))
+}
+
+func (l *Local) CreateMultipartUpload(ctx context.Context, bucket, key string) (string, error) {
+	if _, err := l.path(bucket, key); err != nil {
+		return "", err
+	}
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	id := hex.EncodeToString(b)
+	return id, os.MkdirAll(filepath.Join(l.root, multipartDir, id), 0o755)
+}
+
+func (l *Local) UploadPart(ctx context.Context, bucket, key, uploadID string, number int32, body io.ReadSeeker, size int64) (s3client.Part, error) {
+	dir, err := l.uploadDir(uploadID)
+	if err != nil {
+		return s3client.Part{}, err
+	}
+	if _, err := os.Stat(dir); err != nil {
+		return s3client.Part{}, err
+	}
+	f, err := os.Create(partFile(dir, number))
+	if err != nil {
+		return s3client.Part{}, err
+	}
+	h := sha256.New()
+	n, err := io.Copy(io.MultiWriter(f, h), body)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil && n != size {
+		err = fmt.Errorf("part %d: got %d bytes, want %d", number, n, size)
+	}
+	if err != nil {
+		return s3client.Part{}, err
+	}
+	return s3client.Part{Number: number, ETag: hex.EncodeToString(h.Sum(nil))[:32]}, nil
+}
+
+func (l *Local) CompleteMultipartUpload(ctx context.Context, bucket, key, uploadID string, parts []s3client.Part) error {
+	dir, err := l.uploadDir(uploadID)
+	if err != nil {
+		return err
+	}
+	readers := make([]io.Reader, 0, len(parts))
+	for _, p := range parts {
+		f, err := os.Open(partFile(dir, p.Number))
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		readers = append(readers, f)
+	}
+	if err := l.UploadFile(ctx, key, bucket, io.MultiReader(readers...)); err != nil {
+		return err
+	}
+	return os.RemoveAll(dir)
+}
+
+func (l *Local) AbortMultipartUpload(ctx context.Context, bucket, key, uploadID string) error {
+	dir, err := l.uploadDir(uploadID)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(dir); err != nil {
+		return err
+	}
+	return os.RemoveAll(dir)
+}
+
+// GeneratePresignedURL returns a signed GET URL, required for the uploads bucket
+func (l *Local) GeneratePresignedURL(ctx context.Context, bucket, key string, expiration time.Duration) (string, error) {
+	return l.presign(http.MethodGet, bucket, key, expiration)
+}
+
+// GenerateUploadPresignedURL returns a signed PUT URL accepted by ServeHTTP
+func (l *Local) GenerateUploadPresignedURL(ctx context.Context, bucket, key string, expiration time.Duration) (string, error) {
+	return l.presign(http.MethodPut, bucket, key, expiration)
+}
+
+func (l *Local) presign(method, bucket, key string, expiration time.Duration) (string, error) {
+	if _, err := l.path(bucket, key); err != nil {
+		return "", err
+	}
+	exp := strconv.FormatInt(time.Now().Add(expiration).Unix(), 10)
+	q := url.Values{}
+	q.Set("expires", exp)
+	q.Set("signature", l.sign(method, bucket, key, exp))
+	return l.fileURL(bucket, key) + "?" + q.Encode(), nil
+}
+
+func (l *Local) sign(method, bucket, key, expires string) string {
+	mac := hmac.New(sha256.New, l.signingKey)
+	mac.Write([]byte(method + "\n" + bucket + "\n" + key + "\n" + expires))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (l *Local) validSignature(r *http.Request, method, bucket, key string) bool {
+	q := r.URL.Query()
+	exp, err := strconv.ParseInt(q.Get("expires"), 10, 64)
+	if err != nil || time.Now().Unix() > exp {
+		return false
+	}
+	want := l.sign(method, bucket, key, q.Get("expires"))
+	return hmac.Equal([]byte(want), []byte(q.Get("signature")))
+}
+
+func (l *Local) GetUploadsBucket() string { return LocalUploadsBucket }
+
+func (l *Local) GetProcessedBucket() string { return LocalProcessedBucket }
+
+func (l *Local) fileURL(bucket, key string) string {
+	return l.publicURL + "/" + bucket + "/" + key
+}
+
+// GetProcessedFileURL returns the public URL served by ServeHTTP
+func (l *Local) GetProcessedFileURL(key string) string {
+	return l.fileURL(LocalProcessedBucket, key)
+}
+
+// ServeHTTP serves "{bucket}/{key}" paths (mount it with http.StripPrefix).
+// The processed bucket is public like its S3 counterpart; the uploads bucket
+// and every PUT require a presigned URL.
+func (l *Local) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	bucket, key, ok := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	p, err := l.path(bucket, key)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		if bucket != LocalProcessedBucket && !l.validSignature(r, http.MethodGet, bucket, key) {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		w.Header().Set("Content-Type", s3client.ContentType(key))
+		http.ServeFile(w, r, p)
+	case http.MethodPut:
+		if !l.validSignature(r, http.MethodPut, bucket, key) {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		if err := l.UploadFile(r.Context(), key, bucket, r.Body); err != nil {
+			http.Error(w, "upload failed", http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
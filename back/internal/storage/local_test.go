@@ -0,0 +1,191 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"ISIS4426-Entrega1/internal/s3client"
+)
+
+func newTestLocal(t *testing.T) *Local {
+	t.Helper()
+	l, err := NewLocal(t.TempDir(), "http://api/files", "secret")
+	if err != nil {
+		t.Fatalf("NewLocal: %v", err)
+	}
+	return l
+}
+
+func TestLocal_UploadDownloadDelete(t *testing.T) {
+	l := newTestLocal(t)
+	ctx := context.Background()
+
+	if err := l.UploadToUploads(ctx, "videos/1/a.mp4", strings.NewReader("data")); err != nil {
+		t.Fatalf("UploadToUploads: %v", err)
+	}
+	ok, err := l.FileExists(ctx, l.GetUploadsBucket(), "videos/1/a.mp4")
+	if err != nil || !ok {
+		t.Fatalf("FileExists = %v, %v; want true", ok, err)
+	}
+
+	rc, err := l.DownloadFromUploads(ctx, "videos/1/a.mp4")
+	if err != nil {
+		t.Fatalf("DownloadFromUploads: %v", err)
+	}
+	b, _ := io.ReadAll(rc)
+	rc.Close()
+	if string(b) != "data" {
+		t.Errorf("contenido = %q; want %q", b, "data")
+	}
+	if n, err := l.ObjectSize(ctx, l.GetUploadsBucket(), "videos/1/a.mp4"); err != nil || n != 4 {
+		t.Errorf("ObjectSize = %d, %v; want 4", n, err)
+	}
+
+	if err := l.DeleteFile(ctx, l.GetUploadsBucket(), "videos/1/a.mp4"); err != nil {
+		t.Fatalf("DeleteFile: %v", err)
+	}
+	if ok, _ := l.FileExists(ctx, l.GetUploadsBucket(), "videos/1/a.mp4"); ok {
+		t.Error("el archivo debería haber sido eliminado")
+	}
+	if _, err := l.ObjectSize(ctx, l.GetUploadsBucket(), "videos/1/a.mp4"); !IsNotFound(err) {
+		t.Errorf("ObjectSize de un archivo eliminado: err = %v; want not found", err)
+	}
+}
+
+func TestLocal_MultipartUpload(t *testing.T) {
+	l := newTestLocal(t)
+	ctx := context.Background()
+	bucket, key := l.GetUploadsBucket(), "videos/1/big.mp4"
+
+	id, err := l.CreateMultipartUpload(ctx, bucket, key)
+	if err != nil {
+		t.Fatalf("CreateMultipartUpload: %v", err)
+	}
+	p2, err := l.UploadPart(ctx, bucket, key, id, 2, strings.NewReader("world"), 5)
+	if err != nil {
+		t.Fatalf("UploadPart 2: %v", err)
+	}
+	p1, err := l.UploadPart(ctx, bucket, key, id, 1, strings.NewReader("hello "), 6)
+	if err != nil {
+		t.Fatalf("UploadPart 1: %v", err)
+	}
+	if err := l.CompleteMultipartUpload(ctx, bucket, key, id, []s3client.Part{p1, p2}); err != nil {
+		t.Fatalf("CompleteMultipartUpload: %v", err)
+	}
+	rc, err := l.DownloadFromUploads(ctx, key)
+	if err != nil {
+		t.Fatalf("DownloadFromUploads: %v", err)
+	}
+	b, _ := io.ReadAll(rc)
+	rc.Close()
+	if string(b) != "hello world" {
+		t.Errorf("contenido = %q; want partes en orden", b)
+	}
+
+	if _, err := l.UploadPart(ctx, bucket, key, id, 3, strings.NewReader("x"), 1); !IsNotFound(err) {
+		t.Errorf("UploadPart tras completar: err = %v; want not found", err)
+	}
+	id, _ = l.CreateMultipartUpload(ctx, bucket, key)
+	if err := l.AbortMultipartUpload(ctx, bucket, key, id); err != nil {
+		t.Fatalf("AbortMultipartUpload: %v", err)
+	}
+	if err := l.AbortMultipartUpload(ctx, bucket, key, id); !IsNotFound(err) {
+		t.Errorf("segundo Abort: err = %v; want not found", err)
+	}
+	if _, err := l.UploadPart(ctx, bucket, key, "../x", 1, strings.NewReader("x"), 1); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("upload id inválido: err = %v; want ErrInvalidKey", err)
+	}
+}
+
+func TestLocal_DeletePrefix(t *testing.T) {
+	l := newTestLocal(t)
+	ctx := context.Background()
+	bucket := l.GetProcessedBucket()
+	for _, key := range []string{"processed/5/j1/out.mp4", "processed/5/j1/hls/master.m3u8", "processed/50/j2/out.mp4"} {
+		if err := l.UploadFile(ctx, key, bucket, strings.NewReader("x")); err != nil {
+			t.Fatalf("UploadFile %s: %v", key, err)
+		}
+	}
+
+	if err := l.DeletePrefix(ctx, bucket, "processed/5/"); err != nil {
+		t.Fatalf("DeletePrefix: %v", err)
+	}
+	if ok, _ := l.FileExists(ctx, bucket, "processed/5/j1/hls/master.m3u8"); ok {
+		t.Error("processed/5/ debería estar vacío")
+	}
+	if ok, _ := l.FileExists(ctx, bucket, "processed/50/j2/out.mp4"); !ok {
+		t.Error("processed/50/ no debería tocarse")
+	}
+	if err := l.DeletePrefix(ctx, bucket, "processed/missing/"); err != nil {
+		t.Errorf("DeletePrefix de un prefijo vacío: %v", err)
+	}
+	if err := l.DeletePrefix(ctx, bucket, "processed/5"); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("prefijo sin /: err = %v; want ErrInvalidKey", err)
+	}
+}
+
+func TestLocal_RejectsTraversal(t *testing.T) {
+	l := newTestLocal(t)
+	for _, key := range []string{"", "../x", "a/../../x", "/abs", "a//b"} {
+		err := l.UploadToUploads(context.Background(), key, strings.NewReader("x"))
+		if !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("key %q: err = %v; want ErrInvalidKey", key, err)
+		}
+	}
+}
+
+func TestLocal_ServeHTTP_Signatures(t *testing.T) {
+	l := newTestLocal(t)
+	ctx := context.Background()
+	srv := http.StripPrefix("/files/", l)
+
+	// PUT sin firma → 403
+	req := httptest.NewRequest(http.MethodPut, "/files/uploads/v/a.mp4", strings.NewReader("x"))
+	rr := httptest.NewRecorder()
+	srv.ServeHTTP(rr, req)
+	if rr.Code != http.StatusForbidden {
+		t.Fatalf("unsigned PUT status = %d; want 403", rr.Code)
+	}
+
+	// PUT firmado → 200 y el objeto existe
+	u, err := l.GenerateUploadPresignedURL(ctx, l.GetUploadsBucket(), "v/a.mp4", time.Minute)
+	if err != nil {
+		t.Fatalf("GenerateUploadPresignedURL: %v", err)
+	}
+	req = httptest.NewRequest(http.MethodPut, strings.TrimPrefix(u, "http://api"), strings.NewReader("hello"))
+	rr = httptest.NewRecorder()
+	srv.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("signed PUT status = %d; want 200", rr.Code)
+	}
+
+	// GET del bucket de uploads sin firma → 403, con firma → contenido
+	req = httptest.NewRequest(http.MethodGet, "/files/uploads/v/a.mp4", nil)
+	rr = httptest.NewRecorder()
+	srv.ServeHTTP(rr, req)
+	if rr.Code != http.StatusForbidden {
+		t.Fatalf("unsigned GET status = %d; want 403", rr.Code)
+	}
+	u, _ = l.GeneratePresignedURL(ctx, l.GetUploadsBucket(), "v/a.mp4", time.Minute)
+	req = httptest.NewRequest(http.MethodGet, strings.TrimPrefix(u, "http://api"), nil)
+	rr = httptest.NewRecorder()
+	srv.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK || rr.Body.String() != "hello" {
+		t.Fatalf("signed GET = %d %q; want 200 %q", rr.Code, rr.Body.String(), "hello")
+	}
+
+	// bucket procesado es público
+	_ = l.UploadToProcessed(ctx, "processed/1_thumb.jpg", strings.NewReader("img"))
+	req = httptest.NewRequest(http.MethodGet, strings.TrimPrefix(l.GetProcessedFileURL("processed/1_thumb.jpg"), "http://api"), nil)
+	rr = httptest.NewRecorder()
+	srv.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("public GET status = %d; want 200", rr.Code)
+	}
+}
@@ -0,0 +1,87 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"ISIS4426-Entrega1/internal/s3client"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// Storage is the object store used by the API and the worker. It mirrors the
+// method set of s3client.S3Client so the S3 implementation satisfies it as is.
+type Storage interface {
+	UploadFile(ctx context.Context, key string, bucket string, body io.Reader) error
+	// UploadStream uploads a body of unknown length without buffering it whole
+	UploadStream(ctx context.Context, key string, bucket string, body io.Reader) error
+	UploadToUploads(ctx context.Context, key string, body io.Reader) error
+	UploadToProcessed(ctx context.Context, key string, body io.Reader) error
+
+	DownloadFile(ctx context.Context, key string, bucket string) (io.ReadCloser, error)
+	DownloadFromUploads(ctx context.Context, key string) (io.ReadCloser, error)
+	DownloadFromProcessed(ctx context.Context, key string) (io.ReadCloser, error)
+
+	DeleteFile(ctx context.Context, bucket, key string) error
+	// DeletePrefix deletes every object under prefix, a "directory" ending in /
+	DeletePrefix(ctx context.Context, bucket, prefix string) error
+	FileExists(ctx context.Context, bucket, key string) (bool, error)
+	// ObjectSize returns the size of an object; IsNotFound(err) when it is missing
+	ObjectSize(ctx context.Context, bucket, key string) (int64, error)
+
+	// Multipart uploads, used by resumable uploads. Parts are numbered from 1.
+	CreateMultipartUpload(ctx context.Context, bucket, key string) (string, error)
+	UploadPart(ctx context.Context, bucket, key, uploadID string, number int32, body io.ReadSeeker, size int64) (s3client.Part, error)
+	CompleteMultipartUpload(ctx context.Context, bucket, key, uploadID string, parts []s3client.Part) error
+	AbortMultipartUpload(ctx context.Context, bucket, key, uploadID string) error
+
+	GeneratePresignedURL(ctx context.Context, bucket, key string, expiration time.Duration) (string, error)
+	GenerateUploadPresignedURL(ctx context.Context, bucket, key string, expiration time.Duration) (string, error)
+
+	GetUploadsBucket() string
+	GetProcessedBucket() string
+	GetProcessedFileURL(key string) string
+}
+
+var _ Storage = (*s3client.S3Client)(nil)
+
+// IsNotFound reports whether err means the requested object does not exist,
+// for any backend.
+func IsNotFound(err error) bool {
+	var noSuchKey *types.NoSuchKey
+	var notFound *types.NotFound
+	var noSuchUpload *types.NoSuchUpload
+	return errors.Is(err, os.ErrNotExist) || errors.As(err, &noSuchKey) || errors.As(err, &notFound) ||
+		errors.As(err, &noSuchUpload)
+}
+
+func getenv(k, d string) string {
+	if v := os.Getenv(k); v != "" {
+		return v
+	}
+	return d
+}
+
+// NewFromEnv selects the storage backend from STORAGE_BACKEND ("s3" or "local").
+//
+// s3 (default): bucket names are read from SSM, as before.
+// local: files live under STORAGE_LOCAL_ROOT and are served by the API at
+// STORAGE_PUBLIC_URL (see Local.ServeHTTP).
+func NewFromEnv(ctx context.Context) (Storage, error) {
+	switch backend := getenv("STORAGE_BACKEND", "s3"); backend {
+	case "s3":
+		return s3client.NewFromSSM(ctx, "/anb/s3/uploads-bucket", "/anb/s3/processed-bucket")
+	case "local":
+		return NewLocal(
+			getenv("STORAGE_LOCAL_ROOT", "/data/storage"),
+			getenv("STORAGE_PUBLIC_URL", "http://localhost:8080/api/files"),
+			getenv("STORAGE_SIGNING_KEY", getenv("JWT_SECRET", "devsecret123")),
+		)
+	default:
+		return nil, fmt.Errorf("unknown STORAGE_BACKEND %q", backend)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"os/exec"
 	"time"
 
 	"ISIS4426-Entrega1/app/async"
@@ -13,7 +14,8 @@ import (
 	"ISIS4426-Entrega1/app/routers"
 	"ISIS4426-Entrega1/app/services"
 	appdb "ISIS4426-Entrega1/db"
-	"ISIS4426-Entrega1/internal/s3client"
+	"ISIS4426-Entrega1/internal/media"
+	"ISIS4426-Entrega1/internal/storage"
 
 	"github.com/gorilla/handlers"
 	"github.com/gorilla/mux"
@@ -35,44 +37,73 @@ func main() {
 
 	log.Println("Initializing repositories and services...")
 	repo := repos.NewVideoRepoPG(sqlDB)
-	svc := services.NewVideoService(repo)
 	log.Println("Repositories and services initialized ✅")
 
-	queueURL := getenv("SQS_QUEUE_URL", "")
-	if queueURL == "" {
-		log.Fatal("SQS_QUEUE_URL is required")
+	queue, err := async.NewQueueFromEnv(context.Background(), sqlDB)
+	if err != nil {
+		log.Fatalf("Cannot initialize job queue: %v", err)
 	}
+	enq := async.NewEnqueuer(queue, sqlDB)
+	defer enq.Close()
+	log.Printf("Job queue initialized (backend=%s)", getenv("QUEUE_BACKEND", "sqs"))
 
-	enq, err := async.NewSQSEnqueuer(context.Background(), queueURL, sqlDB)
+	// outbox: publish jobs written with their videos, and re-enqueue stuck uploads
+	stuckAfter, err := time.ParseDuration(getenv("OUTBOX_STUCK_AFTER", "1h"))
 	if err != nil {
-		log.Fatalf("Cannot initialize SQS enqueuer: %v", err)
+		log.Fatalf("Invalid OUTBOX_STUCK_AFTER: %v", err)
 	}
-	defer enq.Close()
-	log.Printf("[worker] SQS enqueuer initialized with url: %s", queueURL)
-
-	// Initialize S3 client from SSM parameters
-	log.Println("Initializing S3 service...")
-	s3Client, err := s3client.NewFromSSM(
-		context.Background(),
-		"/anb/s3/uploads-bucket",
-		"/anb/s3/processed-bucket",
-	)
+	go async.NewRelay(sqlDB, enq).Run(context.Background())
+	go async.NewSweeper(sqlDB, stuckAfter).Run(context.Background())
+
+	// Initialize object storage (S3 from SSM parameters, or local filesystem)
+	log.Println("Initializing storage service...")
+	store, err := storage.NewFromEnv(context.Background())
 	if err != nil {
-		log.Printf("❌ S3 client initialization failed: %v", err)
-		log.Fatal("Cannot initialize S3 client")
+		log.Printf("❌ Storage initialization failed: %v", err)
+		log.Fatal("Cannot initialize storage")
 	}
-	log.Println("✅ S3 client initialized")
+	log.Printf("✅ Storage initialized (backend=%s)", getenv("STORAGE_BACKEND", "s3"))
+	svc := services.NewVideoService(repo, store)
 
 	// auth
 	log.Println("Initializing auth services...")
 	userRepo := repos.NewUserRepoPG(sqlDB)
 	authSvc := services.NewAuthService(userRepo)
-	authH := routers.NewAuthHandler(authSvc, s3Client) // Pass S3 client for avatar uploads
+	authH := routers.NewAuthHandler(authSvc, store) // Pass storage for avatar uploads
 	log.Println("✅ Auth services initialized")
 
-	// videos - pass S3 client to handler
+	// videos - pass storage to handler
 	log.Println("🎬 Initializing video handlers...")
-	h := routers.NewVideosHandler(enq, svc, s3Client)
+	// upload validation needs ffprobe; without it the worker still validates
+	var rules *media.Rules
+	if _, err := exec.LookPath("ffprobe"); err == nil {
+		r := media.RulesFromEnv()
+		rules = &r
+	} else {
+		log.Printf("⚠️ ffprobe not found, uploads are validated by the worker only")
+	}
+	profiles, err := media.ProfilesFromEnv()
+	if err != nil {
+		log.Fatalf("Cannot load processing profiles: %v", err)
+	}
+	draftTTL, err := time.ParseDuration(getenv("VIDEO_DRAFT_TTL", "1h"))
+	if err != nil || draftTTL <= 0 {
+		log.Fatalf("Invalid VIDEO_DRAFT_TTL: %v", err)
+	}
+	trashRetention, err := time.ParseDuration(getenv("VIDEO_TRASH_RETENTION", "720h"))
+	if err != nil || trashRetention <= 0 {
+		log.Fatalf("Invalid VIDEO_TRASH_RETENTION: %v", err)
+	}
+	h := routers.NewVideosHandler(svc, store, rules, profiles, draftTTL, trashRetention)
+	go svc.RunTrashPurge(context.Background(), trashRetention, time.Hour)
+	go services.NewDraftCleaner(repo, store).Run(context.Background())
+	resumableTTL, err := time.ParseDuration(getenv("RESUMABLE_UPLOAD_TTL", "24h"))
+	if err != nil || resumableTTL <= 0 {
+		log.Fatalf("Invalid RESUMABLE_UPLOAD_TTL: %v", err)
+	}
+	uploads := services.NewUploadService(repos.NewUploadRepoPG(sqlDB), svc, store, resumableTTL)
+	go uploads.RunCleaner(context.Background(), 10*time.Minute)
+	tusH := routers.NewTusHandler(uploads, profiles)
 	hJobs := routers.NewJobsHandler(enq)
 	pubH := routers.NewPublicHandler(sqlDB)
 	log.Println("✅ Video handlers initialized")
@@ -100,7 +131,7 @@ func main() {
 			return
 		}
 		if err := enq.Ping(ctx); err != nil {
-			http.Error(w, "sqs not ready", http.StatusServiceUnavailable)
+			http.Error(w, "queue not ready", http.StatusServiceUnavailable)
 			return
 		}
 		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
@@ -123,15 +154,28 @@ func main() {
 	videos := api.PathPrefix("/videos").Subrouter()
 	videos.Use(middleware.AuthRequired)
 	videos.HandleFunc("", h.Create).Methods("POST")
+	videos.HandleFunc("/uploads", h.CreateUpload).Methods("POST")
+	videos.HandleFunc("/uploads/{id}/complete", h.CompleteUpload).Methods("POST")
+	videos.HandleFunc("/tus", tusH.Create).Methods("POST")
+	videos.HandleFunc("/tus/{id}", tusH.Head).Methods("HEAD")
+	videos.HandleFunc("/tus/{id}", tusH.Patch).Methods("PATCH")
+	videos.HandleFunc("/tus/{id}", tusH.Delete).Methods("DELETE")
 	videos.HandleFunc("", h.List).Methods("GET")
+	videos.HandleFunc("/trash", h.Trash).Methods("GET") // before /{id}
+	videos.HandleFunc("/reprocess", h.ReprocessBulk).Methods("POST")
 	videos.HandleFunc("/{id}", h.GetByID).Methods("GET")
 	videos.HandleFunc("/{id}", h.Delete).Methods("DELETE")
+	videos.HandleFunc("/{id}", h.Update).Methods("PATCH")
+	videos.HandleFunc("/{id}/source", h.ReplaceSource).Methods("PUT")
+	videos.HandleFunc("/{id}/reprocess", h.Reprocess).Methods("POST")
+	videos.HandleFunc("/{id}/restore", h.Restore).Methods("POST")
 
 	// jobs (optional, public)
 	api.HandleFunc("/jobs/{id}", hJobs.GetJobStatus).Methods("GET")
 
 	// public endpoints
 	api.HandleFunc("/public/videos", pubH.ListVideos).Methods("GET")
+	api.HandleFunc("/public/videos/shared/{token}", pubH.GetShared).Methods("GET")
 	vote := api.PathPrefix("/public/videos").Subrouter()
 	vote.Use(middleware.AuthRequired)
 	vote.HandleFunc("/{id}/vote", pubH.Vote).Methods("POST")
@@ -141,10 +185,12 @@ func main() {
 	my.HandleFunc("/my-votes", pubH.MyVotes).Methods("GET")
 	api.HandleFunc("/public/rankings", pubH.Rankings).Methods("GET")
 
-	log.Println("✅ Routes configured")
+	// local storage backend: files are served by the API itself
+	if local, ok := store.(*storage.Local); ok {
+		api.PathPrefix("/files/").Handler(http.StripPrefix("/api/files/", local))
+	}
 
-	// Remove static file serving - files will be served directly from S3
-	// r.PathPrefix("/static/").Handler(http.StripPrefix("/static/", http.FileServer(http.Dir("/data/"))))
+	log.Println("✅ Routes configured")
 
 	allowedOrigins := []string{
 		"http://localhost:3000",    // Local development
@@ -171,9 +217,11 @@ func main() {
 
 	cors := handlers.CORS(
 		handlers.AllowedOrigins(validOrigins),
-		handlers.AllowedMethods([]string{"GET", "POST", "PUT", "DELETE", "OPTIONS"}),
-		handlers.AllowedHeaders([]string{"Accept", "Authorization", "Content-Type", "X-Requested-With", "Origin"}),
-		handlers.ExposedHeaders([]string{"Content-Length"}),
+		handlers.AllowedMethods([]string{"GET", "POST", "PUT", "PATCH", "HEAD", "DELETE", "OPTIONS"}),
+		handlers.AllowedHeaders([]string{"Accept", "Authorization", "Content-Type", "X-Requested-With", "Origin",
+			"Tus-Resumable", "Upload-Length", "Upload-Offset", "Upload-Metadata"}),
+		handlers.ExposedHeaders([]string{"Content-Length", "Location", "Tus-Resumable", "Tus-Version",
+			"Upload-Offset", "Upload-Length", "Upload-Expires", "X-Video-Id", "X-Task-Id"}),
 		handlers.AllowCredentials(),
 		handlers.MaxAge(300), // Cache preflight requests for 5 minutes
 	)
@@ -181,7 +229,7 @@ func main() {
 	port := getenv("PORT", "8080")
 	log.Printf("🎯 API server starting on port %s", port)
 	log.Printf("📍 Environment: DB_DSN=%s", getenv("DB_DSN", "not set"))
-	log.Printf("📍 Environment: SQS_QUEUE_URL=%s", queueURL)
+	log.Printf("📍 Environment: QUEUE_BACKEND=%s SQS_QUEUE_URL=%s", getenv("QUEUE_BACKEND", "sqs"), getenv("SQS_QUEUE_URL", "not set"))
 	log.Printf("📍 Environment: AWS_REGION=%s", getenv("AWS_REGION", "not set"))
 
 	log.Printf("✨ ANB API Server ready and listening on :%s", port)
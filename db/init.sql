@@ -47,4 +47,157 @@ CREATE TABLE IF NOT EXISTS job_status (
   expires_at    TIMESTAMP    NOT NULL
 );
 
-CREATE INDEX IF NOT EXISTS idx_job_status_expires ON job_status(expires_at);
\ No newline at end of file
+CREATE INDEX IF NOT EXISTS idx_job_status_expires ON job_status(expires_at);
+
+-- JOBS (cola de trabajos cuando QUEUE_BACKEND=postgres)
+CREATE TABLE IF NOT EXISTS jobs (
+  id            BIGSERIAL PRIMARY KEY,
+  queue         TEXT         NOT NULL,
+  body          TEXT         NOT NULL,
+  attributes    JSONB        NOT NULL DEFAULT '{}',
+  receive_count INT          NOT NULL DEFAULT 0,
+  receipt       UUID         NULL,
+  visible_at    TIMESTAMP    NOT NULL DEFAULT NOW(),
+  created_at    TIMESTAMP    NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_jobs_queue_visible ON jobs(queue, visible_at);
+
+-- OUTBOX (trabajos escritos en la misma transacción que el video; los publica el relay)
+CREATE TABLE IF NOT EXISTS outbox (
+  id            BIGSERIAL PRIMARY KEY,
+  job_id        VARCHAR(50)  NOT NULL UNIQUE,
+  job_type      TEXT         NOT NULL,
+  video_id      INT          NOT NULL REFERENCES videos(id) ON DELETE CASCADE,
+  payload       JSONB        NOT NULL,
+  attempts      INT          NOT NULL DEFAULT 0,
+  last_error    TEXT         NULL,
+  created_at    TIMESTAMP    NOT NULL DEFAULT NOW(),
+  sent_at       TIMESTAMP    NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_outbox_pending ON outbox(id) WHERE sent_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_outbox_video_id ON outbox(video_id);
+
+-- Motivo de falla visible en GET /api/videos/{id}
+ALTER TABLE videos ADD COLUMN IF NOT EXISTS failure_reason TEXT NULL;
+
+-- JOB CHECKPOINTS (etapas completadas por trabajo; un reintento retoma desde la primera pendiente)
+CREATE TABLE IF NOT EXISTS job_checkpoints (
+  job_id        VARCHAR(50)  NOT NULL,
+  stage         TEXT         NOT NULL,
+  artifacts     JSONB        NOT NULL DEFAULT '{}',
+  completed_at  TIMESTAMP    NOT NULL DEFAULT NOW(),
+  PRIMARY KEY (job_id, stage)
+);
+
+CREATE INDEX IF NOT EXISTS idx_job_checkpoints_completed ON job_checkpoints(completed_at);
+
+-- Metadatos de ffprobe del archivo subido
+ALTER TABLE videos ADD COLUMN IF NOT EXISTS duration_sec DOUBLE PRECISION NULL;
+ALTER TABLE videos ADD COLUMN IF NOT EXISTS width        INT          NULL;
+ALTER TABLE videos ADD COLUMN IF NOT EXISTS height       INT          NULL;
+ALTER TABLE videos ADD COLUMN IF NOT EXISTS fps          DOUBLE PRECISION NULL;
+ALTER TABLE videos ADD COLUMN IF NOT EXISTS video_codec  TEXT         NULL;
+ALTER TABLE videos ADD COLUMN IF NOT EXISTS audio_codec  TEXT         NULL;
+
+-- Playlist maestra HLS (opcional, WORKER_HLS_ENABLED)
+ALTER TABLE videos ADD COLUMN IF NOT EXISTS hls_url VARCHAR(512) NULL;
+
+-- Perfil de procesamiento elegido al subir (ver PROFILES_FILE)
+ALTER TABLE videos ADD COLUMN IF NOT EXISTS profile VARCHAR(50) NOT NULL DEFAULT 'default';
+
+-- Política de audio aplicada por el worker (strip, keep, normalize, replace)
+ALTER TABLE videos ADD COLUMN IF NOT EXISTS audio_policy VARCHAR(20) NULL;
+
+-- Miniaturas por tamaño (small, medium, large) y sprite de previsualización con su pista WebVTT
+ALTER TABLE videos ADD COLUMN IF NOT EXISTS thumbnails     JSONB        NULL;
+ALTER TABLE videos ADD COLUMN IF NOT EXISTS sprite_url     VARCHAR(512) NULL;
+ALTER TABLE videos ADD COLUMN IF NOT EXISTS sprite_vtt_url VARCHAR(512) NULL;
+
+-- Clip de previsualización (3s, sin audio) para la galería pública, y GIF opcional
+ALTER TABLE videos ADD COLUMN IF NOT EXISTS preview_url     VARCHAR(512) NULL;
+ALTER TABLE videos ADD COLUMN IF NOT EXISTS preview_gif_url VARCHAR(512) NULL;
+
+-- Subida directa al bucket (URL prefirmada): el video queda en 'draft' hasta completar la subida
+ALTER TABLE videos ADD COLUMN IF NOT EXISTS upload_expires_at TIMESTAMP NULL;
+CREATE INDEX IF NOT EXISTS idx_videos_draft_expires ON videos(upload_expires_at) WHERE status = 'draft';
+
+-- Subidas reanudables (protocolo tus): el archivo se arma como multipart upload en el bucket de uploads
+-- y el video asociado queda en 'draft' hasta recibir el último byte
+CREATE TABLE IF NOT EXISTS resumable_uploads (
+  id            VARCHAR(50)  PRIMARY KEY,
+  user_id       INT          NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  video_id      INT          NULL REFERENCES videos(id) ON DELETE SET NULL,
+  s3_key        VARCHAR(512) NOT NULL,
+  multipart_id  TEXT         NOT NULL,
+  length        BIGINT       NOT NULL,
+  upload_offset BIGINT       NOT NULL DEFAULT 0,
+  tail_size     BIGINT       NOT NULL DEFAULT 0,
+  parts         JSONB        NOT NULL DEFAULT '[]',
+  job_id        VARCHAR(50)  NULL,
+  created_at    TIMESTAMP    NOT NULL DEFAULT NOW(),
+  expires_at    TIMESTAMP    NOT NULL,
+  completed_at  TIMESTAMP    NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_resumable_uploads_expires ON resumable_uploads(expires_at);
+
+-- Hash SHA-256 del archivo original: un usuario no puede tener dos videos con el mismo contenido
+-- (salvo los fallidos, que pueden volver a subirse)
+ALTER TABLE videos ADD COLUMN IF NOT EXISTS content_sha256 CHAR(64) NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_videos_user_content ON videos(user_id, content_sha256)
+  WHERE content_sha256 IS NOT NULL AND status <> 'failed';
+
+-- Estado del hash SHA-256 de una subida reanudable, sobre los bytes ya guardados en partes
+ALTER TABLE resumable_uploads ADD COLUMN IF NOT EXISTS hash_state BYTEA NULL;
+
+-- Rol del usuario: los 'admin' pueden ver, modificar y eliminar cualquier video.
+-- Se asigna a mano: UPDATE users SET role='admin' WHERE email='...';
+ALTER TABLE users ADD COLUMN IF NOT EXISTS role VARCHAR(20) NOT NULL DEFAULT 'user';
+
+-- CONCURSOS: un video inscrito en un concurso en curso (starts_at <= NOW() < ends_at) no se puede eliminar
+CREATE TABLE IF NOT EXISTS contests (
+  id            SERIAL PRIMARY KEY,
+  name          TEXT         NOT NULL,
+  starts_at     TIMESTAMP    NOT NULL,
+  ends_at       TIMESTAMP    NOT NULL,
+  created_at    TIMESTAMP    NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS contest_entries (
+  contest_id    INT          NOT NULL REFERENCES contests(id) ON DELETE CASCADE,
+  video_id      INT          NOT NULL REFERENCES videos(id) ON DELETE CASCADE,
+  created_at    TIMESTAMP    NOT NULL DEFAULT NOW(),
+  PRIMARY KEY (contest_id, video_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_contest_entries_video ON contest_entries(video_id);
+
+-- Papelera: un video eliminado queda oculto (con sus votos y archivos) hasta restaurarse o purgarse
+-- al vencer VIDEO_TRASH_RETENTION. Los videos en la papelera no cuentan como duplicados.
+ALTER TABLE videos ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP NULL;
+CREATE INDEX IF NOT EXISTS idx_videos_deleted_at ON videos(deleted_at) WHERE deleted_at IS NOT NULL;
+DROP INDEX IF EXISTS idx_videos_user_content;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_videos_user_content_live ON videos(user_id, content_sha256)
+  WHERE content_sha256 IS NOT NULL AND status <> 'failed' AND deleted_at IS NULL;
+
+-- Metadatos editables con PATCH /api/videos/{id}: descripción, etiquetas (arreglo JSON) y visibilidad
+-- ('public' | 'unlisted' | 'private')
+ALTER TABLE videos ADD COLUMN IF NOT EXISTS description TEXT NULL;
+ALTER TABLE videos ADD COLUMN IF NOT EXISTS tags JSONB NOT NULL DEFAULT '[]';
+ALTER TABLE videos ADD COLUMN IF NOT EXISTS visibility VARCHAR(10) NOT NULL DEFAULT 'public';
+
+-- Visibilidad: solo los videos 'public' (desde publish_at, si se programó) aparecen en la galería y el ranking
+-- y reciben votos. Los 'unlisted' se ven con el enlace de su share_token y los 'private' solo su dueño.
+ALTER TABLE videos ADD COLUMN IF NOT EXISTS share_token VARCHAR(32) NULL;
+ALTER TABLE videos ADD COLUMN IF NOT EXISTS publish_at TIMESTAMP NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_videos_share_token ON videos(share_token) WHERE share_token IS NOT NULL;
+
+-- Los videos nuevos nacen privados para revisarlos antes de entrar a la galería y al ranking; el 'public'
+-- anterior solo sirvió para rellenar los videos existentes al agregar la columna.
+ALTER TABLE videos ALTER COLUMN visibility SET DEFAULT 'private';
+
+-- Fallos reales de cada trabajo: los reintentos se cuentan aquí y no con las entregas de la cola, para que
+-- un apagado del worker o un mensaje que cambió de dueño no consuman WORKER_MAX_ATTEMPTS.
+ALTER TABLE job_status ADD COLUMN IF NOT EXISTS failures INT NOT NULL DEFAULT 0;